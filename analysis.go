@@ -0,0 +1,118 @@
+package tablib
+
+import (
+	"errors"
+	"fmt"
+	"tablib/dice"
+	"tablib/table"
+	"tablib/validate"
+)
+
+//RowOdds is the chance of rolling a single content row of a table
+type RowOdds struct {
+	Row         int     //index of the content row
+	Content     string  //the row's content without any range or weight prefix
+	Low         int     //the lowest roll that selects the row
+	High        int     //the highest roll that selects the row
+	Probability float64 //0 if the row can never be rolled
+}
+
+//TableAnalysis describes the odds of rolling each row of a table
+type TableAnalysis struct {
+	Name         string
+	DiceExpr     string            //the dice rolled on the table
+	Distribution dice.Distribution //the distribution of the dice rolled
+	Rows         []*RowOdds
+
+	//Unreachable holds the indexes of rows that can never be rolled. Uncovered
+	//holds the possible rolls that select no row, lowest first, and
+	//UncoveredProbability the chance of making one of them
+	Unreachable          []int
+	Uncovered            []int
+	UncoveredProbability float64
+}
+
+func (cr *concreteTableRepo) AnalyzeDiceExpression(diceExpr string) (dice.Distribution, error) {
+	if diceExpr == "" {
+		return nil, fmt.Errorf("diceExpr cannot be empty")
+	}
+	vr := validate.NewValidationResult()
+	diceParsed := dice.ValidateDiceExpr(diceExpr, "Analyze Dice Expression", vr)
+	if !vr.Valid() {
+		return nil, errors.New(vr.Errors[0])
+	}
+	return dice.Analyze(diceParsed)
+}
+
+func (cr *concreteTableRepo) AnalyzeTable(tableName string) (*TableAnalysis, error) {
+	tbl, err := cr.tableForName(tableName)
+	if err != nil {
+		return nil, err
+	}
+	dist, err := dice.Analyze(tbl.Definition.DiceParsed)
+	if err != nil {
+		return nil, err
+	}
+
+	ta := &TableAnalysis{
+		Name:         tableName,
+		DiceExpr:     diceExprForTable(tbl),
+		Distribution: dist,
+		Rows:         rowOdds(tbl),
+		Unreachable:  make([]int, 0),
+		Uncovered:    make([]int, 0),
+	}
+	for _, ro := range ta.Rows {
+		ro.Probability = dist.Probability(ro.Low, ro.High)
+		if !canRoll(dist, ro.Low, ro.High) {
+			ta.Unreachable = append(ta.Unreachable, ro.Row)
+		}
+	}
+	for _, v := range dist.Values() {
+		if rowForRoll(ta.Rows, v) == nil {
+			ta.Uncovered = append(ta.Uncovered, v)
+			ta.UncoveredProbability += dist[v]
+		}
+	}
+	return ta, nil
+}
+
+//the rolls that select each row of a table, as rolled by the execution engine
+func rowOdds(tbl *table.Table) []*RowOdds {
+	rows := tbl.ContentRows()
+	odds := make([]*RowOdds, 0, len(rows))
+	if tbl.Definition.TableType == table.TypeRange {
+		for idx, rc := range tbl.RangeContent {
+			odds = append(odds, &RowOdds{Row: idx, Content: rc.Content, Low: rc.Low, High: rc.High})
+		}
+		return odds
+	}
+
+	//flat and weighted rows cover as many faces as their weight
+	low := 1
+	for idx, w := range tbl.Weights() {
+		odds = append(odds, &RowOdds{Row: idx, Content: rows[idx], Low: low, High: low + w - 1})
+		low += w
+	}
+	return odds
+}
+
+//true if a roll from low to high inclusive is possible
+func canRoll(dist dice.Distribution, low, high int) bool {
+	for v := range dist {
+		if v >= low && v <= high {
+			return true
+		}
+	}
+	return false
+}
+
+//the row selected by a roll, nil if there is none
+func rowForRoll(rows []*RowOdds, roll int) *RowOdds {
+	for _, ro := range rows {
+		if roll >= ro.Low && roll <= ro.High {
+			return ro
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package tablib
+
+/*
+These tests focus on the probability analysis of dice and tables
+*/
+
+import (
+	"math"
+	"testing"
+)
+
+func nearly(have, want float64) bool {
+	return math.Abs(have-want) < 1e-9
+}
+
+func TestAnalyzeTable_shouldReportRangeRowOdds(t *testing.T) {
+	yml := `
+  definition:
+    name: Encounters
+    type: range
+    roll: 2d6
+  content:
+    - "{1}never"
+    - "{2-6}low"
+    - "{7}middle"
+    - "{8-12}high"`
+
+	repo := NewTableRepository()
+	_, err := repo.AddTable([]byte(yml))
+	failOnErr("Unable to add table", err, t)
+
+	ta, err := repo.AnalyzeTable("Encounters")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ta.DiceExpr != "2d6" || len(ta.Rows) != 4 {
+		t.Fatalf("Unexpected analysis: %+v", ta)
+	}
+	for i, want := range []float64{0, 15.0 / 36, 6.0 / 36, 15.0 / 36} {
+		if !nearly(ta.Rows[i].Probability, want) {
+			t.Errorf("Row %d has probability %f want %f", i, ta.Rows[i].Probability, want)
+		}
+	}
+	if ta.Rows[3].Content != "high" || ta.Rows[3].Low != 8 || ta.Rows[3].High != 12 {
+		t.Errorf("Unexpected row: %+v", ta.Rows[3])
+	}
+	if len(ta.Unreachable) != 1 || ta.Unreachable[0] != 0 {
+		t.Errorf("Unexpected unreachable rows: %v", ta.Unreachable)
+	}
+	//tables whose ranges miss possible rolls are rejected when added
+	if len(ta.Uncovered) != 0 || ta.UncoveredProbability != 0 {
+		t.Errorf("Unexpected uncovered rolls: %v %f", ta.Uncovered, ta.UncoveredProbability)
+	}
+}
+
+func TestAnalyzeTable_shouldReportFlatAndWeightedRowOdds(t *testing.T) {
+	repo := NewTableRepository()
+	_, err := repo.AddTable([]byte(weightedYml))
+	failOnErr("Unable to add table", err, t)
+	_, err = repo.AddTable([]byte(limitsYmlInner))
+	failOnErr("Unable to add table", err, t)
+
+	ta, err := repo.AnalyzeTable("TestTable_Weighted")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ta.DiceExpr != "1d9" || len(ta.Unreachable) != 0 || len(ta.Uncovered) != 0 {
+		t.Errorf("Unexpected analysis: %+v", ta)
+	}
+	for i, want := range []float64{5.0 / 9, 3.0 / 9, 1.0 / 9} {
+		if !nearly(ta.Rows[i].Probability, want) {
+			t.Errorf("Row %d has probability %f want %f", i, ta.Rows[i].Probability, want)
+		}
+	}
+	if ta.Rows[1].Content != "orc" || ta.Rows[1].Low != 6 || ta.Rows[1].High != 8 {
+		t.Errorf("Unexpected row: %+v", ta.Rows[1])
+	}
+
+	ta, err = repo.AnalyzeTable("Inner")
+	if err != nil || len(ta.Rows) != 3 || !nearly(ta.Rows[2].Probability, 1.0/3) {
+		t.Errorf("Unexpected analysis: %+v %v", ta, err)
+	}
+
+	if _, err := repo.AnalyzeTable("Missing"); err == nil {
+		t.Error("Expected an error for a missing table")
+	}
+}
+
+func TestAnalyzeDiceExpression_shouldComputeDistribution(t *testing.T) {
+	repo := NewTableRepository()
+	dist, err := repo.AnalyzeDiceExpression("2d20kh1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !nearly(dist[20], 39.0/400) || !nearly(dist[1], 1.0/400) {
+		t.Errorf("Unexpected distribution: %v", dist)
+	}
+	for _, expr := range []string{"", "2d"} {
+		if _, err := repo.AnalyzeDiceExpression(expr); err == nil {
+			t.Errorf("Expected an error for: %s", expr)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"tablib"
+	"tablib/lsp"
+	"tablib/repl"
+	"tablib/tableresult"
+	"tablib/validate"
+)
+
+func (c *cli) roll(args []string) error {
+	flags := c.newFlagSet("roll")
+	count := flags.Int("n", 1, "the number of times to roll")
+	positional, err := parseInterleaved(flags, args)
+	if err != nil || len(positional) != 1 || *count < 1 {
+		return errUsage
+	}
+	if err := c.requireItem(positional[0], "table"); err != nil {
+		return err
+	}
+	return c.printTableResult(c.repo.Roll(positional[0], *count))
+}
+
+func (c *cli) pick(args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	count, err := strconv.Atoi(args[1])
+	if err != nil || count < 1 {
+		return errUsage
+	}
+	if err := c.requireItem(args[0], "table"); err != nil {
+		return err
+	}
+	return c.printTableResult(c.repo.Pick(args[0], count))
+}
+
+func (c *cli) exec(args []string) error {
+	flags := c.newFlagSet("exec")
+	var params multiFlag
+	flags.Var(&params, "param", "a script parameter as name=value, may be repeated")
+	positional, err := parseInterleaved(flags, args)
+	if err != nil || len(positional) != 1 {
+		return errUsage
+	}
+	values := make(map[string]string, len(params))
+	for _, p := range params {
+		parts := strings.SplitN(p, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("Invalid parameter: %s, expected name=value", p)
+		}
+		values[parts[0]] = parts[1]
+	}
+	if err := c.requireItem(positional[0], "script"); err != nil {
+		return err
+	}
+
+	callback := func(specs []*tablib.ParamSpecification) map[string]string {
+		chosen := tablib.DefaultParamSpecificationCallback(specs)
+		for name, v := range values {
+			chosen[name] = v
+		}
+		return chosen
+	}
+	results := c.repo.Execute(positional[0], callback)
+	keys := make([]string, 0, len(results))
+	for k := range results {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(c.stdout, "%s: %s\n", k, results[k])
+	}
+	if scriptErr, failed := results["Script-Error"]; failed {
+		return fmt.Errorf("Script: %s failed: %s", positional[0], scriptErr)
+	}
+	return nil
+}
+
+func (c *cli) dice(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	value, err := c.repo.EvaluateDiceExpression(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.stdout, value)
+	return nil
+}
+
+func (c *cli) list(args []string) error {
+	switch len(args) {
+	case 0:
+		items, err := c.repo.Search("", nil)
+		if err != nil {
+			return err
+		}
+		sortItems(items)
+		for _, sr := range items {
+			fmt.Fprintf(c.stdout, "%s\t%s\n", sr.Type, sr.Name)
+		}
+		return nil
+	case 1:
+		source, err := c.repo.List(args[0], "table")
+		if err != nil {
+			source, err = c.repo.List(args[0], "script")
+		}
+		if err != nil {
+			return fmt.Errorf("No table or script named: %s", args[0])
+		}
+		fmt.Fprintln(c.stdout, strings.TrimSpace(source))
+		return nil
+	}
+	return errUsage
+}
+
+func (c *cli) search(args []string) error {
+	flags := c.newFlagSet("search")
+	var tags multiFlag
+	flags.Var(&tags, "tag", "only items with this tag, may be repeated to match any of several")
+	positional, err := parseInterleaved(flags, args)
+	if err != nil || len(positional) > 1 {
+		return errUsage
+	}
+	namePredicate := ""
+	if len(positional) == 1 {
+		namePredicate = positional[0]
+	}
+
+	items, err := c.repo.Search(namePredicate, tags)
+	if err != nil {
+		return err
+	}
+	sortItems(items)
+	for _, sr := range items {
+		fmt.Fprintf(c.stdout, "%s\t%s\t%s\n", sr.Type, sr.Name, strings.Join(sr.Tags, ","))
+	}
+	return nil
+}
+
+func (c *cli) tags(args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	for _, tag := range c.repo.Tags() {
+		fmt.Fprintln(c.stdout, tag)
+	}
+	return nil
+}
+
+func (c *cli) repl(args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	return repl.NewSession(c.repo).Run(c.stdin, c.stdout)
+}
+
+//the server loads the content directory itself, reloading it as it is edited
+func (c *cli) lsp(args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	return lsp.NewServer(c.dir).Serve(c.stdin, c.stdout)
+}
+
+func (c *cli) validate(args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	failed := 0
+	for _, f := range c.report.Files {
+		status := "ok"
+		if !f.Loaded() {
+			status = "FAILED"
+			failed++
+		}
+		fmt.Fprintf(c.stdout, "%s: %s %s %s\n", f.Path, status, f.ItemType, f.Name)
+		if f.Err != nil {
+			fmt.Fprintf(c.stdout, "  ERROR: %v\n", f.Err)
+		}
+		if f.ValidationResult != nil {
+			printIssues(c.stdout, f.ValidationResult.Diagnostics)
+		}
+	}
+
+	//references can only be checked once everything is loaded
+	refs := c.repo.ValidateReferences()
+	if refs.IssueCount() > 0 {
+		fmt.Fprintln(c.stdout, "references:")
+		printIssues(c.stdout, refs.Diagnostics)
+	}
+
+	fmt.Fprintf(c.stdout, "%d file(s), %d failed, %d reference error(s)\n",
+		len(c.report.Files), failed, refs.ErrorCount())
+	if failed > 0 || !refs.Valid() {
+		return errors.New("Validation failed")
+	}
+	return nil
+}
+
+func (c *cli) newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {} //run prints the usage
+	return flags
+}
+
+//fails if the named table or script does not exist
+func (c *cli) requireItem(name, itemType string) error {
+	_, err := c.repo.List(name, itemType)
+	return err
+}
+
+//prints the results, failing if execution was cut off or produced nothing
+func (c *cli) printTableResult(tr *tableresult.TableResult) error {
+	for _, r := range tr.Result {
+		fmt.Fprintln(c.stdout, r)
+	}
+	if tr.Err != nil {
+		return tr.Err
+	}
+	if len(tr.Result) == 0 {
+		return errors.New(strings.Join(tr.Log, "\n"))
+	}
+	return nil
+}
+
+//prints each issue, prefixed with where it is in the source if known eg
+//tables/npc.yml:12:7: ERROR: Content - Unclosed open brace {
+func printIssues(w io.Writer, issues []*validate.Diagnostic) {
+	for _, d := range issues {
+		if d.Position.IsValid() {
+			fmt.Fprintf(w, "  %s: %s\n", d.Position, d)
+			continue
+		}
+		fmt.Fprintf(w, "  %s\n", d)
+	}
+}
+
+//scripts first, then by name
+func sortItems(items []*tablib.SearchResult) {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Type != items[j].Type {
+			return items[i].Type == "script"
+		}
+		return items[i].Name < items[j].Name
+	})
+}
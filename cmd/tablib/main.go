@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"tablib"
+)
+
+const usage = `usage: tablib [-dir path] [-seed n] <command> [arguments]
+
+Loads every table (.yml, .yaml) and script (.lua) found under the content
+directory and then runs one of these commands:
+
+  roll <table> [-n count]         roll on a table count times, default 1
+  pick <table> <count>            pick count unique items from a table
+  exec <script> [--param k=v]...  run a script, parameters not given take their defaults
+  dice <expr>                     evaluate a dice expression
+  list [name]                     list all tables and scripts, or the source of one
+  search [regex] [--tag t]...     search tables and scripts by name and tags
+  tags                            list all tags
+  repl                            start an interactive session, tab completes names
+  lsp                             serve the Language Server Protocol on stdin and
+                                  stdout for editing the content directory
+  validate                        report the validation results of every file and
+                                  of the references between them. Exits with 1 if
+                                  there are errors
+
+Options:
+`
+
+//exit codes
+const (
+	exitOK    = 0
+	exitFail  = 1 //the command ran but failed, or found errors
+	exitUsage = 2 //the command line was not understood
+)
+
+//errUsage is returned by commands given bad arguments
+var errUsage = errors.New("bad arguments")
+
+//cli holds what every command needs
+type cli struct {
+	repo   tablib.TableRepository
+	report *tablib.LoadReport
+	dir    string //the content directory
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type command func(c *cli, args []string) error
+
+var commands = map[string]command{
+	"roll":     (*cli).roll,
+	"pick":     (*cli).pick,
+	"exec":     (*cli).exec,
+	"dice":     (*cli).dice,
+	"list":     (*cli).list,
+	"search":   (*cli).search,
+	"tags":     (*cli).tags,
+	"repl":     (*cli).repl,
+	"lsp":      (*cli).lsp,
+	"validate": (*cli).validate,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+//run runs the command line and returns the exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("tablib", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	dir := flags.String("dir", ".", "the content directory")
+	seed := flags.Int64("seed", 0, "seed the random number generator to repeat results, 0 for a random seed")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	cmd, found := commands[flags.Arg(0)]
+	if !found {
+		fmt.Fprintf(stderr, "Unknown command: %s\n", flags.Arg(0))
+		flags.Usage()
+		return exitUsage
+	}
+
+	var opts []tablib.RepositoryOption
+	if *seed != 0 {
+		opts = append(opts, tablib.WithSeed(*seed))
+	}
+	c := &cli{
+		repo:   tablib.NewTableRepository(opts...),
+		dir:    *dir,
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+	report, err := c.repo.LoadFS(os.DirFS(*dir))
+	if err != nil {
+		fmt.Fprintf(stderr, "Unable to load content: %v\n", err)
+		return exitFail
+	}
+	c.report = report
+	if failed := report.Failed(); len(failed) > 0 && flags.Arg(0) != "validate" {
+		fmt.Fprintf(stderr, "Warning: %d file(s) did not load, run validate for details\n", len(failed))
+	}
+
+	err = cmd(c, flags.Args()[1:])
+	switch {
+	case errors.Is(err, errUsage):
+		flags.Usage()
+		return exitUsage
+	case err != nil:
+		fmt.Fprintln(stderr, err)
+		return exitFail
+	}
+	return exitOK
+}
+
+//parseInterleaved parses flags that may come before, after or between the
+//positional arguments eg roll Encounters -n 3, returning the positional arguments
+func parseInterleaved(flags *flag.FlagSet, args []string) ([]string, error) {
+	positional := make([]string, 0, len(args))
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, errUsage
+		}
+		if flags.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
+
+//a flag that may be given any number of times
+type multiFlag []string
+
+func (mf *multiFlag) String() string {
+	return fmt.Sprint(*mf)
+}
+
+func (mf *multiFlag) Set(value string) error {
+	*mf = append(*mf, value)
+	return nil
+}
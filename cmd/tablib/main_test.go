@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var content = map[string]string{
+	"tables/flavors.yml": `
+definition:
+  name: Flavors
+  type: flat
+  tags:
+    - dessert
+content:
+  - chocolate`,
+	"tables/toppings.yml": `
+definition:
+  name: Toppings
+  type: flat
+content:
+  - nuts
+  - sprinkles`,
+	"scripts/sundae.lua": `
+local t = require("tables")
+results = {}
+params = {}
+params["size"] = "small|large"
+function main(p)
+  results["flavor"] = t.roll("Flavors")
+  results["size"] = p["size"]
+end`,
+}
+
+//writes the content, and any extra files, to a new directory
+func contentDir(t *testing.T, extra map[string]string) string {
+	dir := t.TempDir()
+	write := func(files map[string]string) {
+		for name, data := range files {
+			p := filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	write(content)
+	write(extra)
+	return dir
+}
+
+func runCLI(dir string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(append([]string{"-dir", dir, "-seed", "1"}, args...), strings.NewReader(""), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun_shouldRollAndPick(t *testing.T) {
+	dir := contentDir(t, nil)
+
+	code, out, errOut := runCLI(dir, "roll", "Flavors", "-n", "2")
+	if code != exitOK || out != "chocolate\nchocolate\n" {
+		t.Errorf("Unexpected roll: %d %q %q", code, out, errOut)
+	}
+	code, out, _ = runCLI(dir, "pick", "Toppings", "2")
+	if code != exitOK || (out != "nuts|sprinkles\n" && out != "sprinkles|nuts\n") {
+		t.Errorf("Unexpected pick: %d %q", code, out)
+	}
+	code, _, errOut = runCLI(dir, "roll", "Missing")
+	if code != exitFail || !strings.Contains(errOut, "Missing") {
+		t.Errorf("Unexpected result for missing table: %d %q", code, errOut)
+	}
+	if code, _, _ = runCLI(dir, "pick", "Toppings", "x"); code != exitUsage {
+		t.Errorf("Unexpected result for bad count: %d", code)
+	}
+}
+
+func TestRun_shouldExecuteScripts(t *testing.T) {
+	dir := contentDir(t, nil)
+
+	code, out, _ := runCLI(dir, "exec", "sundae")
+	if code != exitOK || out != "flavor: chocolate\nsize: small\n" {
+		t.Errorf("Unexpected exec: %d %q", code, out)
+	}
+	code, out, _ = runCLI(dir, "exec", "--param", "size=large", "sundae")
+	if code != exitOK || out != "flavor: chocolate\nsize: large\n" {
+		t.Errorf("Unexpected exec: %d %q", code, out)
+	}
+	if code, _, _ = runCLI(dir, "exec", "sundae", "--param", "size"); code != exitFail {
+		t.Errorf("Unexpected result for bad param: %d", code)
+	}
+}
+
+func TestRun_shouldEvaluateDice(t *testing.T) {
+	dir := contentDir(t, nil)
+
+	code, out, _ := runCLI(dir, "dice", "1d1", "+", "2")
+	if code != exitOK || out != "3\n" {
+		t.Errorf("Unexpected dice: %d %q", code, out)
+	}
+	if code, _, _ = runCLI(dir, "dice", "2x6"); code != exitFail {
+		t.Errorf("Unexpected result for bad dice: %d", code)
+	}
+}
+
+func TestRun_shouldListAndSearch(t *testing.T) {
+	dir := contentDir(t, nil)
+
+	code, out, _ := runCLI(dir, "list")
+	if code != exitOK || out != "script\tsundae\ntable\tFlavors\ntable\tToppings\n" {
+		t.Errorf("Unexpected list: %d %q", code, out)
+	}
+	code, out, _ = runCLI(dir, "list", "Toppings")
+	if code != exitOK || !strings.Contains(out, "sprinkles") {
+		t.Errorf("Unexpected listing: %d %q", code, out)
+	}
+	code, out, _ = runCLI(dir, "search", "--tag", "dessert")
+	if code != exitOK || out != "table\tFlavors\tdessert\n" {
+		t.Errorf("Unexpected search: %d %q", code, out)
+	}
+	code, out, _ = runCLI(dir, "search", "^T")
+	if code != exitOK || out != "table\tToppings\t\n" {
+		t.Errorf("Unexpected search: %d %q", code, out)
+	}
+	code, out, _ = runCLI(dir, "tags")
+	if code != exitOK || out != "dessert\n" {
+		t.Errorf("Unexpected tags: %d %q", code, out)
+	}
+}
+
+func TestRun_shouldValidateContent(t *testing.T) {
+	code, out, _ := runCLI(contentDir(t, nil), "validate")
+	if code != exitOK || !strings.Contains(out, "3 file(s), 0 failed, 0 reference error(s)") {
+		t.Errorf("Unexpected validation: %d %q", code, out)
+	}
+
+	dir := contentDir(t, map[string]string{
+		"tables/broken.yml": `
+definition:
+  name: Broken
+  type: flat
+content:
+  - "{@Nowhere}"
+  - "{@bad name}"`,
+	})
+	code, out, errOut := runCLI(dir, "validate")
+	if code != exitFail || !strings.Contains(out, "tables/broken.yml: FAILED table Broken") ||
+		!strings.Contains(out, "  tables/broken.yml:7:5: ERROR: Content - Invalid identifier") {
+		t.Errorf("Unexpected validation: %d %q %q", code, out, errOut)
+	}
+}
+
+func TestRun_shouldStartRepl(t *testing.T) {
+	dir := contentDir(t, nil)
+	var stdout, stderr bytes.Buffer
+	stdin := strings.NewReader("roll Flavors\nrun sundae size=large\n")
+	code := run([]string{"-dir", dir, "-seed", "1", "repl"}, stdin, &stdout, &stderr)
+	want := "> chocolate\n> flavor: chocolate\nsize: large\n> \n"
+	if code != exitOK || stdout.String() != want {
+		t.Errorf("Unexpected session: %d %q %q", code, stdout.String(), stderr.String())
+	}
+}
+
+func TestRun_shouldServeLanguageServer(t *testing.T) {
+	dir := contentDir(t, map[string]string{"tables/broken.yml": "definition:\n  name: Broken"})
+	frame := func(msgs ...string) string {
+		var sb strings.Builder
+		for _, msg := range msgs {
+			fmt.Fprintf(&sb, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+		}
+		return sb.String()
+	}
+	var stdout, stderr bytes.Buffer
+	stdin := strings.NewReader(frame(
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","method":"initialized","params":{}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`))
+	code := run([]string{"-dir", dir, "lsp"}, stdin, &stdout, &stderr)
+	out := stdout.String()
+	if code != exitOK || !strings.Contains(out, `"capabilities"`) || !strings.Contains(out, "tables/broken.yml") {
+		t.Errorf("Unexpected session: %d %q %q", code, out, stderr.String())
+	}
+
+	stdin = strings.NewReader(frame(`{"jsonrpc":"2.0","method":"exit"}`))
+	if code := run([]string{"-dir", dir, "lsp"}, stdin, &stdout, &stderr); code != exitFail {
+		t.Errorf("Exiting without shutting down should fail: %d", code)
+	}
+}
+
+func TestRun_shouldReportUsage(t *testing.T) {
+	dir := contentDir(t, nil)
+	for _, args := range [][]string{{}, {"nope"}, {"roll"}, {"roll", "Flavors", "-x"}, {"tags", "extra"}} {
+		code, _, errOut := runCLI(dir, args...)
+		if code != exitUsage || !strings.Contains(errOut, "usage: tablib") {
+			t.Errorf("%v: unexpected result: %d %q", args, code, errOut)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package dice
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//Die is a single die of a Roll
+type Die struct {
+	Value    int   //the die's value, the sum of its faces
+	Faces    []int //the faces counted, more than one if the die exploded
+	Rerolled []int //faces that were rolled and then rerolled, in the order rolled
+	Exploded bool  //true if the die showed its highest face and was rolled again
+	Kept     bool  //false if the die was dropped by a keep or drop modifier
+}
+
+//Breakdown describes how a dice expression, or part of one, was evaluated. It
+//mirrors the expression's syntax tree
+type Breakdown struct {
+	Kind  string       //one of the Kind* constants
+	Expr  string       //the part of the expression described, in canonical form
+	Value int          //the value of this part of the expression
+	Op    string       //for operators, one of + - * /
+	Dice  []*Die       //for rolls, every die rolled whether kept or not
+	Terms []*Breakdown //for operators both sides, for negations and groups the part within
+}
+
+const (
+	//KindConstant is a plain number
+	KindConstant = "constant"
+
+	//KindRoll is a roll of dice
+	KindRoll = "roll"
+
+	//KindOperator is an arithmetic operator applied to two terms
+	KindOperator = "operator"
+
+	//KindNegation is a unary minus applied to a term
+	KindNegation = "negation"
+
+	//KindGroup is a parenthesised term
+	KindGroup = "group"
+)
+
+//Explain describes the constant
+func (c *Constant) Explain(rnd Source) *Breakdown {
+	return &Breakdown{Kind: KindConstant, Expr: c.String(), Value: c.Value}
+}
+
+//Explain rolls the dice, describing each of them
+func (r *Roll) Explain(rnd Source) *Breakdown {
+	dice := r.RollDice(rnd)
+	return &Breakdown{Kind: KindRoll, Expr: r.String(), Value: total(dice), Dice: dice}
+}
+
+//Explain describes both sides and the operator
+func (b *BinaryOp) Explain(rnd Source) *Breakdown {
+	left := b.Left.Explain(rnd)
+	right := b.Right.Explain(rnd)
+	return &Breakdown{
+		Kind:  KindOperator,
+		Expr:  b.String(),
+		Value: Apply(b.Op, left.Value, right.Value),
+		Op:    b.Op,
+		Terms: []*Breakdown{left, right},
+	}
+}
+
+//Explain describes the negated operand
+func (n *Negation) Explain(rnd Source) *Breakdown {
+	operand := n.Operand.Explain(rnd)
+	return &Breakdown{Kind: KindNegation, Expr: n.String(), Value: -operand.Value, Terms: []*Breakdown{operand}}
+}
+
+//Explain describes the inner expression
+func (g *Group) Explain(rnd Source) *Breakdown {
+	inner := g.Inner.Explain(rnd)
+	return &Breakdown{Kind: KindGroup, Expr: g.String(), Value: inner.Value, Terms: []*Breakdown{inner}}
+}
+
+//String describes the evaluation on a single line eg 2d6 + 3 = [4, 2] + 3 = 9.
+//Dropped dice are marked with ~ and exploding faces with !
+func (bd *Breakdown) String() string {
+	return fmt.Sprintf("%s = %s = %d", bd.Expr, bd.Detail(), bd.Value)
+}
+
+//Detail describes the evaluation with each roll replaced by its dice eg
+//[4, 2] + 3
+func (bd *Breakdown) Detail() string {
+	switch bd.Kind {
+	case KindRoll:
+		dice := make([]string, 0, len(bd.Dice))
+		for _, die := range bd.Dice {
+			dice = append(dice, die.String())
+		}
+		return "[" + strings.Join(dice, ", ") + "]"
+	case KindOperator:
+		return fmt.Sprintf("%s %s %s", bd.Terms[0].Detail(), bd.Op, bd.Terms[1].Detail())
+	case KindNegation:
+		return "-" + bd.Terms[0].Detail()
+	case KindGroup:
+		return "(" + bd.Terms[0].Detail() + ")"
+	}
+	return strconv.Itoa(bd.Value)
+}
+
+//String describes the die eg 4, ~1 if dropped or 6!+3 if it exploded
+func (d *Die) String() string {
+	faces := make([]string, 0, len(d.Faces))
+	for i, f := range d.Faces {
+		face := strconv.Itoa(f)
+		if d.Exploded && i < len(d.Faces)-1 {
+			face += "!"
+		}
+		faces = append(faces, face)
+	}
+	str := strings.Join(faces, "+")
+	if !d.Kept {
+		str = "~" + str
+	}
+	return str
+}
@@ -0,0 +1,68 @@
+package dice
+
+import (
+	"testing"
+)
+
+func explainWith(expr string, t *testing.T, faces ...int) *Breakdown {
+	t.Helper()
+	e, err := Parse(expr)
+	if err != nil {
+		t.Fatalf("Unable to parse: %v", err)
+	}
+	return e.Explain(&scriptedSource{faces: faces})
+}
+
+func TestExplain_shouldDescribeEvaluation(t *testing.T) {
+	for expr, want := range map[string]string{
+		"2d6+3":             "2d6 + 3 = [4, 2] + 3 = 9",
+		"4d6kh3":            "4d6kh3 = [4, 2, 5, ~1] = 11",
+		"4d6dh1 * 2":        "4d6dh1 * 2 = [4, 2, ~5, 1] * 2 = 14",
+		"-(d4 + 1)":         "-(1d4 + 1) = -([4] + 1) = -5",
+		"d6! + 1":           "1d6! + 1 = [4] + 1 = 5",
+		"7":                 "7 = 7 = 7",
+		"(2d20kl1 - 1) / 2": "(2d20kl1 - 1) / 2 = ([~4, 2] - 1) / 2 = 0",
+	} {
+		if got := explainWith(expr, t, 4, 2, 5, 1).String(); got != want {
+			t.Errorf("%s: got %s", expr, got)
+		}
+	}
+}
+
+func TestExplain_shouldDescribeEachDie(t *testing.T) {
+	bd := explainWith("3d6!r1kh2", t, 1, 6, 3, 2, 1, 1, 5)
+	if bd.Kind != KindRoll || bd.Value != 14 || len(bd.Dice) != 3 {
+		t.Fatalf("Unexpected breakdown: %+v", bd)
+	}
+
+	//the first die rerolled a 1 then exploded
+	die := bd.Dice[0]
+	if die.Value != 9 || len(die.Faces) != 2 || die.Faces[0] != 6 || die.Faces[1] != 3 ||
+		len(die.Rerolled) != 1 || !die.Exploded || !die.Kept {
+		t.Errorf("Unexpected first die: %+v", die)
+	}
+
+	//the second is dropped, the third rerolled two ones
+	if die := bd.Dice[1]; die.Value != 2 || die.Kept || die.Exploded {
+		t.Errorf("Unexpected second die: %+v", die)
+	}
+	if die := bd.Dice[2]; die.Value != 5 || len(die.Rerolled) != 2 || !die.Kept {
+		t.Errorf("Unexpected third die: %+v", die)
+	}
+	if bd.String() != "3d6r1!kh2 = [6!+3, ~2, 5] = 14" {
+		t.Errorf("Unexpected summary: %s", bd)
+	}
+}
+
+func TestExplain_shouldMatchEval(t *testing.T) {
+	e, err := Parse("3d6kh2 * (2dF + 4) - d%!/3")
+	if err != nil {
+		t.Fatalf("Unable to parse: %v", err)
+	}
+	explainSrc, evalSrc := &countingSource{}, &countingSource{}
+	for i := 0; i < 500; i++ {
+		if bd, v := e.Explain(explainSrc), e.Eval(evalSrc); bd.Value != v {
+			t.Fatalf("Explain gave %d but Eval gave %d", bd.Value, v)
+		}
+	}
+}
@@ -2,88 +2,310 @@ package dice
 
 import (
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 	"tablib/validate"
 )
 
-//ParseResult holds a result of parsing a Dice expression
-type ParseResult struct {
-	Count    int
-	DieType  int
-	Operator string // "+" or "-" or "*" or "none"
-}
-
-var (
-	xdyPattern = regexp.MustCompile("^([1-9][0-9]*)d([1-9][0-9]*)$")
-	intPattern = regexp.MustCompile("^[0-9]+$")
+//Dice expressions follow this grammar. Whitespace is ignored.
+//
+//  expr     := term (("+" | "-") term)*
+//  term     := unary (("*" | "/") unary)*
+//  unary    := "-" unary | primary
+//  primary  := number | roll | "(" expr ")"
+//  roll     := [number] "d" (number | "%" | "F") modifier*
+//  modifier := "r" number | "!" | ("k" | "kh" | "kl" | "dh" | "dl") number
+//
+//eg 4d6kh3, 2d20kl1, d6!, 2d6r1, 4dF, d%, (1d4 + 1) * 10 / 3
+const (
+	maxDiceCount = 1000    //dice in a single roll
+	maxSides     = 1000000 //sides of a single die
+	maxNesting   = 100     //depth of parentheses and unary minus
 )
 
-//ValidateDiceExpr validates and parses a dice expression
-func ValidateDiceExpr(diceExpr, section string, vr *validate.ValidationResult) []*ParseResult {
+//ValidateDiceExpr validates and parses a dice expression, returning the root of
+//its syntax tree or nil if it is invalid
+func ValidateDiceExpr(diceExpr, section string, vr *validate.ValidationResult) Expr {
 
 	//safety - should have been checked before this was called
 	if diceExpr == "" {
-		vr.Fail(section, "Programming error: call to checkDice with empty dice string!")
+		vr.Fail(section, "Programming error: call to checkDice with empty dice string!").WithCode(validate.CodeInvalidDice)
 		return nil
 	}
 
-	parseResults := make([]*ParseResult, 0, 1)
-	components := strings.Split(diceExpr, " ")
-
-	//check that the length of components is always odd eg xdy or xdy +- mdn
-	//should always be an odd number. If this fails to be true, then we have been
-	//provided something like xdy + (missing the mdn portion)
-	if len(components)%2 == 0 { //even!
-		vr.Fail(section, fmt.Sprintf("Malformed die expression: %s", diceExpr))
+	expr, err := Parse(diceExpr)
+	if err != nil {
+		vr.Fail(section, err.Error()).WithCode(validate.CodeInvalidDice)
 		return nil
 	}
+	return expr
+}
+
+//Parse parses a dice expression
+func Parse(diceExpr string) (Expr, error) {
+	tokens, err := tokenize(diceExpr)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid dice expression: %s - %v", diceExpr, err)
+	}
+	p := &parser{tokens: tokens}
+	expr := p.parseExpr()
+	if p.err == nil && p.peek().kind != tokEnd {
+		p.fail("unexpected %s", p.peek())
+	}
+	if p.err != nil {
+		return nil, fmt.Errorf("Invalid dice expression: %s - %v", diceExpr, p.err)
+	}
+	return expr, nil
+}
 
-	//consuming parser to validate & parse expressions: xdy +- mdn +- ... +- N
-	for len(components) > 0 {
+type tokenKind int
 
-		//first, check to see if we have a constant ending eg 2d6 + 3
-		//if we do, we want to consume that specially
-		if intPattern.MatchString(components[0]) {
-			constant, _ := strconv.Atoi(components[0]) //no err here as regex protects
-			pr := &ParseResult{
-				Count:    constant,
-				DieType:  0,
-				Operator: "none",
+const (
+	tokEnd tokenKind = iota
+	tokNumber
+	tokSymbol
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value int //for numbers
+	pos   int //1-based position in the expression
+}
+
+func (t token) String() string {
+	if t.kind == tokEnd {
+		return "end of expression"
+	}
+	return fmt.Sprintf("'%s' at position %d", t.text, t.pos)
+}
+
+//splits an expression into numbers and single character symbols
+func tokenize(diceExpr string) ([]token, error) {
+	tokens := make([]token, 0, len(diceExpr))
+	for i := 0; i < len(diceExpr); {
+		c := diceExpr[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(diceExpr) && diceExpr[i] >= '0' && diceExpr[i] <= '9' {
+				i++
+			}
+			value, err := strconv.Atoi(diceExpr[start:i])
+			if err != nil {
+				return nil, fmt.Errorf("number too large at position %d", start+1)
 			}
-			parseResults = append(parseResults, pr)
-			components = components[1:] //consume the constant we just parsed, []string now len = 0
-			continue
+			tokens = append(tokens, token{kind: tokNumber, text: diceExpr[start:i], value: value, pos: start + 1})
+		case strings.IndexByte("d%Fkhlr!+-*/()", c) >= 0:
+			tokens = append(tokens, token{kind: tokSymbol, text: string(c), pos: i + 1})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character '%c' at position %d", c, i+1)
+		}
+	}
+	return append(tokens, token{kind: tokEnd, pos: len(diceExpr) + 1}), nil
+}
+
+//a recursive descent parser. The first error found stops the parse
+type parser struct {
+	tokens []token
+	pos    int
+	depth  int
+	err    error
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEnd {
+		p.pos++
+	}
+	return t
+}
+
+//consumes the next token if it is the given symbol
+func (p *parser) accept(symbol string) bool {
+	if t := p.peek(); t.kind == tokSymbol && t.text == symbol {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) fail(format string, args ...interface{}) {
+	if p.err == nil {
+		p.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (p *parser) parseExpr() Expr {
+	left := p.parseTerm()
+	for p.err == nil {
+		t := p.peek()
+		if !p.accept("+") && !p.accept("-") {
+			return left
 		}
+		left = &BinaryOp{Op: t.text, Left: left, Right: p.parseTerm()}
+	}
+	return nil
+}
+
+func (p *parser) parseTerm() Expr {
+	left := p.parseUnary()
+	for p.err == nil {
+		t := p.peek()
+		if !p.accept("*") && !p.accept("/") {
+			return left
+		}
+		left = &BinaryOp{Op: t.text, Left: left, Right: p.parseUnary()}
+	}
+	return nil
+}
+
+func (p *parser) parseUnary() Expr {
+	if p.depth++; p.depth > maxNesting {
+		p.fail("nested too deeply")
+		return nil
+	}
+	defer func() { p.depth-- }()
+
+	if p.accept("-") {
+		return &Negation{Operand: p.parseUnary()}
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() Expr {
+	t := p.peek()
+	switch {
+	case t.kind == tokNumber:
+		p.next()
+		if next := p.peek(); next.kind == tokSymbol && next.text == "d" {
+			return p.parseRoll(t)
+		}
+		return &Constant{Value: t.value}
+	case t.kind == tokSymbol && t.text == "d": //implicit count eg d20
+		return p.parseRoll(token{kind: tokNumber, text: "1", value: 1, pos: t.pos})
+	case p.accept("("):
+		inner := p.parseExpr()
+		if p.err == nil && !p.accept(")") {
+			p.fail("expected ')' but found %s", p.peek())
+		}
+		return &Group{Inner: inner}
+	}
+	p.fail("expected a number, roll or '(' but found %s", t)
+	return nil
+}
 
-		//we are expecting an xdy pattern at this point or we fail to validate
-		if matches := xdyPattern.FindStringSubmatch(components[0]); matches != nil {
-			count, _ := strconv.Atoi(matches[1])   //no err here as regex protects
-			dieType, _ := strconv.Atoi(matches[2]) //no err here as regex protects
-			pr := &ParseResult{
-				Count:   count,
-				DieType: dieType,
+//parses a roll from its d onwards, count is the number of dice
+func (p *parser) parseRoll(count token) Expr {
+	p.next() //the d
+	r := &Roll{Count: count.value}
+	if r.Count < 1 || r.Count > maxDiceCount {
+		p.fail("dice count must be from 1 to %d at position %d", maxDiceCount, count.pos)
+		return nil
+	}
+
+	//the die type
+	sides := p.next()
+	switch {
+	case sides.kind == tokNumber:
+		r.Sides = sides.value
+		if r.Sides < 1 || r.Sides > maxSides {
+			p.fail("dice must have from 1 to %d sides at position %d", maxSides, sides.pos)
+			return nil
+		}
+	case sides.text == "%":
+		r.Sides = 100
+		r.Percent = true
+	case sides.text == "F":
+		r.Sides = 3
+		r.Fudge = true
+	default:
+		p.fail("expected die sides, %% or F but found %s", sides)
+		return nil
+	}
+
+	//modifiers, in any order
+	for p.err == nil {
+		t := p.peek()
+		switch {
+		case p.accept("r"):
+			p.parseReroll(r, t)
+		case p.accept("!"):
+			p.parseExplode(r, t)
+		case p.accept("k"):
+			switch {
+			case p.accept("h"):
+				p.parseSelect(r, SelectKeepHighest, t)
+			case p.accept("l"):
+				p.parseSelect(r, SelectKeepLowest, t)
+			default:
+				p.parseSelect(r, SelectKeepHighest, t)
 			}
-			if len(components) > 1 {
-				switch components[1] {
-				case "+", "-", "*":
-					pr.Operator = components[1]
-					components = components[2:] //consume the die we just parsed and follow-on operator
-				default:
-					vr.Fail(section, fmt.Sprintf("Invalid die operator: %s in %s", components[1], diceExpr))
-					return nil
-				}
-			} else {
-				pr.Operator = "none"
-				components = components[1:] //consume the die we just parsed, []string now len = 0
+		case p.accept("d"):
+			switch {
+			case p.accept("h"):
+				p.parseSelect(r, SelectDropHighest, t)
+			case p.accept("l"):
+				p.parseSelect(r, SelectDropLowest, t)
+			default:
+				p.fail("expected dh or dl at position %d", t.pos)
 			}
-			parseResults = append(parseResults, pr)
-		} else {
-			vr.Fail(section, fmt.Sprintf("Invalid dice expression: %s", diceExpr))
-			return nil
+		default:
+			return r
 		}
 	}
+	return nil
+}
+
+func (p *parser) parseReroll(r *Roll, at token) {
+	face := p.next()
+	switch {
+	case r.Fudge:
+		p.fail("fudge dice can not be rerolled at position %d", at.pos)
+	case face.kind != tokNumber:
+		p.fail("expected a face to reroll but found %s", face)
+	case face.value < 1 || face.value > r.Sides:
+		p.fail("reroll of %d is not a face of the die at position %d", face.value, face.pos)
+	case r.rerolls(face.value):
+		p.fail("reroll of %d given twice at position %d", face.value, face.pos)
+	case len(r.Reroll)+1 >= r.Sides:
+		p.fail("every face of the die would be rerolled at position %d", face.pos)
+	default:
+		r.Reroll = append(r.Reroll, face.value)
+	}
+}
 
-	return parseResults
+func (p *parser) parseExplode(r *Roll, at token) {
+	switch {
+	case r.Explode:
+		p.fail("dice can only explode once at position %d", at.pos)
+	case r.Fudge || r.Sides < 2:
+		p.fail("only dice with two or more numbered sides can explode at position %d", at.pos)
+	default:
+		r.Explode = true
+	}
+}
+
+func (p *parser) parseSelect(r *Roll, sel string, at token) {
+	n := p.next()
+	switch {
+	case r.Select != "":
+		p.fail("only one keep or drop is allowed at position %d", at.pos)
+	case n.kind != tokNumber:
+		p.fail("expected the number of dice to keep or drop but found %s", n)
+	case (sel == SelectKeepHighest || sel == SelectKeepLowest) && (n.value < 1 || n.value > r.Count):
+		p.fail("can only keep from 1 to %d dice at position %d", r.Count, n.pos)
+	case (sel == SelectDropHighest || sel == SelectDropLowest) && (n.value < 1 || n.value >= r.Count):
+		p.fail("can only drop from 1 to %d dice at position %d", r.Count-1, n.pos)
+	default:
+		r.Select = sel
+		r.SelectN = n.value
+	}
 }
@@ -8,7 +8,10 @@ import (
 func TestValidateDiceExpr_shouldAcceptValidDice(t *testing.T) {
 
 	var ids = []string{"1d8", "3d6", "4d2001", "3d6 + 4d8", "1d6 - 7d3",
-		"1d6 + 2", "3d6 * 100", "1d4 * 2d6 + 3"}
+		"1d6 + 2", "3d6 * 100", "1d4 * 2d6 + 3", "3d6 / 4d8", "d6", "3d6 + 3 + 2d8",
+		"2 + 1d6", "1d6+8", "2d6 + 1 * 2", "4d6kh3", "4d6k3", "2d20kl1", "4d6dl1",
+		"4d6dh1", "d6!", "2d6r1", "2d6r1r2", "4dF", "d%", "(1d4 + 1) * 10 / 3",
+		"-1d4", "-(2d6 - 3)", "3d6!r1kh2", "5", "1d1"}
 
 	for _, id := range ids {
 		vr := validate.NewValidationResult()
@@ -21,8 +24,11 @@ func TestValidateDiceExpr_shouldAcceptValidDice(t *testing.T) {
 
 func TestValidateDiceExpr_shouldRejectInvalidDice(t *testing.T) {
 
-	var ids = []string{"", "0d6", "1d0", "3d6 / 4d8", "d6", "7d", "3d6 +",
-		"3d6 2d6", "3d6 + 3 + 2d8", "2 + 1d6", "1d6+8", "3d0 + 3", "2d6 + 1 * 2"}
+	var ids = []string{"", "0d6", "1d0", "7d", "3d6 +", "3d6 2d6", "3d0 + 3",
+		"1d6 x 2", "(1d6", "1d6)", "()", "4d6kh5", "4d6kl0", "4d6dl4", "4d6kh3kl1",
+		"4d6k", "1d1!", "4dF!", "4dFr1", "1d6r7", "1d2r1r2", "2d6r1r1", "d6!!",
+		"4d6d1", "1001d6", "99999999999999999999d6", "1D6", "2d", "d", "+1d6",
+		"1d1000001", "1d99999999999"}
 
 	for _, id := range ids {
 		vr := validate.NewValidationResult()
@@ -33,65 +39,97 @@ func TestValidateDiceExpr_shouldRejectInvalidDice(t *testing.T) {
 	}
 }
 
+func TestValidateDiceExpr_shouldExplainInvalidDice(t *testing.T) {
+	vr := validate.NewValidationResult()
+	ValidateDiceExpr("2d6 + x", "testval", vr)
+	if len(vr.Errors) != 1 ||
+		vr.Errors[0] != "ERROR: testval - Invalid dice expression: 2d6 + x - unexpected character 'x' at position 7" {
+		t.Errorf("Unexpected errors: %v", vr.Errors)
+	}
+
+	vr = validate.NewValidationResult()
+	ValidateDiceExpr("(2d6 + 1", "testval", vr)
+	if len(vr.Errors) != 1 ||
+		vr.Errors[0] != "ERROR: testval - Invalid dice expression: (2d6 + 1 - expected ')' but found end of expression" {
+		t.Errorf("Unexpected errors: %v", vr.Errors)
+	}
+}
+
 func TestValidateDiceExpr_shouldParseDiceExpr1(t *testing.T) {
 	vr := validate.NewValidationResult()
 	pde := ValidateDiceExpr("4d6", "testval", vr)
 
-	if len(pde) != 1 {
-		t.Error("Bad parse length")
+	roll, ok := pde.(*Roll)
+	if !ok {
+		t.Fatalf("Bad parse: %v", pde)
 	}
-	if pde[0].Count != 4 {
+	if roll.Count != 4 {
 		t.Error("Bad count")
 	}
-	if pde[0].DieType != 6 {
+	if roll.Sides != 6 {
 		t.Error("Bad die type")
 	}
-	if pde[0].Operator != "none" {
-		t.Error("Bad operator")
-	}
 }
 
 func TestValidateDiceExpr_shouldParseDiceExpr2(t *testing.T) {
 	vr := validate.NewValidationResult()
 	pde := ValidateDiceExpr("4d6 + 3d7 - 1d3 * 21", "testval", vr)
 
-	if len(pde) != 4 {
-		t.Error("Bad parse length")
+	//* binds tighter than + and -, which are applied left to right
+	sub, ok := pde.(*BinaryOp)
+	if !ok || sub.Op != "-" {
+		t.Fatalf("Bad parse: %v", pde)
 	}
-	if pde[0].Count != 4 {
-		t.Error("Bad count")
+	add, ok := sub.Left.(*BinaryOp)
+	if !ok || add.Op != "+" {
+		t.Fatalf("Bad parse: %v", sub.Left)
 	}
-	if pde[0].DieType != 6 {
-		t.Error("Bad die type")
+	if roll, ok := add.Left.(*Roll); !ok || roll.Count != 4 || roll.Sides != 6 {
+		t.Errorf("Bad parse: %v", add.Left)
 	}
-	if pde[0].Operator != "+" {
-		t.Error("Bad operator")
+	if roll, ok := add.Right.(*Roll); !ok || roll.Count != 3 || roll.Sides != 7 {
+		t.Errorf("Bad parse: %v", add.Right)
 	}
-	if pde[1].Count != 3 {
-		t.Error("Bad count")
+	mul, ok := sub.Right.(*BinaryOp)
+	if !ok || mul.Op != "*" {
+		t.Fatalf("Bad parse: %v", sub.Right)
 	}
-	if pde[1].DieType != 7 {
-		t.Error("Bad die type")
+	if roll, ok := mul.Left.(*Roll); !ok || roll.Count != 1 || roll.Sides != 3 {
+		t.Errorf("Bad parse: %v", mul.Left)
 	}
-	if pde[1].Operator != "-" {
-		t.Error("Bad operator")
+	if c, ok := mul.Right.(*Constant); !ok || c.Value != 21 {
+		t.Errorf("Bad parse: %v", mul.Right)
 	}
-	if pde[2].Count != 1 {
-		t.Error("Bad count")
-	}
-	if pde[2].DieType != 3 {
-		t.Error("Bad die type")
-	}
-	if pde[2].Operator != "*" {
-		t.Error("Bad operator")
-	}
-	if pde[3].Count != 21 {
-		t.Error("Bad count")
-	}
-	if pde[3].DieType != 0 {
-		t.Error("Bad die type")
+}
+
+func TestValidateDiceExpr_shouldParseModifiers(t *testing.T) {
+	for expr, want := range map[string]*Roll{
+		"4d6kh3":  {Count: 4, Sides: 6, Select: SelectKeepHighest, SelectN: 3},
+		"4d6k3":   {Count: 4, Sides: 6, Select: SelectKeepHighest, SelectN: 3},
+		"2d20kl1": {Count: 2, Sides: 20, Select: SelectKeepLowest, SelectN: 1},
+		"4d6dl1":  {Count: 4, Sides: 6, Select: SelectDropLowest, SelectN: 1},
+		"d20":     {Count: 1, Sides: 20},
+		"d6!":     {Count: 1, Sides: 6, Explode: true},
+		"2d6r1":   {Count: 2, Sides: 6, Reroll: []int{1}},
+		"4dF":     {Count: 4, Sides: 3, Fudge: true},
+		"d%":      {Count: 1, Sides: 100, Percent: true},
+	} {
+		vr := validate.NewValidationResult()
+		roll, ok := ValidateDiceExpr(expr, "testval", vr).(*Roll)
+		if !ok {
+			t.Errorf("%s: bad parse: %v", expr, vr.Errors)
+			continue
+		}
+		if roll.String() != want.String() || roll.Explode != want.Explode || roll.Fudge != want.Fudge {
+			t.Errorf("%s: parsed as %s", expr, roll)
+		}
 	}
-	if pde[3].Operator != "none" {
-		t.Error("Bad operator")
+}
+
+func TestValidateDiceExpr_shouldKeepParentheses(t *testing.T) {
+	vr := validate.NewValidationResult()
+	pde := ValidateDiceExpr("(1d4+1)*-2", "testval", vr)
+	if pde == nil || pde.String() != "(1d4 + 1) * -2" {
+		t.Errorf("Bad parse: %v %v", pde, vr.Errors)
 	}
 }
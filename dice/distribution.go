@@ -0,0 +1,270 @@
+package dice
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+//Distribution is the probability mass function of a dice expression, the
+//probability of each value it can produce. Values it can not produce are
+//absent. Probabilities are computed, not sampled, but are held as float64 so
+//are subject to rounding
+type Distribution map[int]float64
+
+//maxAnalysisWork bounds the number of steps Analyze may take so that huge
+//expressions eg 1000d1000 * 1000d1000 fail rather than run for ever
+const maxAnalysisWork = 20000000
+
+//Analyze computes the exact distribution of a dice expression. Dice that reroll
+//are treated as rerolling until an acceptable face comes up and dice that
+//explode as exploding at most as many times as Eval allows. An error is
+//returned if the expression is too complex to analyse
+func Analyze(e Expr) (Distribution, error) {
+	a := &analyzer{}
+	dist := a.analyze(e)
+	if a.err != nil {
+		return nil, a.err
+	}
+	return dist, nil
+}
+
+//Values returns the values the expression can produce, lowest first
+func (d Distribution) Values() []int {
+	values := make([]int, 0, len(d))
+	for v := range d {
+		values = append(values, v)
+	}
+	sort.Ints(values)
+	return values
+}
+
+//Min returns the lowest value the expression can produce
+func (d Distribution) Min() int {
+	return d.Values()[0]
+}
+
+//Max returns the highest value the expression can produce
+func (d Distribution) Max() int {
+	values := d.Values()
+	return values[len(values)-1]
+}
+
+//Probability returns the probability of a value from low to high inclusive
+func (d Distribution) Probability(low, high int) float64 {
+	p := 0.0
+	for v, pv := range d {
+		if v >= low && v <= high {
+			p += pv
+		}
+	}
+	return p
+}
+
+//Mean returns the expected value
+func (d Distribution) Mean() float64 {
+	mean := 0.0
+	for v, pv := range d {
+		mean += float64(v) * pv
+	}
+	return mean
+}
+
+type analyzer struct {
+	work int
+	err  error
+}
+
+//counts work done, failing once there has been too much
+func (a *analyzer) spend(n int) bool {
+	a.work += n
+	if a.work > maxAnalysisWork && a.err == nil {
+		a.err = fmt.Errorf("Dice expression is too complex to analyse")
+	}
+	return a.err == nil
+}
+
+func (a *analyzer) analyze(e Expr) Distribution {
+	if a.err != nil {
+		return nil
+	}
+	switch n := e.(type) {
+	case *Constant:
+		return Distribution{n.Value: 1}
+	case *Roll:
+		return a.roll(n)
+	case *BinaryOp:
+		left := a.analyze(n.Left)
+		right := a.analyze(n.Right)
+		if a.err != nil || !a.spend(len(left)*len(right)) {
+			return nil
+		}
+		dist := make(Distribution)
+		for lv, lp := range left {
+			for rv, rp := range right {
+				dist[Apply(n.Op, lv, rv)] += lp * rp
+			}
+		}
+		return dist
+	case *Negation:
+		operand := a.analyze(n.Operand)
+		dist := make(Distribution, len(operand))
+		for v, p := range operand {
+			dist[-v] = p
+		}
+		return dist
+	case *Group:
+		return a.analyze(n.Inner)
+	}
+	a.err = fmt.Errorf("Unable to analyse dice expression: %s", e)
+	return nil
+}
+
+//the distribution of a roll: the sum of its dice, or of those it keeps
+func (a *analyzer) roll(r *Roll) Distribution {
+	die := a.die(r)
+	if a.err != nil {
+		return nil
+	}
+	switch r.Select {
+	case SelectKeepHighest:
+		return a.keep(die, r.Count, r.SelectN, true)
+	case SelectKeepLowest:
+		return a.keep(die, r.Count, r.SelectN, false)
+	case SelectDropHighest:
+		return a.keep(die, r.Count, r.Count-r.SelectN, false)
+	case SelectDropLowest:
+		return a.keep(die, r.Count, r.Count-r.SelectN, true)
+	}
+
+	//no selection, convolve the dice together
+	dist := Distribution{0: 1}
+	for i := 0; i < r.Count; i++ {
+		if !a.spend(len(dist) * len(die)) {
+			return nil
+		}
+		next := make(Distribution, len(dist)+len(die))
+		for sv, sp := range dist {
+			for dv, dp := range die {
+				next[sv+dv] += sp * dp
+			}
+		}
+		dist = next
+	}
+	return dist
+}
+
+//the distribution of a single die of a roll, including rerolls and explosions
+func (a *analyzer) die(r *Roll) Distribution {
+	if !a.spend(r.Sides) {
+		return nil
+	}
+	faces := make([]int, 0, r.Sides)
+	for f := 1; f <= r.Sides; f++ {
+		face := f
+		if r.Fudge {
+			face = f - 2
+		}
+		if !r.rerolls(face) {
+			faces = append(faces, face)
+		}
+	}
+	pFace := 1.0 / float64(len(faces)) //rerolled faces never stand
+	die := make(Distribution, len(faces))
+	if !r.Explode {
+		for _, f := range faces {
+			die[f] = pFace
+		}
+		return die
+	}
+
+	//each explosion adds another die. The last permitted explosion stands
+	//whatever it shows
+	if !a.spend(len(faces) * (maxExplosions + 1)) {
+		return nil
+	}
+	pChain := 1.0 //probability of reaching this many explosions
+	for n := 0; n <= maxExplosions; n++ {
+		base := n * r.Sides
+		for _, f := range faces {
+			if f != r.Sides || n == maxExplosions {
+				die[base+f] += pChain * pFace
+			}
+		}
+		if r.rerolls(r.Sides) { //the highest face never stands so never explodes
+			break
+		}
+		pChain *= pFace
+		if pChain == 0 { //too unlikely to represent
+			break
+		}
+	}
+	return die
+}
+
+//the distribution of the sum of the highest (or lowest) k of n dice. Face values
+//are visited from the best down; at each one the number of the remaining dice
+//showing it is binomial given that none showed a better value
+func (a *analyzer) keep(die Distribution, n, k int, highest bool) Distribution {
+	values := die.Values()
+	if highest {
+		for i, j := 0, len(values)-1; i < j; i, j = i+1, j-1 {
+			values[i], values[j] = values[j], values[i]
+		}
+	}
+
+	//states are keyed by dice still to place and dice kept so far
+	type state struct{ remaining, kept int }
+	states := map[state]Distribution{{n, 0}: {0: 1}}
+	pLeft := 1.0 //probability that a die shows this value or worse
+	for i, v := range values {
+		q := die[v] / pLeft
+		if q > 1 || i == len(values)-1 { //the worst value takes every die left
+			q = 1
+		}
+		next := make(map[state]Distribution)
+		for s, sums := range states {
+			if !a.spend(len(sums) * (s.remaining + 1)) {
+				return nil
+			}
+			for j := 0; j <= s.remaining; j++ {
+				pj := binomial(s.remaining, j) * math.Pow(q, float64(j)) * math.Pow(1-q, float64(s.remaining-j))
+				if pj == 0 {
+					continue
+				}
+				kept := s.kept + j
+				if kept > k {
+					kept = k
+				}
+				ns := state{s.remaining - j, kept}
+				if next[ns] == nil {
+					next[ns] = make(Distribution)
+				}
+				for sum, p := range sums {
+					next[ns][sum+v*(kept-s.kept)] += p * pj
+				}
+			}
+		}
+		states = next
+		pLeft -= die[v]
+	}
+
+	dist := make(Distribution)
+	for s, sums := range states {
+		if s.remaining == 0 {
+			for sum, p := range sums {
+				dist[sum] += p
+			}
+		}
+	}
+	return dist
+}
+
+//n choose k
+func binomial(n, k int) float64 {
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result *= float64(n-k+i) / float64(i)
+	}
+	return result
+}
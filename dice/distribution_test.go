@@ -0,0 +1,135 @@
+package dice
+
+import (
+	"math"
+	"testing"
+)
+
+func analyze(expr string, t *testing.T) Distribution {
+	t.Helper()
+	e, err := Parse(expr)
+	if err != nil {
+		t.Fatalf("Unable to parse: %v", err)
+	}
+	dist, err := Analyze(e)
+	if err != nil {
+		t.Fatalf("Unable to analyse: %v", err)
+	}
+	return dist
+}
+
+func near(have, want float64) bool {
+	return math.Abs(have-want) < 1e-9
+}
+
+//computes a distribution by evaluating every possible sequence of faces
+func enumerate(expr string, dice, sides int, t *testing.T) Distribution {
+	t.Helper()
+	e, err := Parse(expr)
+	if err != nil {
+		t.Fatalf("Unable to parse: %v", err)
+	}
+	dist := make(Distribution)
+	total := int(math.Pow(float64(sides), float64(dice)))
+	for i := 0; i < total; i++ {
+		faces := make([]int, dice)
+		for d, n := 0, i; d < dice; d, n = d+1, n/sides {
+			faces[d] = n%sides + 1
+		}
+		dist[e.Eval(&scriptedSource{faces: faces})] += 1 / float64(total)
+	}
+	return dist
+}
+
+func TestAnalyze_shouldComputeSimpleDistributions(t *testing.T) {
+	dist := analyze("2d6", t)
+	if len(dist) != 11 || dist.Min() != 2 || dist.Max() != 12 {
+		t.Fatalf("Unexpected values: %v", dist.Values())
+	}
+	if !near(dist[7], 6.0/36) || !near(dist[2], 1.0/36) || !near(dist.Mean(), 7) {
+		t.Errorf("Unexpected probabilities: %v", dist)
+	}
+	if !near(dist.Probability(2, 12), 1) || !near(dist.Probability(10, 20), 6.0/36) {
+		t.Errorf("Unexpected range probability")
+	}
+
+	dist = analyze("1d6 * 2 - 1", t)
+	if len(dist) != 6 || !near(dist[11], 1.0/6) {
+		t.Errorf("Unexpected distribution: %v", dist)
+	}
+	dist = analyze("4dF", t)
+	if dist.Min() != -4 || dist.Max() != 4 || !near(dist[0], 19.0/81) {
+		t.Errorf("Unexpected distribution: %v", dist)
+	}
+	dist = analyze("d%", t)
+	if len(dist) != 100 || !near(dist[100], 0.01) {
+		t.Errorf("Unexpected distribution: %v", dist)
+	}
+	dist = analyze("-(d4) / 2", t)
+	if len(dist) != 2 || !near(dist[-1], 0.5) || !near(dist[-2], 0.5) {
+		t.Errorf("Unexpected distribution: %v", dist)
+	}
+}
+
+func TestAnalyze_shouldMatchEnumeration(t *testing.T) {
+	for _, tc := range []struct {
+		expr        string
+		dice, sides int
+	}{
+		{"4d6kh3", 4, 6}, {"3d4kl2", 3, 4}, {"4d6dh1", 4, 6}, {"4d6dl2", 4, 6},
+		{"2d20kl1", 2, 20}, {"3d6 + 1d6 * 2", 4, 6}, {"(2d4 + 1) / 1d4", 3, 4},
+	} {
+		want := enumerate(tc.expr, tc.dice, tc.sides, t)
+		have := analyze(tc.expr, t)
+		if len(have) != len(want) {
+			t.Errorf("%s: unexpected values: %v", tc.expr, have.Values())
+			continue
+		}
+		for v, p := range want {
+			if !near(have[v], p) {
+				t.Errorf("%s: P(%d) is %f want %f", tc.expr, v, have[v], p)
+			}
+		}
+	}
+
+	//a well known result
+	if dist := analyze("4d6kh3", t); !near(dist[18], 21.0/1296) {
+		t.Errorf("Unexpected probability of 18: %f", dist[18])
+	}
+}
+
+func TestAnalyze_shouldHandleRerollsAndExplosions(t *testing.T) {
+	dist := analyze("2d6r1", t)
+	if dist.Min() != 4 || !near(dist[4], 1.0/25) {
+		t.Errorf("Unexpected distribution: %v", dist)
+	}
+
+	dist = analyze("d6!", t)
+	if _, found := dist[6]; found {
+		t.Error("A six always explodes")
+	}
+	if !near(dist[1], 1.0/6) || !near(dist[7], 1.0/36) || !near(dist[13], 1.0/216) {
+		t.Errorf("Unexpected distribution: %v", dist)
+	}
+	if !near(dist.Probability(dist.Min(), dist.Max()), 1) || !near(dist.Mean(), 4.2) {
+		t.Errorf("Distribution does not sum to 1: %f mean %f", dist.Probability(dist.Min(), dist.Max()), dist.Mean())
+	}
+
+	//a die that never shows its highest face never explodes
+	dist = analyze("d6r6!", t)
+	if len(dist) != 5 || dist.Max() != 5 {
+		t.Errorf("Unexpected distribution: %v", dist)
+	}
+}
+
+func TestAnalyze_shouldRefuseHugeExpressions(t *testing.T) {
+	e, _ := Parse("1000d1000 * 1000d1000")
+	if _, err := Analyze(e); err == nil {
+		t.Error("Expected an error")
+	}
+
+	//a die with too many faces to list
+	if _, err := Analyze(&Roll{Count: 1, Sides: maxAnalysisWork + 1}); err == nil {
+		t.Error("Expected an error")
+	}
+}
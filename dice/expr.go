@@ -0,0 +1,291 @@
+package dice
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//Source supplies the random numbers used to roll dice. Intn returns a value
+//from 0 to n-1
+type Source interface {
+	Intn(n int) int
+}
+
+//Expr is a node of a parsed dice expression. The root node represents the
+//entire expression
+type Expr interface {
+	//Eval rolls any dice in the expression and returns its value
+	Eval(rnd Source) int
+
+	//Explain rolls any dice in the expression and describes how its value was
+	//reached. See Breakdown
+	Explain(rnd Source) *Breakdown
+
+	//String returns the expression in its canonical form
+	String() string
+}
+
+//Constant is a plain number eg the 3 in 2d6 + 3
+type Constant struct {
+	Value int
+}
+
+//Roll is a roll of one or more identical dice and the modifiers applied to them
+//eg 4d6kh3
+type Roll struct {
+	Count   int   //number of dice rolled
+	Sides   int   //faces are numbered from 1 to Sides. Fudge dice have 3
+	Fudge   bool  //faces are -1, 0 and 1
+	Percent bool  //written as d%, a d100
+	Explode bool  //a die showing its highest face is rolled again and added to it
+	Reroll  []int //faces that are rerolled until some other face comes up
+
+	//Select is one of the Select* constants, or empty to total all dice. SelectN
+	//is the number of dice kept or dropped
+	Select  string
+	SelectN int
+}
+
+//BinaryOp applies an arithmetic operator to two sub expressions. Division
+//rounds down and division by zero is zero
+type BinaryOp struct {
+	Op    string //one of + - * /
+	Left  Expr
+	Right Expr
+}
+
+//Negation is a sub expression preceded by a unary minus eg -(1d4)
+type Negation struct {
+	Operand Expr
+}
+
+//Group is a parenthesised sub expression. It is kept in the tree so the
+//expression can be written out as it was given
+type Group struct {
+	Inner Expr
+}
+
+const (
+	//SelectKeepHighest keeps the highest SelectN dice eg 4d6kh3
+	SelectKeepHighest = "kh"
+
+	//SelectKeepLowest keeps the lowest SelectN dice eg 2d20kl1
+	SelectKeepLowest = "kl"
+
+	//SelectDropHighest drops the highest SelectN dice eg 4d6dh1
+	SelectDropHighest = "dh"
+
+	//SelectDropLowest drops the lowest SelectN dice eg 4d6dl1
+	SelectDropLowest = "dl"
+
+	//maxRerolls and maxExplosions stop a single die from being rolled forever
+	maxRerolls    = 100
+	maxExplosions = 100
+)
+
+//Eval returns the constant
+func (c *Constant) Eval(rnd Source) int {
+	return c.Value
+}
+
+func (c *Constant) String() string {
+	return strconv.Itoa(c.Value)
+}
+
+//Eval rolls the dice, applies the modifiers and totals the dice kept
+func (r *Roll) Eval(rnd Source) int {
+	return total(r.RollDice(rnd))
+}
+
+//RollDice rolls each of the dice, applying rerolls and explosions, and marks
+//those dice that survive the roll's keep or drop modifier as kept
+func (r *Roll) RollDice(rnd Source) []*Die {
+	dice := make([]*Die, 0, r.Count)
+	for i := 0; i < r.Count; i++ {
+		die := &Die{Kept: true}
+		last := r.rollOne(rnd, die)
+		if r.Explode {
+			for n := 0; last == r.Sides && n < maxExplosions; n++ {
+				die.Exploded = true
+				last = r.rollOne(rnd, die)
+			}
+		}
+		dice = append(dice, die)
+	}
+	r.markKept(dice)
+	return dice
+}
+
+//applies the keep or drop modifier
+func (r *Roll) markKept(dice []*Die) {
+	if r.Select == "" {
+		return
+	}
+
+	//rank the dice, lowest value first
+	order := make([]*Die, len(dice))
+	copy(order, dice)
+	sort.SliceStable(order, func(i, j int) bool {
+		return order[i].Value < order[j].Value
+	})
+	var from, to int //the range of ranks kept
+	switch r.Select {
+	case SelectKeepHighest:
+		from, to = len(dice)-r.SelectN, len(dice)
+	case SelectKeepLowest:
+		from, to = 0, r.SelectN
+	case SelectDropHighest:
+		from, to = 0, len(dice)-r.SelectN
+	case SelectDropLowest:
+		from, to = r.SelectN, len(dice)
+	}
+	for i, die := range order {
+		die.Kept = i >= from && i < to
+	}
+}
+
+//totals the kept dice
+func total(dice []*Die) int {
+	sum := 0
+	for _, die := range dice {
+		if die.Kept {
+			sum += die.Value
+		}
+	}
+	return sum
+}
+
+//rolls a single die, rerolling as needed, and adds the face to the die
+func (r *Roll) rollOne(rnd Source, die *Die) int {
+	value := r.face(rnd)
+	for n := 0; r.rerolls(value) && n < maxRerolls; n++ {
+		die.Rerolled = append(die.Rerolled, value)
+		value = r.face(rnd)
+	}
+	die.Faces = append(die.Faces, value)
+	die.Value += value
+	return value
+}
+
+func (r *Roll) face(rnd Source) int {
+	if r.Fudge {
+		return rnd.Intn(3) - 1
+	}
+	return rnd.Intn(r.Sides) + 1
+}
+
+func (r *Roll) rerolls(value int) bool {
+	for _, rr := range r.Reroll {
+		if rr == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Roll) String() string {
+	var sb strings.Builder
+	sb.WriteString(strconv.Itoa(r.Count))
+	switch {
+	case r.Fudge:
+		sb.WriteString("dF")
+	case r.Percent:
+		sb.WriteString("d%")
+	default:
+		sb.WriteString(fmt.Sprintf("d%d", r.Sides))
+	}
+	for _, rr := range r.Reroll {
+		sb.WriteString(fmt.Sprintf("r%d", rr))
+	}
+	if r.Explode {
+		sb.WriteString("!")
+	}
+	if r.Select != "" {
+		sb.WriteString(fmt.Sprintf("%s%d", r.Select, r.SelectN))
+	}
+	return sb.String()
+}
+
+//Eval evaluates both sides and applies the operator
+func (b *BinaryOp) Eval(rnd Source) int {
+	return Apply(b.Op, b.Left.Eval(rnd), b.Right.Eval(rnd))
+}
+
+func (b *BinaryOp) String() string {
+	return fmt.Sprintf("%s %s %s", b.Left, b.Op, b.Right)
+}
+
+//Eval negates the operand
+func (n *Negation) Eval(rnd Source) int {
+	return -n.Operand.Eval(rnd)
+}
+
+func (n *Negation) String() string {
+	return "-" + n.Operand.String()
+}
+
+//Eval evaluates the inner expression
+func (g *Group) Eval(rnd Source) int {
+	return g.Inner.Eval(rnd)
+}
+
+func (g *Group) String() string {
+	return "(" + g.Inner.String() + ")"
+}
+
+//Apply applies an arithmetic operator as a BinaryOp does
+func Apply(op string, left, right int) int {
+	switch op {
+	case "+":
+		return left + right
+	case "-":
+		return left - right
+	case "*":
+		return left * right
+	case "/":
+		if right == 0 {
+			return 0
+		}
+		quotient := left / right
+		if (left%right != 0) && ((left < 0) != (right < 0)) {
+			quotient-- //go truncates towards zero, round down instead
+		}
+		return quotient
+	}
+	return 0
+}
+
+//Explodes reports whether any dice in the expression explode
+func Explodes(e Expr) bool {
+	switch n := e.(type) {
+	case *Roll:
+		return n.Explode
+	case *BinaryOp:
+		return Explodes(n.Left) || Explodes(n.Right)
+	case *Negation:
+		return Explodes(n.Operand)
+	case *Group:
+		return Explodes(n.Inner)
+	}
+	return false
+}
+
+//Unexploded returns a copy of the expression in which no dice explode eg
+//1d6! + 2 becomes 1d6 + 2. It rolls as the expression does when no die explodes
+func Unexploded(e Expr) Expr {
+	switch n := e.(type) {
+	case *Roll:
+		r := *n
+		r.Explode = false
+		return &r
+	case *BinaryOp:
+		return &BinaryOp{Op: n.Op, Left: Unexploded(n.Left), Right: Unexploded(n.Right)}
+	case *Negation:
+		return &Negation{Operand: Unexploded(n.Operand)}
+	case *Group:
+		return &Group{Inner: Unexploded(n.Inner)}
+	}
+	return e
+}
@@ -0,0 +1,114 @@
+package dice
+
+import (
+	"testing"
+)
+
+//returns the given faces (1-based) in turn, then the last face forever
+type scriptedSource struct {
+	faces []int
+}
+
+func (ss *scriptedSource) Intn(n int) int {
+	face := ss.faces[0]
+	if len(ss.faces) > 1 {
+		ss.faces = ss.faces[1:]
+	}
+	return face - 1
+}
+
+func evalWith(expr string, t *testing.T, faces ...int) int {
+	t.Helper()
+	e, err := Parse(expr)
+	if err != nil {
+		t.Fatalf("Unable to parse: %v", err)
+	}
+	return e.Eval(&scriptedSource{faces: faces})
+}
+
+func TestEval_shouldApplyPrecedence(t *testing.T) {
+	for expr, want := range map[string]int{
+		"2 + 3 * 4":       14,
+		"(2 + 3) * 4":     20,
+		"10 - 4 - 3":      3,
+		"7 / 2":           3,
+		"-7 / 2":          -4,
+		"7 / -2":          -4,
+		"-6 / 2":          -3,
+		"5 / 0":           0,
+		"1d1 - 1d1 * 2":   -1,
+		"-(1 + 2) * 3":    -9,
+		"100 / 3 / 3":     11,
+		"2 * (3 + (4-1))": 12,
+	} {
+		if got := evalWith(expr, t, 1); got != want {
+			t.Errorf("%s: got %d want %d", expr, got, want)
+		}
+	}
+}
+
+func TestEval_shouldKeepAndDrop(t *testing.T) {
+	faces := []int{3, 6, 1, 4}
+	for expr, want := range map[string]int{
+		"4d6":     14,
+		"4d6kh3":  13,
+		"4d6k1":   6,
+		"4d6kl2":  4,
+		"4d6dl1":  13,
+		"4d6dh2":  4,
+		"4d6kh4":  14,
+		"2d20kl1": 3,
+	} {
+		if got := evalWith(expr, t, faces...); got != want {
+			t.Errorf("%s: got %d want %d", expr, got, want)
+		}
+	}
+}
+
+func TestEval_shouldExplodeRerollAndFudge(t *testing.T) {
+	//6 explodes into 6 then 2
+	if got := evalWith("d6!", t, 6, 6, 2); got != 14 {
+		t.Errorf("Exploding die: got %d", got)
+	}
+	//each 1 is rerolled
+	if got := evalWith("2d6r1", t, 1, 1, 4, 1, 5); got != 9 {
+		t.Errorf("Reroll: got %d", got)
+	}
+	//fudge faces 1, 2 and 3 are -1, 0 and +1
+	if got := evalWith("4dF", t, 1, 2, 3, 3); got != 1 {
+		t.Errorf("Fudge: got %d", got)
+	}
+	if got := evalWith("d%", t, 100); got != 100 {
+		t.Errorf("Percentile: got %d", got)
+	}
+	//explosions and rerolls end even if the dice never cooperate
+	if got := evalWith("d6!", t, 6); got != 6*(maxExplosions+1) {
+		t.Errorf("Explosions not capped: got %d", got)
+	}
+	if got := evalWith("d6r1", t, 1); got != 1 {
+		t.Errorf("Rerolls not capped: got %d", got)
+	}
+}
+
+func TestEval_shouldRespectRangeOfDice(t *testing.T) {
+	e, err := Parse("3d6kh2 + 4dF")
+	if err != nil {
+		t.Fatalf("Unable to parse: %v", err)
+	}
+	rnd := &countingSource{}
+	for i := 0; i < 1000; i++ {
+		if v := e.Eval(rnd); v < -2 || v > 16 {
+			t.Fatalf("Unexpected value: %d", v)
+		}
+	}
+}
+
+//cycles through every face of every die
+type countingSource struct {
+	n int
+}
+
+func (cs *countingSource) Intn(n int) int {
+	cs.n++
+	return cs.n % n
+}
@@ -0,0 +1,79 @@
+package tablib
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	//ErrTableNotFound is matched by errors about a table that does not exist
+	ErrTableNotFound = errors.New("table not found")
+
+	//ErrScriptNotFound is matched by errors about a script that does not exist
+	ErrScriptNotFound = errors.New("script not found")
+
+	//ErrPickOnRange is matched by errors about a pick on a range table, which
+	//is not allowed
+	ErrPickOnRange = errors.New("Pick on range table not allowed")
+
+	//ErrRollOutOfRange is matched by errors about a roll on a range table that
+	//no range handles
+	ErrRollOutOfRange = errors.New("roll exceeded the ranges of the table")
+
+	//ErrCallDepth is matched by the LimitError reported when tables refer to
+	//other tables too deeply, usually because they recurse without end
+	ErrCallDepth = errors.New("max call depth exceeded")
+
+	//ErrTableExists is returned by AddTable under CollisionError when a table of the
+	//same name is already in the repository
+	ErrTableExists = errors.New("table already exists")
+)
+
+//NotFoundError is the error returned when a named table or script does not
+//exist. It matches ErrTableNotFound or ErrScriptNotFound
+type NotFoundError struct {
+	ItemType string //"table" or "script"
+	Name     string
+}
+
+func newNotFoundError(itemType, name string) *NotFoundError {
+	return &NotFoundError{
+		ItemType: itemType,
+		Name:     name,
+	}
+}
+
+func (nf *NotFoundError) Error() string {
+	if nf.ItemType == itemTypeScript {
+		return fmt.Sprintf("Script: %s does not exist", nf.Name)
+	}
+	return fmt.Sprintf("Table: %s does not exist", nf.Name)
+}
+
+func (nf *NotFoundError) Unwrap() error {
+	if nf.ItemType == itemTypeScript {
+		return ErrScriptNotFound
+	}
+	return ErrTableNotFound
+}
+
+//ExecutionError describes a problem met while expanding a table that did not
+//halt execution, such as a reference to a missing table. The result holds a
+//marker where the problem occurred eg --BADREF: {@Foo}--. See TableResult.Errors
+type ExecutionError struct {
+	Table     string //the table being expanded
+	Row       int    //the content row of Table being expanded, -1 if not known
+	Reference string //the table reference that could not be expanded, if any
+	Err       error
+}
+
+func (ee *ExecutionError) Error() string {
+	if ee.Reference != "" {
+		return fmt.Sprintf("Table: %s reference: %s - %v", ee.Table, ee.Reference, ee.Err)
+	}
+	return fmt.Sprintf("Table: %s - %v", ee.Table, ee.Err)
+}
+
+func (ee *ExecutionError) Unwrap() error {
+	return ee.Err
+}
@@ -0,0 +1,113 @@
+package tablib
+
+/*
+These tests focus on the errors callers may test for with errors.Is and errors.As
+*/
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+const (
+	errorsYmlBadRef = `
+  definition:
+    name: BadRef
+    type: flat
+  content:
+    - "to {@Nowhere}"`
+
+	errorsYmlRange = `
+  definition:
+    name: Ranged
+    type: range
+    roll: 1d2
+  content:
+    - "{1-2}item"`
+)
+
+var errorsYmls = []string{errorsYmlBadRef, errorsYmlRange}
+
+func TestErrors_shouldReportMissingItems(t *testing.T) {
+	repo := newTestRepo(t, errorsYmls)
+
+	tr := repo.Roll("Missing", 1)
+	var nf *NotFoundError
+	if len(tr.Errors) != 1 || !errors.As(tr.Errors[0], &nf) || nf.Name != "Missing" || nf.ItemType != itemTypeTable {
+		t.Fatalf("Unexpected errors: %v", tr.Errors)
+	}
+	if !errors.Is(tr.Errors[0], ErrTableNotFound) || errors.Is(tr.Errors[0], ErrScriptNotFound) {
+		t.Errorf("Wrong sentinel: %v", tr.Errors[0])
+	}
+	if tr.Log[0] != "Table: Missing does not exist" {
+		t.Errorf("Unexpected log: %v", tr.Log)
+	}
+
+	for _, err := range []error{
+		repo.Pick("Missing", 1).Errors[0],
+		repo.RemoveTable("Missing", false),
+		func() error { _, err := repo.List("Missing", itemTypeTable); return err }(),
+	} {
+		if !errors.Is(err, ErrTableNotFound) {
+			t.Errorf("Expected a missing table: %v", err)
+		}
+	}
+
+	_, err := repo.ExecuteContext(context.Background(), "Missing", nil)
+	if !errors.Is(err, ErrScriptNotFound) || !errors.Is(repo.RemoveLuaScript("Missing"), ErrScriptNotFound) {
+		t.Errorf("Expected a missing script: %v", err)
+	}
+	if results := repo.Execute("Missing", nil); results["Script-Error"] != "Script: Missing does not exist" {
+		t.Errorf("Unexpected results: %v", results)
+	}
+}
+
+func TestErrors_shouldLocateBadReferences(t *testing.T) {
+	repo := newTestRepo(t, errorsYmls)
+
+	tr := repo.Roll("BadRef", 1)
+	if tr.Result[0] != "to  --BADREF: {@Nowhere}--" || !tr.Completed() {
+		t.Errorf("Unexpected result: %v", tr.Result)
+	}
+	var ee *ExecutionError
+	if len(tr.Errors) != 1 || !errors.As(tr.Errors[0], &ee) {
+		t.Fatalf("Unexpected errors: %v", tr.Errors)
+	}
+	if ee.Table != "BadRef" || ee.Row != 0 || ee.Reference != "{@Nowhere}" || !errors.Is(ee, ErrTableNotFound) {
+		t.Errorf("Unexpected error: %+v", ee)
+	}
+	if ee.Error() != "Table: BadRef reference: {@Nowhere} - Table: Nowhere does not exist" {
+		t.Errorf("Unexpected message: %s", ee.Error())
+	}
+}
+
+func TestErrors_shouldReportPickOnRange(t *testing.T) {
+	repo := newTestRepo(t, errorsYmls)
+
+	tr := repo.Pick("Ranged", 1)
+	if len(tr.Errors) != 1 || !errors.Is(tr.Errors[0], ErrPickOnRange) {
+		t.Fatalf("Unexpected errors: %v", tr.Errors)
+	}
+	var ee *ExecutionError
+	if !errors.As(tr.Errors[0], &ee) || ee.Table != "Ranged" || ee.Row != -1 {
+		t.Errorf("Unexpected error: %+v", ee)
+	}
+}
+
+func TestErrors_shouldReportCallDepth(t *testing.T) {
+	repo := newTestRepo(t, limitsYmls, WithMaxCallDepth(2))
+
+	tr := repo.Roll("Outer", 1)
+	if !errors.Is(tr.Err, ErrCallDepth) {
+		t.Fatalf("Expected call depth error: %v", tr.Err)
+	}
+	if len(tr.Errors) != 1 || tr.Errors[0] != tr.Err {
+		t.Errorf("Halting error not recorded: %v", tr.Errors)
+	}
+
+	tr = newTestRepo(t, limitsYmls, WithMaxRollCount(1)).Roll("Inner", 2)
+	if tr.Err == nil || errors.Is(tr.Err, ErrCallDepth) {
+		t.Errorf("Only the call depth limit is ErrCallDepth: %v", tr.Err)
+	}
+}
@@ -0,0 +1,472 @@
+package tablib
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"tablib/table"
+	"tablib/validate"
+)
+
+//GraphNode is a table or script in a ReferenceGraph
+type GraphNode struct {
+	Name   string
+	Type   string //"table" or "script"
+	Inline bool   //true for inline tables
+	Exists bool   //false for tables that are referenced but are not in the repository
+	Rows   int    //number of content rows, 0 for scripts and missing tables
+}
+
+//GraphEdge is a reference from a table or script to a table
+type GraphEdge struct {
+	From      string
+	FromType  string //"table" or "script"
+	To        string //always a table, unqualified names are resolved as during execution
+	Operation string //"roll" or "pick"
+	Text      string //the reference as written eg {@Foo} or t.roll("Foo")
+	Row       int    //index of the content row holding the reference, -1 for scripts
+	Dangling  bool   //true if the referenced table does not exist
+}
+
+//ReferenceGraph describes how the tables and scripts in a repository refer to
+//one another. Nodes are sorted scripts first and then by name, edges are sorted
+//by the referencing item
+type ReferenceGraph struct {
+	Nodes []*GraphNode
+	Edges []*GraphEdge
+}
+
+const (
+	referencesSection = "References"
+)
+
+var (
+	//finds string literal table names passed to the roll and pick functions of
+	//the tables module eg t.roll("Foo") or tables.pick('Bar', 2). Table names
+	//built at runtime can not be found this way
+	scriptRefPattern = regexp.MustCompile(`\.\s*(roll|pick)\s*\(\s*(?:"([^"]*)"|'([^']*)')`)
+)
+
+func (cr *concreteTableRepo) ReferenceGraph() *ReferenceGraph {
+	cr.lock.RLock()
+	defer cr.lock.RUnlock()
+	return cr.buildReferenceGraph()
+}
+
+func (cr *concreteTableRepo) ValidateReferences() *validate.ValidationResult {
+	cr.lock.RLock()
+	defer cr.lock.RUnlock()
+	graph := cr.buildReferenceGraph()
+	vr := validate.NewValidationResult()
+
+	for _, e := range graph.Dangling() {
+		from := "Table"
+		if e.FromType == itemTypeScript {
+			from = "Script"
+		}
+		d := vr.Fail(referencesSection, fmt.Sprintf("%s: %s refers to missing table: %s via %s",
+			from, e.From, e.To, e.Text)).WithCode(validate.CodeMissingTable).WithRow(e.Row)
+		if e.FromType == itemTypeTable {
+			d.WithTable(e.From).At(cr.tableSource(e.From).Row(e.Row))
+		}
+	}
+
+	//infinite recursion is an error, other cycles are merely worth knowing about
+	infinite := make(map[string]struct{})
+	for _, c := range graph.InfiniteRecursion() {
+		vr.Fail(referencesSection, fmt.Sprintf("Infinite recursion, every row refers back into: %s",
+			strings.Join(c, " -> "))).WithCode(validate.CodeEndlessRecursion).WithTable(c[0]).
+			At(cr.tableSource(c[0]).Start())
+		for _, name := range c {
+			infinite[name] = struct{}{}
+		}
+	}
+	for _, c := range graph.Cycles() {
+		if anyIn(c, infinite) {
+			continue
+		}
+		vr.Warn(referencesSection, fmt.Sprintf("Reference cycle: %s", strings.Join(c, " -> "))).
+			WithCode(validate.CodeReferenceCycle).WithTable(c[0]).At(cr.tableSource(c[0]).Start())
+	}
+	for _, name := range graph.Unreachable() {
+		vr.Warn(referencesSection, fmt.Sprintf("Table: %s is not referenced by any table or script", name)).
+			WithCode(validate.CodeUnreferencedTable).WithTable(name).At(cr.tableSource(name).Start())
+	}
+	return vr
+}
+
+//where the named table is in its source, nil if not known. Caller must hold a lock
+func (cr *concreteTableRepo) tableSource(name string) *table.SourceMap {
+	if td, found := cr.tableStore[name]; found {
+		return td.parsedTable.Source
+	}
+	return nil
+}
+
+//Caller must hold a lock
+func (cr *concreteTableRepo) buildReferenceGraph() *ReferenceGraph {
+	graph := &ReferenceGraph{
+		Nodes: make([]*GraphNode, 0, len(cr.tableStore)+len(cr.scriptStore)),
+		Edges: make([]*GraphEdge, 0),
+	}
+
+	missing := make(map[string]struct{})
+	addEdge := func(e *GraphEdge) {
+		if _, found := cr.tableStore[e.To]; !found {
+			e.Dangling = true
+			missing[e.To] = struct{}{}
+		}
+		graph.Edges = append(graph.Edges, e)
+	}
+
+	for name, td := range cr.tableStore {
+		graph.Nodes = append(graph.Nodes, &GraphNode{
+			Name:   name,
+			Type:   itemTypeTable,
+			Inline: td.parsedTable.IsInlineTable,
+			Exists: true,
+			Rows:   len(td.parsedTable.ContentRows()),
+		})
+		for _, ref := range td.parsedTable.References() {
+			addEdge(&GraphEdge{
+				From:      name,
+				FromType:  itemTypeTable,
+				To:        cr.resolveName(ref.Name, name),
+				Operation: ref.Operation,
+				Text:      ref.Text,
+				Row:       ref.Row,
+			})
+		}
+	}
+
+	for name, sd := range cr.scriptStore {
+		graph.Nodes = append(graph.Nodes, &GraphNode{
+			Name:   name,
+			Type:   itemTypeScript,
+			Exists: true,
+		})
+		for _, matches := range scriptRefPattern.FindAllStringSubmatch(sd.scriptSource, -1) {
+			to := matches[2]
+			if to == "" {
+				to = matches[3]
+			}
+			addEdge(&GraphEdge{
+				From:      name,
+				FromType:  itemTypeScript,
+				To:        cr.resolveName(to, name),
+				Operation: matches[1],
+				Text:      strings.TrimLeft(matches[0], ". \t"),
+				Row:       -1,
+			})
+		}
+	}
+
+	for name := range missing {
+		graph.Nodes = append(graph.Nodes, &GraphNode{
+			Name: name,
+			Type: itemTypeTable,
+		})
+	}
+
+	sort.Slice(graph.Nodes, func(i, j int) bool {
+		if graph.Nodes[i].Type != graph.Nodes[j].Type {
+			return graph.Nodes[i].Type == itemTypeScript
+		}
+		return graph.Nodes[i].Name < graph.Nodes[j].Name
+	})
+	sort.SliceStable(graph.Edges, func(i, j int) bool {
+		ei, ej := graph.Edges[i], graph.Edges[j]
+		if ei.FromType != ej.FromType {
+			return ei.FromType == itemTypeScript
+		}
+		if ei.From != ej.From {
+			return ei.From < ej.From
+		}
+		return ei.Row < ej.Row
+	})
+	return graph
+}
+
+//Dangling returns the references to tables that do not exist
+func (rg *ReferenceGraph) Dangling() []*GraphEdge {
+	dangling := make([]*GraphEdge, 0)
+	for _, e := range rg.Edges {
+		if e.Dangling {
+			dangling = append(dangling, e)
+		}
+	}
+	return dangling
+}
+
+//Unreachable returns the sorted names of the tables that are not referenced by
+//any other table or script. These tables can only be used by rolling or picking
+//on them directly. Inline tables are not included, unused inline tables are
+//reported when their table is validated
+func (rg *ReferenceGraph) Unreachable() []string {
+	referenced := make(map[string]struct{})
+	for _, e := range rg.Edges {
+		if e.FromType == itemTypeScript || e.From != e.To {
+			referenced[e.To] = struct{}{}
+		}
+	}
+
+	unreachable := make([]string, 0)
+	for _, n := range rg.Nodes {
+		if n.Type != itemTypeTable || n.Inline || !n.Exists {
+			continue
+		}
+		if _, found := referenced[n.Name]; !found {
+			unreachable = append(unreachable, n.Name)
+		}
+	}
+	return unreachable
+}
+
+//Cycles returns one cycle for each group of tables that can refer back to
+//themselves. Each cycle is a path that starts and ends with the same table eg
+//[A B A]. A cycle is not neccessarily an error as a table may intentionally
+//refer to itself from some rows but not others
+func (rg *ReferenceGraph) Cycles() [][]string {
+	return cyclesIn(rg.tableAdjacency())
+}
+
+//one cycle for each strongly connected component of the adjacency list that
+//contains a cycle
+func cyclesIn(adjacency map[string][]string) [][]string {
+	cycles := make([][]string, 0)
+	for _, component := range stronglyConnected(adjacency) {
+		start := component[0]
+		if len(component) == 1 && !contains(adjacency[start], start) {
+			continue //a lone table that does not refer to itself
+		}
+		members := make(map[string]struct{}, len(component))
+		for _, c := range component {
+			members[c] = struct{}{}
+		}
+		cycles = append(cycles, cyclePath(start, adjacency, members))
+	}
+
+	sort.Slice(cycles, func(i, j int) bool {
+		return cycles[i][0] < cycles[j][0]
+	})
+	return cycles
+}
+
+//InfiniteRecursion returns the cycles of tables that can never finish
+//expanding because every row of every table in the cycle refers (directly or
+//through other tables) back into the cycle eg every row of A refers to B and
+//every row of B refers to A. Rolling or picking on any of these tables, or on a
+//table that can only reach them, always fails. Each cycle is a path that starts
+//and ends with the same table eg [A B A].
+//
+//Tables that refer to themselves from some rows but have another row that ends
+//the recursion are not reported
+func (rg *ReferenceGraph) InfiniteRecursion() [][]string {
+	nonTerminating := rg.nonTerminating()
+
+	//cycles that stay entirely within the non-terminating tables
+	adjacency := make(map[string][]string)
+	for from, to := range rg.tableAdjacency() {
+		if _, found := nonTerminating[from]; !found {
+			continue
+		}
+		adjacency[from] = make([]string, 0, len(to))
+		for _, t := range to {
+			if _, found := nonTerminating[t]; found {
+				adjacency[from] = append(adjacency[from], t)
+			}
+		}
+	}
+	return cyclesIn(adjacency)
+}
+
+//finds the tables that can never finish expanding. A table finishes if it has a
+//row whose references are all to tables that finish (or do not exist, which
+//fails but does not recurse). Starting with no tables known to finish, keep
+//adding those that can until nothing changes - whatever remains never finishes.
+//Picks are treated like rolls so a table is only reported if it surely recurses
+func (rg *ReferenceGraph) nonTerminating() map[string]struct{} {
+	type rowKey struct {
+		table string
+		row   int
+	}
+	rowRefs := make(map[rowKey][]string)
+	for _, e := range rg.Edges {
+		if e.FromType == itemTypeTable {
+			k := rowKey{e.From, e.Row}
+			rowRefs[k] = append(rowRefs[k], e.To)
+		}
+	}
+
+	terminating := make(map[string]struct{})
+	for _, n := range rg.Nodes {
+		if n.Type == itemTypeTable && !n.Exists {
+			terminating[n.Name] = struct{}{}
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, n := range rg.Nodes {
+			if _, found := terminating[n.Name]; found || n.Type != itemTypeTable {
+				continue
+			}
+			for row := 0; row < n.Rows; row++ {
+				finishes := true
+				for _, to := range rowRefs[rowKey{n.Name, row}] {
+					if _, found := terminating[to]; !found {
+						finishes = false
+						break
+					}
+				}
+				if finishes {
+					terminating[n.Name] = struct{}{}
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	nonTerminating := make(map[string]struct{})
+	for _, n := range rg.Nodes {
+		if _, found := terminating[n.Name]; !found && n.Type == itemTypeTable {
+			nonTerminating[n.Name] = struct{}{}
+		}
+	}
+	return nonTerminating
+}
+
+//table-to-table references as a sorted adjacency list
+func (rg *ReferenceGraph) tableAdjacency() map[string][]string {
+	adjacency := make(map[string][]string)
+	for _, n := range rg.Nodes {
+		if n.Type == itemTypeTable {
+			adjacency[n.Name] = make([]string, 0)
+		}
+	}
+	for _, e := range rg.Edges {
+		if e.FromType == itemTypeTable && !contains(adjacency[e.From], e.To) {
+			adjacency[e.From] = append(adjacency[e.From], e.To)
+		}
+	}
+	for _, to := range adjacency {
+		sort.Strings(to)
+	}
+	return adjacency
+}
+
+//Tarjan's algorithm. Each returned component is sorted and the components are
+//sorted by their first member
+func stronglyConnected(adjacency map[string][]string) [][]string {
+	names := make([]string, 0, len(adjacency))
+	for name := range adjacency {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	index := 0
+	indexes := make(map[string]int)
+	lowlinks := make(map[string]int)
+	onStack := make(map[string]bool)
+	stack := make([]string, 0)
+	components := make([][]string, 0)
+
+	var visit func(v string)
+	visit = func(v string) {
+		indexes[v] = index
+		lowlinks[v] = index
+		index++
+		stack = append(stack, v)
+		onStack[v] = true
+
+		for _, w := range adjacency[v] {
+			if _, visited := indexes[w]; !visited {
+				visit(w)
+				if lowlinks[w] < lowlinks[v] {
+					lowlinks[v] = lowlinks[w]
+				}
+			} else if onStack[w] && indexes[w] < lowlinks[v] {
+				lowlinks[v] = indexes[w]
+			}
+		}
+
+		if lowlinks[v] == indexes[v] {
+			component := make([]string, 0)
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				component = append(component, w)
+				if w == v {
+					break
+				}
+			}
+			sort.Strings(component)
+			components = append(components, component)
+		}
+	}
+
+	for _, name := range names {
+		if _, visited := indexes[name]; !visited {
+			visit(name)
+		}
+	}
+
+	sort.Slice(components, func(i, j int) bool {
+		return components[i][0] < components[j][0]
+	})
+	return components
+}
+
+//finds a path from start back to itself that stays within members using a
+//breadth first search so the shortest such cycle is reported
+func cyclePath(start string, adjacency map[string][]string, members map[string]struct{}) []string {
+	previous := make(map[string]string)
+	queue := []string{start}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, next := range adjacency[current] {
+			if _, member := members[next]; !member {
+				continue
+			}
+			if next == start {
+				path := []string{start}
+				for n := current; n != start; n = previous[n] {
+					path = append(path, n)
+				}
+				path = append(path, start)
+				//path was built backwards
+				for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+					path[i], path[j] = path[j], path[i]
+				}
+				return path
+			}
+			if _, seen := previous[next]; !seen {
+				previous[next] = current
+				queue = append(queue, next)
+			}
+		}
+	}
+	return []string{start, start} //unreachable for a valid component
+}
+
+func anyIn(list []string, set map[string]struct{}) bool {
+	for _, l := range list {
+		if _, found := set[l]; found {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, item string) bool {
+	for _, l := range list {
+		if l == item {
+			return true
+		}
+	}
+	return false
+}
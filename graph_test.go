@@ -0,0 +1,292 @@
+package tablib
+
+/*
+These tests focus on the reference graph and reference validation
+*/
+
+import (
+	"reflect"
+	"strings"
+	"tablib/validate"
+	"testing"
+)
+
+const (
+	graphYmlTop = `
+  definition:
+    name: Top
+    type: flat
+  content:
+    - "{@Middle}"
+    - "{2!Leaf}"
+    - "{@Missing}"
+    - "{#1}"
+  inline:
+    - id: 1
+      content:
+        - "{@Leaf}"`
+
+	graphYmlMiddle = `
+  definition:
+    name: Middle
+    type: flat
+  content:
+    - "{@Leaf}"
+    - "{@Loop}"`
+
+	graphYmlLeaf = `
+  definition:
+    name: Leaf
+    type: flat
+  content:
+    - leaf 1
+    - leaf 2`
+
+	graphYmlLoop = `
+  definition:
+    name: Loop
+    type: flat
+  content:
+    - "{@Middle}"
+    - done`
+
+	graphLua = `
+  local t = require("tables")
+  results = {}
+  function main()
+    results["a"] = t.roll("Top")
+    results["b"] = t.pick('Leaf', 1)
+    results["c"] = t.roll( "Nowhere" )
+  end`
+)
+
+var graphYmls = []string{graphYmlTop, graphYmlMiddle, graphYmlLeaf, graphYmlLoop}
+
+func TestReferenceGraph_shouldBuildGraph(t *testing.T) {
+	repo := newTestRepo(t, graphYmls)
+	failOnErr("Unable to add script", repo.AddLuaScript("Gen", graphLua), t)
+
+	graph := repo.ReferenceGraph()
+
+	nodes := make([]string, 0)
+	for _, n := range graph.Nodes {
+		nodes = append(nodes, n.Type+":"+n.Name)
+	}
+	expectedNodes := []string{"script:Gen", "table:Leaf", "table:Loop", "table:Middle",
+		"table:Missing", "table:Nowhere", "table:Top", "table:Top.1"}
+	if !reflect.DeepEqual(nodes, expectedNodes) {
+		t.Errorf("Unexpected nodes: %v", nodes)
+	}
+	for _, n := range graph.Nodes {
+		if n.Exists == (n.Name == "Missing" || n.Name == "Nowhere") {
+			t.Errorf("Unexpected existence for node: %+v", n)
+		}
+		if n.Inline != (n.Name == "Top.1") {
+			t.Errorf("Unexpected inline flag for node: %+v", n)
+		}
+	}
+
+	edges := make([]string, 0)
+	for _, e := range graph.Edges {
+		edges = append(edges, e.From+"-"+e.Operation+"->"+e.To)
+	}
+	expectedEdges := []string{"Gen-roll->Top", "Gen-pick->Leaf", "Gen-roll->Nowhere",
+		"Loop-roll->Middle", "Middle-roll->Leaf", "Middle-roll->Loop",
+		"Top-roll->Middle", "Top-pick->Leaf", "Top-roll->Missing", "Top-roll->Top.1",
+		"Top.1-roll->Leaf"}
+	if !reflect.DeepEqual(edges, expectedEdges) {
+		t.Errorf("Unexpected edges: %v", edges)
+	}
+
+	dangling := graph.Dangling()
+	if len(dangling) != 2 || dangling[0].To != "Nowhere" || dangling[0].Row != -1 ||
+		dangling[1].To != "Missing" || dangling[1].Row != 2 || dangling[1].Text != "{@Missing}" {
+		t.Errorf("Unexpected dangling references: %+v %+v", dangling[0], dangling[1])
+	}
+}
+
+func TestReferenceGraph_shouldFindCyclesAndUnreachable(t *testing.T) {
+	repo := newTestRepo(t, graphYmls)
+
+	graph := repo.ReferenceGraph()
+	if cycles := graph.Cycles(); !reflect.DeepEqual(cycles, [][]string{{"Loop", "Middle", "Loop"}}) {
+		t.Errorf("Unexpected cycles: %v", cycles)
+	}
+	if unreachable := graph.Unreachable(); !reflect.DeepEqual(unreachable, []string{"Top"}) {
+		t.Errorf("Unexpected unreachable tables: %v", unreachable)
+	}
+
+	//a script makes Top reachable
+	failOnErr("Unable to add script", repo.AddLuaScript("Gen", graphLua), t)
+	if unreachable := repo.ReferenceGraph().Unreachable(); len(unreachable) != 0 {
+		t.Errorf("Unexpected unreachable tables: %v", unreachable)
+	}
+}
+
+func TestReferenceGraph_shouldFindSelfReference(t *testing.T) {
+	repo := NewTableRepository()
+	_, err := repo.AddTable([]byte(`
+  definition:
+    name: Self
+    type: flat
+  content:
+    - "{@Self}"
+    - stop`))
+	failOnErr("Unable to add table", err, t)
+
+	graph := repo.ReferenceGraph()
+	if cycles := graph.Cycles(); !reflect.DeepEqual(cycles, [][]string{{"Self", "Self"}}) {
+		t.Errorf("Unexpected cycles: %v", cycles)
+	}
+	//referring to yourself does not make you reachable
+	if unreachable := graph.Unreachable(); !reflect.DeepEqual(unreachable, []string{"Self"}) {
+		t.Errorf("Unexpected unreachable tables: %v", unreachable)
+	}
+}
+
+func TestValidateReferences_shouldReportIssues(t *testing.T) {
+	repo := newTestRepo(t, graphYmls)
+	failOnErr("Unable to add script", repo.AddLuaScript("Gen", graphLua), t)
+
+	vr := repo.ValidateReferences()
+	if vr.Valid() {
+		t.Error("Dangling references should invalidate the repository")
+	}
+	if vr.ErrorCount() != 2 || vr.WarnCount() != 1 {
+		t.Fatalf("Unexpected issue counts: %d errors, %d warnings: %v", vr.ErrorCount(), vr.WarnCount(), vr.Errors)
+	}
+
+	all := strings.Join(vr.Errors, "\n")
+	for _, expected := range []string{
+		"Script: Gen refers to missing table: Nowhere",
+		"Table: Top refers to missing table: Missing via {@Missing}",
+		"Reference cycle: Loop -> Middle -> Loop",
+	} {
+		if !strings.Contains(all, expected) {
+			t.Errorf("Missing expected issue: %s", expected)
+		}
+	}
+
+	missing := vr.WithCode(validate.CodeMissingTable)
+	if len(missing) != 2 {
+		t.Fatalf("Unexpected missing table diagnostics: %v", missing)
+	}
+	for _, d := range missing {
+		if d.Table == "Top" && d.Row != 2 {
+			t.Errorf("Unexpected location: %+v", d)
+		}
+		if strings.HasPrefix(d.Message, "Script") && (d.Table != "" || d.Row != -1) {
+			t.Errorf("Unexpected location: %+v", d)
+		}
+	}
+	if cycles := vr.WithCode(validate.CodeReferenceCycle); len(cycles) != 1 || cycles[0].Severity != validate.SeverityWarn {
+		t.Errorf("Unexpected cycle diagnostics: %v", cycles)
+	}
+}
+
+func TestValidateReferences_shouldPassCleanRepo(t *testing.T) {
+	repo := NewTableRepository()
+	_, err := repo.AddTable([]byte(graphYmlLeaf))
+	failOnErr("Unable to add table", err, t)
+	failOnErr("Unable to add script", repo.AddLuaScript("Gen", `
+  local t = require("tables")
+  results = {}
+  function main()
+    results["a"] = t.roll("Leaf")
+  end`), t)
+
+	vr := repo.ValidateReferences()
+	if !vr.Valid() || vr.IssueCount() != 0 {
+		t.Errorf("Unexpected issues: %v", vr.Errors)
+	}
+}
+
+func TestReferenceGraph_shouldFindInfiniteRecursion(t *testing.T) {
+	repo := NewTableRepository()
+	for _, yml := range []string{`
+  definition:
+    name: Ping
+    type: flat
+  content:
+    - "{@Pong}"
+    - "ping {#1}"
+  inline:
+    - id: 1
+      content:
+        - "{@Pong} again"`, `
+  definition:
+    name: Pong
+    type: flat
+  content:
+    - "{1!Ping}"`, `
+  definition:
+    name: Caller
+    type: flat
+  content:
+    - "{@Ping}"`, `
+  definition:
+    name: Escapes
+    type: flat
+  content:
+    - "{@Escapes}"
+    - "{@Gone}"`} {
+		_, err := repo.AddTable([]byte(yml))
+		failOnErr("Unable to add table", err, t)
+	}
+
+	graph := repo.ReferenceGraph()
+	expected := [][]string{{"Ping", "Pong", "Ping"}}
+	if infinite := graph.InfiniteRecursion(); !reflect.DeepEqual(infinite, expected) {
+		t.Errorf("Unexpected infinite recursion: %v", infinite)
+	}
+
+	//Escapes refers to itself but may stop on a missing table
+	vr := repo.ValidateReferences()
+	all := strings.Join(vr.Errors, "\n")
+	if !strings.Contains(all, "ERROR: References - Infinite recursion, every row refers back into: Ping -> Pong -> Ping") {
+		t.Errorf("Infinite recursion not reported: %v", vr.Errors)
+	}
+	if !strings.Contains(all, "WARN: References - Reference cycle: Escapes -> Escapes") {
+		t.Errorf("Finite cycle not reported: %v", vr.Errors)
+	}
+	if strings.Contains(all, "Reference cycle: Ping") {
+		t.Errorf("Infinite recursion also reported as a cycle: %v", vr.Errors)
+	}
+}
+
+func TestReferenceGraph_shouldResolveNamespaces(t *testing.T) {
+	repo := NewTableRepository()
+	for _, yml := range []string{`
+  definition:
+    name: dnd5e/npc
+    type: flat
+  content:
+    - "{@names} {@missing}"`, `
+  definition:
+    name: dnd5e/names
+    type: flat
+  content:
+    - Bruenor`} {
+		_, err := repo.AddTable([]byte(yml))
+		failOnErr("Unable to add table", err, t)
+	}
+	err := repo.AddLuaScript("dnd5e/gen", `
+  local t = require("tables")
+  function main()
+    t.roll("npc")
+  end`)
+	failOnErr("Unable to add script", err, t)
+
+	graph := repo.ReferenceGraph()
+	if len(graph.Edges) != 3 {
+		t.Fatalf("Unexpected edges: %d", len(graph.Edges))
+	}
+	for i, want := range []string{"dnd5e/npc", "dnd5e/names", "missing"} {
+		if graph.Edges[i].To != want {
+			t.Errorf("Edge %d resolved to %s want %s", i, graph.Edges[i].To, want)
+		}
+	}
+	if dangling := graph.Dangling(); len(dangling) != 1 {
+		t.Errorf("Unexpected dangling references: %d", len(dangling))
+	}
+}
@@ -0,0 +1,91 @@
+package httpapi
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"tablib"
+	"tablib/validate"
+)
+
+//AddTableResponse is the response to /admin/tables. The table was stored only
+//if Valid is true, warnings may be present either way
+type AddTableResponse struct {
+	Valid       bool                   `json:"valid"`
+	Errors      []string               `json:"errors"` //errors and warnings as given by the ValidationResult
+	Diagnostics []*validate.Diagnostic `json:"diagnostics"`
+}
+
+//AddScriptResponse is the response to /admin/scripts
+type AddScriptResponse struct {
+	Name string `json:"name"`
+}
+
+//requires the admin token, if there is one
+func (h *Handler) admin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.adminToken != "" {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(h.adminToken)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, http.StatusUnauthorized, "A valid admin token is required")
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+func (h *Handler) addTable(w http.ResponseWriter, r *http.Request) {
+	body, ok := readUpload(w, r)
+	if !ok {
+		return
+	}
+
+	vr, err := h.repo.AddTable(body)
+	switch {
+	case errors.Is(err, tablib.ErrTableExists):
+		writeError(w, http.StatusConflict, err.Error())
+	case err != nil: //not yaml or not a table
+		writeError(w, http.StatusBadRequest, err.Error())
+	case !vr.Valid():
+		writeJSON(w, http.StatusUnprocessableEntity, &AddTableResponse{Valid: false, Errors: vr.Errors, Diagnostics: vr.Diagnostics})
+	default:
+		writeJSON(w, http.StatusCreated, &AddTableResponse{Valid: true, Errors: vr.Errors, Diagnostics: vr.Diagnostics})
+	}
+}
+
+func (h *Handler) addScript(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	body, ok := readUpload(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.repo.AddLuaScript(name, string(body)); err != nil { //the script does not compile
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, &AddScriptResponse{Name: name})
+}
+
+//reads an uploaded table or script, failing the request if it is too large
+func readUpload(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxUploadSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return nil, false
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return body, true
+}
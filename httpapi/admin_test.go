@@ -0,0 +1,111 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"tablib"
+	"tablib/validate"
+	"testing"
+)
+
+func TestAddTable_shouldStoreValidTables(t *testing.T) {
+	h := newTestHandler(t)
+	yml := strings.Replace(flavorsYml, "Flavors", "Syrups", 1)
+
+	var ar AddTableResponse
+	if status := serve(t, h, http.MethodPost, "/admin/tables", yml, &ar); status != http.StatusCreated || !ar.Valid {
+		t.Fatalf("Unexpected response: %d %+v", status, ar)
+	}
+	var tr TableResponse
+	if status := serve(t, h, http.MethodGet, "/roll?table=Syrups", "", &tr); status != http.StatusOK {
+		t.Errorf("Table was not stored: %d", status)
+	}
+}
+
+func TestAddTable_shouldReportInvalidTables(t *testing.T) {
+	h := newTestHandler(t)
+
+	var ar AddTableResponse
+	invalid := strings.Replace(flavorsYml, "chocolate", `"{@bad name}"`, 1)
+	if status := serve(t, h, http.MethodPost, "/admin/tables", invalid, &ar); status != http.StatusUnprocessableEntity ||
+		ar.Valid || len(ar.Errors) == 0 {
+		t.Errorf("Unexpected response: %d %+v", status, ar)
+	}
+	if len(ar.Diagnostics) != 1 || ar.Diagnostics[0].Code != validate.CodeInvalidName ||
+		ar.Diagnostics[0].Table != "Flavors" || ar.Diagnostics[0].Row != 0 {
+		t.Errorf("Unexpected diagnostics: %+v", ar.Diagnostics)
+	}
+
+	var er ErrorResponse
+	if status := serve(t, h, http.MethodPost, "/admin/tables", "not: [yaml", &er); status != http.StatusBadRequest {
+		t.Errorf("Unexpected status for bad yaml: %d", status)
+	}
+	if status := serve(t, h, http.MethodGet, "/admin/tables", "", &er); status != http.StatusMethodNotAllowed {
+		t.Errorf("Unexpected status for GET: %d", status)
+	}
+}
+
+func TestAddTable_shouldReportCollisions(t *testing.T) {
+	repo := tablib.NewTableRepository(tablib.WithCollisionPolicy(tablib.CollisionError))
+	repo.AddTable([]byte(flavorsYml))
+	h := NewHandler(repo)
+
+	var er ErrorResponse
+	if status := serve(t, h, http.MethodPost, "/admin/tables", flavorsYml, &er); status != http.StatusConflict {
+		t.Errorf("Unexpected status for collision: %d %+v", status, er)
+	}
+}
+
+func TestAddScript_shouldStoreScripts(t *testing.T) {
+	h := newTestHandler(t)
+
+	var ar AddScriptResponse
+	if status := serve(t, h, http.MethodPost, "/admin/scripts?name=copy", sundaeLua, &ar); status != http.StatusCreated ||
+		ar.Name != "copy" {
+		t.Fatalf("Unexpected response: %d %+v", status, ar)
+	}
+	var er ErrorResponse
+	if status := serve(t, h, http.MethodPost, "/admin/scripts?name=bad", "function (", &er); status !=
+		http.StatusUnprocessableEntity {
+		t.Errorf("Unexpected status for bad script: %d", status)
+	}
+	if status := serve(t, h, http.MethodPost, "/admin/scripts", sundaeLua, &er); status != http.StatusBadRequest {
+		t.Errorf("Unexpected status without a name: %d", status)
+	}
+}
+
+func TestAdmin_shouldRequireToken(t *testing.T) {
+	h := newTestHandler(t, WithAdminToken("secret"))
+	yml := strings.Replace(flavorsYml, "Flavors", "Syrups", 1)
+
+	var er ErrorResponse
+	if status := serve(t, h, http.MethodPost, "/admin/tables", yml, &er); status != http.StatusUnauthorized {
+		t.Errorf("Unexpected status without a token: %d", status)
+	}
+
+	for token, want := range map[string]int{"Bearer wrong": http.StatusUnauthorized, "Bearer secret": http.StatusCreated} {
+		req := httptest.NewRequest(http.MethodPost, "/admin/tables", strings.NewReader(yml))
+		req.Header.Set("Authorization", token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("%s: unexpected status: %d", token, rec.Code)
+		}
+	}
+
+	//the read endpoints stay open
+	var tr TagsResponse
+	if status := serve(t, h, http.MethodGet, "/tags", "", &tr); status != http.StatusOK {
+		t.Errorf("Unexpected status for tags: %d", status)
+	}
+}
+
+func TestAddTable_shouldRefuseLargeUploads(t *testing.T) {
+	h := newTestHandler(t)
+	var er ErrorResponse
+	big := strings.Repeat("x", maxUploadSize+1)
+	if status := serve(t, h, http.MethodPost, "/admin/tables", big, &er); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("Unexpected status for large upload: %d", status)
+	}
+}
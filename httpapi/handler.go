@@ -0,0 +1,354 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"tablib"
+	"tablib/tableresult"
+)
+
+//Handler serves a TableRepository as JSON over HTTP. The endpoints are:
+//
+//	GET  /roll?table=name&count=n     roll on a table, count defaults to 1
+//	GET  /pick?table=name&count=n     pick count unique items from a table
+//	POST /execute?script=name         run a script, see ExecuteRequest
+//	GET  /dice?expr=2d6+3             evaluate a dice expression
+//	GET  /list?type=table&name=name   the source of a table or script
+//	GET  /search?name=regex&tag=t     search by name and any number of tags
+//	GET  /tags                        all tags in use
+//	POST /admin/tables                add the table in the request body
+//	POST /admin/scripts?name=name     add the script in the request body
+//
+//Table and script names are passed as query parameters as namespaced names
+//may contain a /. Missing tables and scripts are reported with 404, bad
+//requests with 400 and content that fails validation with 422. Failures are
+//described by an ErrorResponse
+type Handler struct {
+	repo       tablib.TableRepository
+	mux        *http.ServeMux
+	adminToken string
+}
+
+//Option configures a Handler when it is created
+type Option func(*Handler)
+
+//WithAdminToken requires requests to the admin endpoints to carry the given
+//token as an Authorization: Bearer header. Without it the admin endpoints are
+//open to anyone who can reach the handler
+func WithAdminToken(token string) Option {
+	return func(h *Handler) {
+		h.adminToken = token
+	}
+}
+
+const (
+	defaultCount  = 1
+	maxUploadSize = 1 << 20 //bytes, the largest table or script that may be added
+)
+
+//TableResponse is the response to /roll and /pick
+type TableResponse struct {
+	Table  string   `json:"table"`
+	Result []string `json:"result"`
+	Log    []string `json:"log"`
+	Error  string   `json:"error,omitempty"` //set if execution was cut off
+}
+
+//ExecuteRequest is the optional body of a request to /execute. If the script
+//takes parameters and the request has no Params, the script is not run and
+//the response lists the parameters instead so the client may choose values and
+//submit the request again. Parameters missing from Params take their defaults
+type ExecuteRequest struct {
+	Params map[string]string `json:"params"`
+}
+
+//ExecuteResponse is the response to /execute. It holds either the script's
+//Results or, if the request gave no parameter values, the Params it takes
+type ExecuteResponse struct {
+	Script  string                       `json:"script"`
+	Results map[string]string            `json:"results,omitempty"`
+	Params  []*tablib.ParamSpecification `json:"params,omitempty"`
+}
+
+//DiceResponse is the response to /dice
+type DiceResponse struct {
+	Expr  string `json:"expr"`
+	Value int    `json:"value"`
+}
+
+//ListResponse is the response to /list
+type ListResponse struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Source string `json:"source"`
+}
+
+//SearchResponse is the response to /search
+type SearchResponse struct {
+	Items []*SearchItem `json:"items"`
+}
+
+//SearchItem describes a single table or script found by /search
+type SearchItem struct {
+	Name string   `json:"name"`
+	Type string   `json:"type"`
+	Tags []string `json:"tags"`
+}
+
+//TagsResponse is the response to /tags
+type TagsResponse struct {
+	Tags []string `json:"tags"`
+}
+
+//ErrorResponse describes why a request failed
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+//NewHandler creates a Handler serving the given repository
+func NewHandler(repo tablib.TableRepository, opts ...Option) *Handler {
+	h := &Handler{
+		repo: repo,
+		mux:  http.NewServeMux(),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	h.mux.HandleFunc("/roll", h.get(h.roll))
+	h.mux.HandleFunc("/pick", h.get(h.pick))
+	h.mux.HandleFunc("/execute", h.post(h.execute))
+	h.mux.HandleFunc("/dice", h.get(h.dice))
+	h.mux.HandleFunc("/list", h.get(h.list))
+	h.mux.HandleFunc("/search", h.get(h.search))
+	h.mux.HandleFunc("/tags", h.get(h.tags))
+	h.mux.HandleFunc("/admin/tables", h.admin(h.post(h.addTable)))
+	h.mux.HandleFunc("/admin/scripts", h.admin(h.post(h.addScript)))
+	return h
+}
+
+//ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) roll(w http.ResponseWriter, r *http.Request) {
+	name, ok := h.requireTable(w, r)
+	if !ok {
+		return
+	}
+	count, ok := countParam(w, r, defaultCount)
+	if !ok {
+		return
+	}
+	writeTableResult(w, name, h.repo.RollContext(r.Context(), name, count))
+}
+
+func (h *Handler) pick(w http.ResponseWriter, r *http.Request) {
+	name, ok := h.requireTable(w, r)
+	if !ok {
+		return
+	}
+	if r.URL.Query().Get("count") == "" {
+		writeError(w, http.StatusBadRequest, "count is required")
+		return
+	}
+	count, ok := countParam(w, r, defaultCount)
+	if !ok {
+		return
+	}
+	writeTableResult(w, name, h.repo.PickContext(r.Context(), name, count))
+}
+
+func (h *Handler) execute(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("script")
+	if name == "" {
+		writeError(w, http.StatusBadRequest, "script is required")
+		return
+	}
+	if _, err := h.repo.List(name, "script"); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	var req ExecuteRequest
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxUploadSize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request: %s", err))
+			return
+		}
+	}
+
+	//without parameter values, stop the script as soon as it asks for them. A
+	//script declaring no parameters has nothing to ask so is left to run
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	var specs []*tablib.ParamSpecification
+	specsLock := &sync.Mutex{}
+	callback := func(ps []*tablib.ParamSpecification) map[string]string {
+		values := tablib.DefaultParamSpecificationCallback(ps)
+		if req.Params == nil && len(ps) > 0 {
+			specsLock.Lock()
+			specs = ps
+			specsLock.Unlock()
+			cancel()
+			return values
+		}
+		for k, v := range req.Params {
+			values[k] = v
+		}
+		return values
+	}
+
+	results, err := h.repo.ExecuteContext(ctx, name, callback)
+	specsLock.Lock()
+	defer specsLock.Unlock()
+	switch {
+	case specs != nil:
+		writeJSON(w, http.StatusOK, &ExecuteResponse{Script: name, Params: specs})
+	case err != nil:
+		writeError(w, errorStatus(err), err.Error())
+	default:
+		status := http.StatusOK
+		if _, failed := results["Script-Error"]; failed {
+			status = http.StatusUnprocessableEntity
+		}
+		writeJSON(w, status, &ExecuteResponse{Script: name, Results: results})
+	}
+}
+
+func (h *Handler) dice(w http.ResponseWriter, r *http.Request) {
+	expr := r.URL.Query().Get("expr")
+	value, err := h.repo.EvaluateDiceExpression(expr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, &DiceResponse{Expr: expr, Value: value})
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	itemType := r.URL.Query().Get("type")
+	if itemType == "" {
+		itemType = "table"
+	}
+	if itemType != "table" && itemType != "script" {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Bad item type: %s", itemType))
+		return
+	}
+	source, err := h.repo.List(name, itemType)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, &ListResponse{Name: name, Type: itemType, Source: source})
+}
+
+func (h *Handler) search(w http.ResponseWriter, r *http.Request) {
+	found, err := h.repo.Search(r.URL.Query().Get("name"), r.URL.Query()["tag"])
+	if err != nil { //a bad regex
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	resp := &SearchResponse{Items: make([]*SearchItem, 0, len(found))}
+	for _, sr := range found {
+		resp.Items = append(resp.Items, &SearchItem{Name: sr.Name, Type: sr.Type, Tags: sr.Tags})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) tags(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, &TagsResponse{Tags: h.repo.Tags()})
+}
+
+//reads the table query parameter, failing the request if it is missing or
+//does not name a table
+func (h *Handler) requireTable(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name := r.URL.Query().Get("table")
+	if name == "" {
+		writeError(w, http.StatusBadRequest, "table is required")
+		return "", false
+	}
+	if _, err := h.repo.List(name, "table"); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return "", false
+	}
+	return name, true
+}
+
+func countParam(w http.ResponseWriter, r *http.Request, defaultValue int) (int, bool) {
+	param := r.URL.Query().Get("count")
+	if param == "" {
+		return defaultValue, true
+	}
+	count, err := strconv.Atoi(param)
+	if err != nil || count < 1 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid count: %s", param))
+		return 0, false
+	}
+	return count, true
+}
+
+func writeTableResult(w http.ResponseWriter, name string, tr *tableresult.TableResult) {
+	resp := &TableResponse{
+		Table:  name,
+		Result: tr.Result,
+		Log:    tr.Log,
+	}
+	status := http.StatusOK
+	if tr.Err != nil {
+		resp.Error = tr.Err.Error()
+		status = errorStatus(tr.Err)
+	}
+	writeJSON(w, status, resp)
+}
+
+//the status for an error that cut off a roll, pick or script
+func errorStatus(err error) int {
+	var le *tablib.LimitError
+	if errors.As(err, &le) {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusServiceUnavailable //the client went away
+}
+
+func (h *Handler) get(next http.HandlerFunc) http.HandlerFunc {
+	return allowMethod(http.MethodGet, next)
+}
+
+func (h *Handler) post(next http.HandlerFunc) http.HandlerFunc {
+	return allowMethod(http.MethodPost, next)
+}
+
+func allowMethod(method string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("Method: %s not allowed", r.Method))
+			return
+		}
+		next(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, &ErrorResponse{Error: msg})
+}
@@ -0,0 +1,277 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"tablib"
+	"testing"
+)
+
+const (
+	flavorsYml = `
+  definition:
+    name: Flavors
+    type: flat
+    tags:
+      - dessert
+  content:
+    - chocolate`
+
+	rangeYml = `
+  definition:
+    name: dnd5e/encounters
+    type: range
+    roll: 1d2
+  content:
+    - "{1}goblin"
+    - "{2}orc"`
+
+	loopYml = `
+  definition:
+    name: Loop
+    type: flat
+  content:
+    - "{@Loop}"`
+
+	sundaeLua = `
+  local t = require("tables")
+  results = {}
+  function main()
+    results["flavor"] = t.roll("Flavors")
+  end`
+
+	toppingLua = `
+  results = {}
+  params = {}
+  params["topping"] = "nuts|sprinkles"
+  function main(p)
+    results["topping"] = p["topping"]
+  end`
+
+	greedyLua = `
+  results = {}
+  function main()
+    results["greed"] = string.rep("x", 100 * 1024 * 1024)
+  end`
+
+	coneLua = `
+  results = {}
+  params = {}
+  function main()
+    results["cone"] = "waffle"
+  end`
+)
+
+func newTestHandler(t *testing.T, opts ...Option) *Handler {
+	repo := tablib.NewTableRepository(tablib.WithRandomSource(tablib.NewScriptedRandomSource(2)))
+	for _, yml := range []string{flavorsYml, rangeYml, loopYml} {
+		if _, err := repo.AddTable([]byte(yml)); err != nil {
+			t.Fatalf("Unable to add table: %v", err)
+		}
+	}
+	for name, script := range map[string]string{"sundae": sundaeLua, "topping": toppingLua, "cone": coneLua, "greedy": greedyLua} {
+		if err := repo.AddLuaScript(name, script); err != nil {
+			t.Fatalf("Unable to add script: %v", err)
+		}
+	}
+	return NewHandler(repo, opts...)
+}
+
+//makes a request and decodes the JSON response into body
+func serve(t *testing.T, h http.Handler, method, target, reqBody string, body interface{}) int {
+	req := httptest.NewRequest(method, target, strings.NewReader(reqBody))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("%s %s: unexpected content type: %s", method, target, ct)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), body); err != nil {
+		t.Errorf("%s %s: unable to decode response: %v", method, target, err)
+	}
+	return rec.Code
+}
+
+func TestRoll_shouldRollOnTable(t *testing.T) {
+	h := newTestHandler(t)
+	var tr TableResponse
+	status := serve(t, h, http.MethodGet, "/roll?table=dnd5e/encounters&count=2", "", &tr)
+	if status != http.StatusOK || len(tr.Result) != 2 || tr.Result[0] != "orc" || tr.Table != "dnd5e/encounters" {
+		t.Errorf("Unexpected response: %d %+v", status, tr)
+	}
+}
+
+func TestRoll_shouldReportBadRequests(t *testing.T) {
+	h := newTestHandler(t)
+	for target, want := range map[string]int{
+		"/roll":                       http.StatusBadRequest,
+		"/roll?table=Flavors&count=x": http.StatusBadRequest,
+		"/roll?table=Flavors&count=0": http.StatusBadRequest,
+		"/roll?table=Missing":         http.StatusNotFound,
+		"/roll?table=Loop":            http.StatusUnprocessableEntity,
+		"/pick?table=Flavors":         http.StatusBadRequest,
+		"/pick?table=Missing&count=1": http.StatusNotFound,
+	} {
+		var er ErrorResponse
+		if status := serve(t, h, http.MethodGet, target, "", &er); status != want || er.Error == "" {
+			t.Errorf("%s: unexpected response: %d %+v", target, status, er)
+		}
+	}
+
+	var er ErrorResponse
+	if status := serve(t, h, http.MethodPost, "/roll?table=Flavors", "", &er); status != http.StatusMethodNotAllowed {
+		t.Errorf("Unexpected status for POST: %d", status)
+	}
+}
+
+func TestPick_shouldPickFromTable(t *testing.T) {
+	h := newTestHandler(t)
+	var tr TableResponse
+	status := serve(t, h, http.MethodGet, "/pick?table=Flavors&count=1", "", &tr)
+	if status != http.StatusOK || len(tr.Result) != 1 || tr.Result[0] != "chocolate" {
+		t.Errorf("Unexpected response: %d %+v", status, tr)
+	}
+}
+
+func TestExecute_shouldRunScript(t *testing.T) {
+	h := newTestHandler(t)
+	var er ExecuteResponse
+	status := serve(t, h, http.MethodPost, "/execute?script=sundae", "", &er)
+	if status != http.StatusOK || er.Results["flavor"] != "chocolate" || er.Params != nil {
+		t.Errorf("Unexpected response: %d %+v", status, er)
+	}
+
+	var errResp ErrorResponse
+	if status := serve(t, h, http.MethodPost, "/execute?script=missing", "", &errResp); status != http.StatusNotFound {
+		t.Errorf("Unexpected status for missing script: %d", status)
+	}
+	if status := serve(t, h, http.MethodPost, "/execute?script=sundae", "{", &errResp); status != http.StatusBadRequest {
+		t.Errorf("Unexpected status for bad request: %d", status)
+	}
+}
+
+func TestExecute_shouldRequestParams(t *testing.T) {
+	h := newTestHandler(t)
+
+	//without values the script's parameters are returned
+	var er ExecuteResponse
+	status := serve(t, h, http.MethodPost, "/execute?script=topping", "", &er)
+	if status != http.StatusOK || er.Results != nil || len(er.Params) != 1 {
+		t.Fatalf("Unexpected response: %d %+v", status, er)
+	}
+	if er.Params[0].Name != "topping" || er.Params[0].Default != "nuts" || len(er.Params[0].Options) != 2 {
+		t.Errorf("Unexpected params: %+v", er.Params[0])
+	}
+
+	//resubmitted with a chosen value
+	er = ExecuteResponse{}
+	status = serve(t, h, http.MethodPost, "/execute?script=topping", `{"params": {"topping": "sprinkles"}}`, &er)
+	if status != http.StatusOK || er.Results["topping"] != "sprinkles" {
+		t.Errorf("Unexpected response: %d %+v", status, er)
+	}
+
+	//an empty set of values takes the defaults
+	er = ExecuteResponse{}
+	status = serve(t, h, http.MethodPost, "/execute?script=topping", `{"params": {}}`, &er)
+	if status != http.StatusOK || er.Results["topping"] != "nuts" {
+		t.Errorf("Unexpected response: %d %+v", status, er)
+	}
+}
+
+func TestExecute_shouldRunScriptWithoutParams(t *testing.T) {
+	h := newTestHandler(t)
+	var er ExecuteResponse
+	status := serve(t, h, http.MethodPost, "/execute?script=cone", "", &er)
+	if status != http.StatusOK || er.Results["cone"] != "waffle" || er.Params != nil {
+		t.Errorf("Unexpected response: %d %+v", status, er)
+	}
+}
+
+func TestExecute_shouldReportCutOffScriptsAsRollsDo(t *testing.T) {
+	h := newTestHandler(t)
+	var er ErrorResponse
+	if status := serve(t, h, http.MethodPost, "/execute?script=greedy", "", &er); status != http.StatusUnprocessableEntity {
+		t.Errorf("Unexpected status for a script over its limits: %d %+v", status, er)
+	}
+
+	//the client has gone away
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, target := range []string{"/execute?script=sundae", "/roll?table=Flavors"} {
+		method := http.MethodGet
+		if strings.HasPrefix(target, "/execute") {
+			method = http.MethodPost
+		}
+		req := httptest.NewRequest(method, target, strings.NewReader("")).WithContext(ctx)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s: unexpected status once cancelled: %d", target, rec.Code)
+		}
+	}
+}
+
+func TestDice_shouldEvaluateExpression(t *testing.T) {
+	h := newTestHandler(t)
+	var dr DiceResponse
+	status := serve(t, h, http.MethodGet, "/dice?expr=2d6%2B3", "", &dr)
+	if status != http.StatusOK || dr.Expr != "2d6+3" || dr.Value != 7 {
+		t.Errorf("Unexpected response: %d %+v", status, dr)
+	}
+
+	var er ErrorResponse
+	if status := serve(t, h, http.MethodGet, "/dice?expr=2x6", "", &er); status != http.StatusBadRequest {
+		t.Errorf("Unexpected status for bad dice: %d", status)
+	}
+}
+
+func TestList_shouldListSource(t *testing.T) {
+	h := newTestHandler(t)
+	var lr ListResponse
+	status := serve(t, h, http.MethodGet, "/list?name=sundae&type=script", "", &lr)
+	if status != http.StatusOK || lr.Source != sundaeLua {
+		t.Errorf("Unexpected response: %d %+v", status, lr)
+	}
+	status = serve(t, h, http.MethodGet, "/list?name=Flavors", "", &lr)
+	if status != http.StatusOK || lr.Type != "table" || lr.Source != flavorsYml {
+		t.Errorf("Unexpected response: %d %+v", status, lr)
+	}
+
+	var er ErrorResponse
+	if status := serve(t, h, http.MethodGet, "/list?name=Missing", "", &er); status != http.StatusNotFound {
+		t.Errorf("Unexpected status for missing table: %d", status)
+	}
+	if status := serve(t, h, http.MethodGet, "/list?name=Flavors&type=x", "", &er); status != http.StatusBadRequest {
+		t.Errorf("Unexpected status for bad type: %d", status)
+	}
+}
+
+func TestSearch_shouldSearchByNameAndTag(t *testing.T) {
+	h := newTestHandler(t)
+	var sr SearchResponse
+	status := serve(t, h, http.MethodGet, "/search?tag=dessert", "", &sr)
+	if status != http.StatusOK || len(sr.Items) != 1 || sr.Items[0].Name != "Flavors" {
+		t.Errorf("Unexpected response: %d %+v", status, sr)
+	}
+	sr = SearchResponse{}
+	status = serve(t, h, http.MethodGet, "/search?name=^dnd5e/", "", &sr)
+	if status != http.StatusOK || len(sr.Items) != 1 || sr.Items[0].Name != "dnd5e/encounters" {
+		t.Errorf("Unexpected response: %d %+v", status, sr)
+	}
+
+	var er ErrorResponse
+	if status := serve(t, h, http.MethodGet, "/search?name=(", "", &er); status != http.StatusBadRequest {
+		t.Errorf("Unexpected status for bad regex: %d", status)
+	}
+}
+
+func TestTags_shouldListTags(t *testing.T) {
+	h := newTestHandler(t)
+	var tr TagsResponse
+	status := serve(t, h, http.MethodGet, "/tags", "", &tr)
+	if status != http.StatusOK || len(tr.Tags) != 1 || tr.Tags[0] != "dessert" {
+		t.Errorf("Unexpected response: %d %+v", status, tr)
+	}
+}
@@ -0,0 +1,110 @@
+package tablib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/yuin/gopher-lua"
+)
+
+const (
+	//LimitCallDepth is the limit on how deeply tables may refer to other tables
+	LimitCallDepth = "call depth"
+
+	//LimitRollCount is the limit on the number of rolls in a single request
+	LimitRollCount = "roll count"
+
+	//LimitExpansions is the limit on the number of times a single request may
+	//roll or pick on a table or roll dice, including those needed to expand table refs
+	LimitExpansions = "expansions"
+
+	//LimitOutputSize is the limit on the number of bytes a single request may generate
+	LimitOutputSize = "output size"
+
+	//LimitScriptTime is the limit on how long a script may run, Max is in milliseconds
+	LimitScriptTime = "script time"
+
+	//LimitScriptCallStack is the limit on how deeply Lua functions may call one another
+	LimitScriptCallStack = "script call stack"
+
+	//LimitScriptRegistry is the limit on the number of values on the Lua data stack
+	LimitScriptRegistry = "script registry"
+
+	//LimitScriptMemory is the limit on the number of bytes of strings a script may build
+	LimitScriptMemory = "script memory"
+
+	defaultMaxCallDepth    = 100
+	defaultMaxRollCount    = 100
+	defaultMaxExpansions   = 10000
+	defaultPickDelim       = "|"
+	defaultCallbackTimeout = 30 * time.Second
+	defaultMaxOutputSize   = 1024 * 1024
+	defaultScriptTimeout   = 30 * time.Second
+	defaultScriptMemory    = 64 * 1024 * 1024
+)
+
+var (
+	defaultScriptCallStackSize = lua.CallStackSize
+	defaultScriptRegistrySize  = lua.RegistrySize
+)
+
+//executionConfig holds the limits and settings that apply to every request made
+//of a repository. See the With* RepositoryOptions
+type executionConfig struct {
+	maxCallDepth    int
+	maxRollCount    int
+	maxExpansions   int
+	pickDelim       string
+	callbackTimeout time.Duration
+	maxOutputSize   int //bytes
+
+	//Lua sandbox limits, applied to each script execution
+	scriptTimeout       time.Duration
+	scriptCallStackSize int
+	scriptRegistrySize  int
+	scriptMemory        int //bytes
+}
+
+func defaultExecutionConfig() *executionConfig {
+	return &executionConfig{
+		maxCallDepth:    defaultMaxCallDepth,
+		maxRollCount:    defaultMaxRollCount,
+		maxExpansions:   defaultMaxExpansions,
+		pickDelim:       defaultPickDelim,
+		callbackTimeout: defaultCallbackTimeout,
+		maxOutputSize:   defaultMaxOutputSize,
+
+		scriptTimeout:       defaultScriptTimeout,
+		scriptCallStackSize: defaultScriptCallStackSize,
+		scriptRegistrySize:  defaultScriptRegistrySize,
+		scriptMemory:        defaultScriptMemory,
+	}
+}
+
+//LimitError is the TableResult.Err reported when a request exceeds one of the
+//repository's execution limits. Results generated before the limit was reached
+//remain in the TableResult. It is also the error returned by ExecuteContext
+//when a script exceeds one of the Lua sandbox limits
+type LimitError struct {
+	Limit string //one of the Limit* constants
+	Max   int    //the configured limit
+	msg   string
+}
+
+func newLimitError(limit string, max int, format string, args ...interface{}) *LimitError {
+	return &LimitError{
+		Limit: limit,
+		Max:   max,
+		msg:   fmt.Sprintf(format, args...),
+	}
+}
+
+func (le *LimitError) Error() string {
+	return le.msg
+}
+
+//Is reports whether the error is the call depth limit, so that errors.Is may
+//be used with ErrCallDepth
+func (le *LimitError) Is(target error) bool {
+	return target == ErrCallDepth && le.Limit == LimitCallDepth
+}
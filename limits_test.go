@@ -0,0 +1,202 @@
+package tablib
+
+/*
+These tests focus on the configurable execution limits
+*/
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	limitsYmlNested = `
+  definition:
+    name: Outer
+    type: flat
+  content:
+    - "outer {@Middle}"`
+
+	limitsYmlMiddle = `
+  definition:
+    name: Middle
+    type: flat
+  content:
+    - "middle {@Inner}"`
+
+	limitsYmlInner = `
+  definition:
+    name: Inner
+    type: flat
+  content:
+    - inner 1
+    - inner 2
+    - inner 3`
+)
+
+var limitsYmls = []string{limitsYmlNested, limitsYmlMiddle, limitsYmlInner}
+
+func expectLimitError(err error, limit string, max int, t *testing.T) {
+	t.Helper()
+	var le *LimitError
+	if !errors.As(err, &le) {
+		t.Fatalf("Expected a LimitError, received: %v", err)
+	}
+	if le.Limit != limit || le.Max != max {
+		t.Errorf("Unexpected limit error: %s %d", le.Limit, le.Max)
+	}
+}
+
+func TestLimits_shouldApplyMaxCallDepth(t *testing.T) {
+	repo := newTestRepo(t, limitsYmls, WithMaxCallDepth(2))
+
+	tr := repo.Roll("Middle", 1)
+	if tr.Err != nil || len(tr.Result) != 1 {
+		t.Fatalf("Roll within depth limit failed: %v", tr.Err)
+	}
+
+	tr = repo.Roll("Outer", 1)
+	expectLimitError(tr.Err, LimitCallDepth, 2, t)
+	if !strings.HasSuffix(tr.Err.Error(), "via recursion: Outer -> Middle -> Inner") {
+		t.Errorf("Unexpected error: %v", tr.Err)
+	}
+	if len(tr.Result) != 0 {
+		t.Errorf("Unexpected results present: %v", tr.Result)
+	}
+}
+
+func TestLimits_shouldApplyMaxRollCount(t *testing.T) {
+	repo := newTestRepo(t, limitsYmls, WithMaxRollCount(5))
+
+	if tr := repo.Roll("Inner", 5); tr.Err != nil || len(tr.Result) != 5 {
+		t.Fatalf("Roll within count limit failed: %v", tr.Err)
+	}
+
+	tr := repo.Roll("Inner", 6)
+	expectLimitError(tr.Err, LimitRollCount, 5, t)
+	if len(tr.Result) != 0 || len(tr.Log) != 1 || tr.Log[0] != "Too many rolls requested, max is: 5" {
+		t.Errorf("Unexpected result: %v %v", tr.Result, tr.Log)
+	}
+
+	//higher limits are allowed too
+	repo = newTestRepo(t, limitsYmls, WithMaxRollCount(1000))
+	if tr := repo.Roll("Inner", 1000); tr.Err != nil || len(tr.Result) != 1000 {
+		t.Errorf("Roll within raised count limit failed: %v", tr.Err)
+	}
+}
+
+func TestLimits_shouldApplyPickDelimiter(t *testing.T) {
+	repo := newTestRepo(t, limitsYmls, WithPickDelimiter(", "))
+
+	tr := repo.Pick("Inner", 2)
+	if len(tr.Result) != 1 || len(strings.Split(tr.Result[0], ", ")) != 2 {
+		t.Errorf("Pick delimiter not used: %v", tr.Result)
+	}
+	tr = repo.Pick("Inner", 3)
+	if len(tr.Result) != 1 || len(strings.Split(tr.Result[0], ", ")) != 3 {
+		t.Errorf("Pick delimiter not used when picking all: %v", tr.Result)
+	}
+}
+
+func TestLimits_shouldApplyMaxOutputSize(t *testing.T) {
+	//"outer middle inner n" is 20 bytes
+	repo := newTestRepo(t, limitsYmls, WithMaxOutputSize(50))
+
+	tr := repo.Roll("Outer", 2)
+	if tr.Err != nil || len(tr.Result) != 2 {
+		t.Fatalf("Roll within output limit failed: %v", tr.Err)
+	}
+
+	tr = repo.Roll("Outer", 3)
+	expectLimitError(tr.Err, LimitOutputSize, 50, t)
+	if len(tr.Result) != 2 {
+		t.Errorf("Results before the limit should be kept: %v", tr.Result)
+	}
+
+	//a single oversized result is stopped part way through expansion
+	repo = newTestRepo(t, limitsYmls, WithMaxOutputSize(10))
+	tr = repo.Roll("Outer", 1)
+	expectLimitError(tr.Err, LimitOutputSize, 10, t)
+	if len(tr.Result) != 0 {
+		t.Errorf("Unexpected results present: %v", tr.Result)
+	}
+
+	//there is a limit by default
+	repo = NewTableRepository(WithMaxRollCount(1000))
+	yml := fmt.Sprintf("definition:\n  name: Big\n  type: flat\ncontent:\n  - %s\n", strings.Repeat("x", 4096))
+	_, err := repo.AddTable([]byte(yml))
+	failOnErr("Unable to add table", err, t)
+	tr = repo.Roll("Big", 1000)
+	expectLimitError(tr.Err, LimitOutputSize, defaultMaxOutputSize, t)
+}
+
+func TestLimits_shouldApplyMaxExpansions(t *testing.T) {
+	//Outer, Middle and Inner are each expanded once per roll
+	repo := newTestRepo(t, limitsYmls, WithMaxExpansions(6))
+	if tr := repo.Roll("Outer", 2); tr.Err != nil || len(tr.Result) != 2 {
+		t.Fatalf("Roll within expansion limit failed: %v", tr.Err)
+	}
+
+	tr := repo.Roll("Outer", 3)
+	expectLimitError(tr.Err, LimitExpansions, 6, t)
+	if len(tr.Result) != 2 {
+		t.Errorf("Results before the limit should be kept: %v", tr.Result)
+	}
+}
+
+func TestLimits_shouldStopTablesThatFanOut(t *testing.T) {
+	//each level refers to the next four times, without any cycle
+	repo := NewTableRepository()
+	for i := 1; i <= 10; i++ {
+		row := strings.Repeat(fmt.Sprintf("{@Level%d}", i+1), 4)
+		if i == 10 {
+			row = "leaf"
+		}
+		yml := fmt.Sprintf("definition:\n  name: Level%d\n  type: flat\ncontent:\n  - \"%s\"\n", i, row)
+		_, err := repo.AddTable([]byte(yml))
+		failOnErr("Unable to add table", err, t)
+	}
+
+	tr := repo.Roll("Level1", 1)
+	expectLimitError(tr.Err, LimitExpansions, defaultMaxExpansions, t)
+	if len(tr.Log) > 3*defaultMaxExpansions {
+		t.Errorf("Unexpected amount of work done: %d log lines", len(tr.Log))
+	}
+}
+
+func TestLimits_shouldIgnoreInvalidValues(t *testing.T) {
+	repo := NewTableRepository(WithMaxCallDepth(0), WithMaxRollCount(-1), WithMaxExpansions(0),
+		WithCallbackTimeout(0), WithMaxOutputSize(-5)).(*concreteTableRepo)
+
+	if *repo.config != *defaultExecutionConfig() {
+		t.Errorf("Invalid option values were applied: %+v", repo.config)
+	}
+}
+
+func TestLimits_shouldApplyCallbackTimeout(t *testing.T) {
+	lua := `
+  params = {}
+  params["p1"] = "opt1-1|opt1-2"
+
+  results = {}
+  function main(goData)
+  results["p1"] = goData["p1"]
+  end
+  `
+
+	repo := NewTableRepository(WithCallbackTimeout(10 * time.Millisecond))
+	repo.AddLuaScript("test", lua)
+
+	release := make(chan struct{})
+	defer close(release)
+	mp := repo.Execute("test", func([]*ParamSpecification) map[string]string {
+		<-release //never answers in time
+		return map[string]string{"p1": "opt1-2"}
+	})
+	if mp["p1"] != "opt1-1" {
+		t.Errorf("Default param value not used after timeout: %v", mp)
+	}
+}
@@ -0,0 +1,228 @@
+package tablib
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+	"tablib/util"
+	"tablib/validate"
+)
+
+//FileLoadResult describes the outcome of loading a single file into a repository
+type FileLoadResult struct {
+	Path     string //path of the file within the loaded file system
+	ItemType string //"table" or "script"
+
+	//Name is the name of the table or script the file defines. Tables are named
+	//by their definition, scripts by their file name less the .lua extension.
+	//Either is qualified by the namespace the file was loaded into, if any. Name
+	//is empty if a table file could not be parsed well enough to find it
+	Name string
+
+	//ValidationResult holds the validation results of a table file. It is nil
+	//for scripts and for table files that could not be parsed
+	ValidationResult *validate.ValidationResult
+
+	//Err holds any error that prevented the file from being parsed or compiled
+	Err error
+}
+
+//Loaded returns true if the file's table or script was stored in the repository
+func (flr *FileLoadResult) Loaded() bool {
+	if flr.Err != nil {
+		return false
+	}
+	return flr.ValidationResult == nil || flr.ValidationResult.Valid()
+}
+
+//LoadReport holds the per-file results of a bulk load, sorted by path
+type LoadReport struct {
+	Files []*FileLoadResult
+}
+
+//Valid returns true if every file in the load was stored in the repository.
+//Files that loaded with warnings are considered valid
+func (lr *LoadReport) Valid() bool {
+	return len(lr.Failed()) == 0
+}
+
+//Failed returns the results of those files that were not stored in the repository
+func (lr *LoadReport) Failed() []*FileLoadResult {
+	failed := make([]*FileLoadResult, 0)
+	for _, f := range lr.Files {
+		if !f.Loaded() {
+			failed = append(failed, f)
+		}
+	}
+	return failed
+}
+
+func (cr *concreteTableRepo) LoadFS(fsys fs.FS) (*LoadReport, error) {
+	return cr.LoadFSNamespace(fsys, "")
+}
+
+func (cr *concreteTableRepo) LoadFSNamespace(fsys fs.FS, namespace string) (*LoadReport, error) {
+	if namespace != "" {
+		vr := validate.NewValidationResult()
+		util.IsValidName(namespace, "namespace", "LoadFSNamespace", vr)
+		if !vr.Valid() {
+			return nil, errors.New(vr.Errors[0])
+		}
+	}
+
+	//find all table and script files
+	paths, err := contentPaths(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &LoadReport{
+		Files: make([]*FileLoadResult, len(paths)),
+	}
+
+	//scripts are named by file name alone so two scripts in different directories
+	//can collide. Load only the first (in path order) of any such scripts
+	scriptPaths := make(map[string]string)
+	loadable := make([]int, 0, len(paths))
+	for i, p := range paths {
+		if itemTypeForPath(p) == itemTypeScript {
+			name := util.QualifyName(namespace, scriptNameForPath(p))
+			if firstPath, found := scriptPaths[name]; found {
+				report.Files[i] = &FileLoadResult{
+					Path:     p,
+					ItemType: itemTypeScript,
+					Name:     name,
+					Err:      fmt.Errorf("Script: %s is already defined by: %s", name, firstPath),
+				}
+				continue
+			}
+			scriptPaths[name] = p
+		}
+		loadable = append(loadable, i)
+	}
+
+	//parsing, validation and compilation are done outside the repo lock so read
+	//the files in parallel
+	parsed := make([]*tableFile, len(paths))
+	work := make(chan int)
+	wg := &sync.WaitGroup{}
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				report.Files[i], parsed[i] = cr.readFile(fsys, paths[i], namespace)
+			}
+		}()
+	}
+	for _, i := range loadable {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	//two files may define the same table. Store only the first (in path order)
+	//that is valid so that the result does not depend on which file was read first
+	tablePaths := make(map[string]string)
+	for i, tf := range parsed {
+		result := report.Files[i]
+		if tf == nil || !tf.validationResults.Valid() {
+			continue
+		}
+		if firstPath, found := tablePaths[result.Name]; found {
+			result.Err = fmt.Errorf("Table: %s is already defined by: %s", result.Name, firstPath)
+			continue
+		}
+		tablePaths[result.Name] = result.Path
+		result.Err = cr.storeTable(tf, "")
+	}
+
+	return report, nil
+}
+
+//loadFile reads a single table or script file and adds it to the repo in the
+//given namespace. The table named by replaces, if any, is being reloaded and may
+//be replaced whatever the collision policy
+func (cr *concreteTableRepo) loadFile(fsys fs.FS, p, namespace, replaces string) *FileLoadResult {
+	result, tf := cr.readFile(fsys, p, namespace)
+	if tf != nil {
+		result.Err = cr.storeTable(tf, replaces)
+	}
+	return result
+}
+
+//readFile reads a single table or script file. Scripts are added to the repo in
+//the given namespace but tables are only parsed, the parsed table is returned
+//for the caller to store
+func (cr *concreteTableRepo) readFile(fsys fs.FS, p, namespace string) (*FileLoadResult, *tableFile) {
+	result := &FileLoadResult{
+		Path:     p,
+		ItemType: itemTypeForPath(p),
+	}
+
+	data, err := fs.ReadFile(fsys, p)
+	if err != nil {
+		result.Err = err
+		return result, nil
+	}
+
+	switch result.ItemType {
+	case itemTypeTable:
+		tf, err := parseTable(data, p, namespace)
+		if err != nil {
+			result.Err = err
+			return result, nil
+		}
+		result.Name = tf.tbl.Definition.Name
+		result.ValidationResult = tf.validationResults
+		return result, tf
+	case itemTypeScript:
+		result.Name = util.QualifyName(namespace, scriptNameForPath(p))
+		result.Err = cr.AddLuaScript(result.Name, string(data))
+	}
+	return result, nil
+}
+
+//finds all table and script files in the file system in lexical order. Hidden
+//files and directories (eg .git) are skipped
+func contentPaths(fsys fs.FS) ([]string, error) {
+	paths := make([]string, 0)
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != "." && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && itemTypeForPath(p) != "" {
+			paths = append(paths, p)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+//determines what kind of item, if any, a file holds based on its extension
+func itemTypeForPath(p string) string {
+	switch strings.ToLower(path.Ext(p)) {
+	case ".yml", ".yaml":
+		return itemTypeTable
+	case ".lua":
+		return itemTypeScript
+	default:
+		return ""
+	}
+}
+
+//scripts are named for the file that holds them eg path/to/npc.lua is 'npc'
+func scriptNameForPath(p string) string {
+	base := path.Base(p)
+	return strings.TrimSuffix(base, path.Ext(base))
+}
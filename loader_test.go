@@ -0,0 +1,287 @@
+package tablib
+
+/*
+These tests focus on bulk loading tables and scripts from a file system
+*/
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"tablib/validate"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadFS_shouldLoadTablesAndScripts(t *testing.T) {
+	fsys := fstest.MapFS{
+		"tables/flavors.yml": {Data: []byte(`
+  definition:
+    name: Icecream_Flavors
+    type: flat
+  content:
+    - chocolate`)},
+		"tables/nested/syrups.YAML": {Data: []byte(`
+  definition:
+    name: Syrups
+    type: flat
+  content:
+    - hot fudge`)},
+		"scripts/sundae.lua": {Data: []byte(`
+  local t = require("tables")
+  results = {}
+  function main()
+    results["flavor"] = t.roll("Icecream_Flavors")
+    results["syrup"] = t.roll("Syrups")
+  end`)},
+		"README.md":         {Data: []byte("not content")},
+		".hidden/skip.yml":  {Data: []byte("not: [valid")},
+		"tables/.skip.yaml": {Data: []byte("not: [valid")},
+	}
+
+	repo := NewTableRepository()
+	report, err := repo.LoadFS(fsys)
+	failOnErr("Unable to load file system", err, t)
+
+	if len(report.Files) != 3 {
+		t.Fatalf("Unexpected number of files loaded: %d", len(report.Files))
+	}
+	if !report.Valid() {
+		t.Error("All files should have loaded")
+	}
+
+	//report is sorted by path
+	if report.Files[0].Path != "scripts/sundae.lua" || report.Files[0].ItemType != itemTypeScript ||
+		report.Files[0].Name != "sundae" || report.Files[0].ValidationResult != nil {
+		t.Errorf("Unexpected script result: %+v", report.Files[0])
+	}
+	if report.Files[1].Name != "Icecream_Flavors" || report.Files[1].ItemType != itemTypeTable ||
+		report.Files[1].ValidationResult == nil {
+		t.Errorf("Unexpected table result: %+v", report.Files[1])
+	}
+	if report.Files[2].Name != "Syrups" {
+		t.Errorf("Unexpected table result: %+v", report.Files[2])
+	}
+
+	mp := repo.Execute("sundae", nil)
+	if mp["flavor"] != "chocolate" || mp["syrup"] != "hot fudge" {
+		t.Errorf("Loaded content did not execute as expected: %v", mp)
+	}
+}
+
+func TestLoadFS_shouldReportBadFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"bad_yaml.yml": {Data: []byte(`
+  definition:
+    name: "Bad`)},
+		"not_a_table.yml": {Data: []byte(`
+  some: config`)},
+		"invalid.yml": {Data: []byte(`
+  definition:
+    name: Invalid
+    type: flat
+  content:
+    - "{@Foo"`)},
+		"good.yml": {Data: []byte(`
+  definition:
+    name: Good
+    type: flat
+  content:
+    - item 1`)},
+		"a/script.lua": {Data: []byte(`results = {}`)},
+		"b/script.lua": {Data: []byte(`results = {}`)},
+		"broken.lua":   {Data: []byte(`function main(`)},
+	}
+
+	repo := NewTableRepository()
+	report, err := repo.LoadFS(fsys)
+	failOnErr("Unable to load file system", err, t)
+
+	if report.Valid() {
+		t.Error("Report should not be valid")
+	}
+
+	failed := make(map[string]*FileLoadResult)
+	for _, f := range report.Failed() {
+		failed[f.Path] = f
+	}
+	if len(failed) != 5 {
+		t.Errorf("Unexpected number of failures: %d", len(failed))
+	}
+	for _, p := range []string{"bad_yaml.yml", "not_a_table.yml", "b/script.lua", "broken.lua"} {
+		if f, found := failed[p]; !found || f.Err == nil {
+			t.Errorf("Expected an error for: %s", p)
+		}
+	}
+	if f, found := failed["invalid.yml"]; !found || f.Err != nil || f.ValidationResult.Valid() || f.Name != "Invalid" {
+		t.Error("Expected a validation failure for invalid.yml")
+	} else if pos := f.ValidationResult.Diagnostics[0].Position; pos.String() != "invalid.yml:6:7" {
+		t.Errorf("Unexpected position: %v", pos)
+	}
+
+	sr, _ := repo.Search("", nil)
+	if len(sr) != 2 {
+		t.Errorf("Only the good table and first script should be in the repo: %d", len(sr))
+	}
+}
+
+func TestLoadFS_shouldLoadFirstOfDuplicateTables(t *testing.T) {
+	dup := func(item string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(`
+  definition:
+    name: Dup
+    type: flat
+  content:
+    - ` + item)}
+	}
+	fsys := fstest.MapFS{
+		"a/dup.yml": dup("first"),
+		"b/dup.yml": dup("second"),
+		"c/dup.yml": dup("third"),
+	}
+
+	//the workers read the files in any order, which must not matter
+	for i := 0; i < 20; i++ {
+		repo := NewTableRepository()
+		report, err := repo.LoadFS(fsys)
+		failOnErr("Unable to load file system", err, t)
+
+		if !report.Files[0].Loaded() {
+			t.Fatalf("The first table should load: %+v", report.Files[0])
+		}
+		for _, f := range report.Files[1:] {
+			if f.Err == nil || f.Err.Error() != "Table: Dup is already defined by: a/dup.yml" {
+				t.Fatalf("Unexpected error for %s: %v", f.Path, f.Err)
+			}
+		}
+		yml, err := repo.List("Dup", itemTypeTable)
+		failOnErr("Unable to list table", err, t)
+		if !strings.Contains(yml, "first") {
+			t.Fatalf("The first table should be stored: %s", yml)
+		}
+	}
+}
+
+func TestLoadFS_shouldLoadFirstValidOfDuplicateTables(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/dup.yml": {Data: []byte(`
+  definition:
+    name: Dup
+    type: flat
+  content:
+    - "{@broken"`)},
+		"b/dup.yml": {Data: []byte(`
+  definition:
+    name: Dup
+    type: flat
+  content:
+    - second`)},
+	}
+
+	repo := NewTableRepository()
+	report, err := repo.LoadFS(fsys)
+	failOnErr("Unable to load file system", err, t)
+	if report.Files[0].Loaded() || !report.Files[1].Loaded() {
+		t.Fatalf("Only the valid table should load: %+v %+v", report.Files[0], report.Files[1])
+	}
+	if tr := repo.Roll("Dup", 1); tr.Err != nil || tr.Result[0] != "second" {
+		t.Errorf("The valid table should be stored: %v %v", tr.Result, tr.Err)
+	}
+}
+
+func TestLoadFS_shouldErrorOnMissingRoot(t *testing.T) {
+	repo := NewTableRepository()
+	_, err := repo.LoadFS(os.DirFS(filepath.Join(t.TempDir(), "missing")))
+	if err == nil {
+		t.Error("Did not receive expected error for missing directory")
+	}
+}
+
+func TestLoadFSNamespace_shouldKeepSourcesApart(t *testing.T) {
+	pack := func(name string) fstest.MapFS {
+		return fstest.MapFS{
+			"names.yml": {Data: []byte(`
+  definition:
+    name: names
+    type: flat
+  content:
+    - ` + name)},
+			"npc.lua": {Data: []byte(`
+  local t = require("tables")
+  results = {}
+  function main()
+    results["name"] = t.roll("names")
+    results["picked"] = t.pick("names", 1)
+  end`)},
+		}
+	}
+
+	repo := NewTableRepository(WithCollisionPolicy(CollisionError))
+	for ns, name := range map[string]string{"dnd5e": "Bruenor", "scifi": "Zed"} {
+		report, err := repo.LoadFSNamespace(pack(name), ns)
+		failOnErr("Unable to load file system", err, t)
+		if !report.Valid() {
+			t.Fatalf("All files should have loaded: %v", report.Failed()[0].Err)
+		}
+		if report.Files[0].Name != ns+"/names" || report.Files[1].Name != ns+"/npc" {
+			t.Errorf("Names not qualified: %s %s", report.Files[0].Name, report.Files[1].Name)
+		}
+	}
+
+	for ns, want := range map[string]string{"dnd5e": "Bruenor", "scifi": "Zed"} {
+		res := repo.Execute(ns+"/npc", nil)
+		if res["name"] != want || res["picked"] != want {
+			t.Errorf("Script in %s resolved the wrong table: %v", ns, res)
+		}
+	}
+
+	if _, err := repo.LoadFSNamespace(pack("x"), "bad//ns"); err == nil {
+		t.Error("Expected an error for an invalid namespace")
+	}
+}
+
+func TestLoadFS_shouldPlaceDiagnostics(t *testing.T) {
+	fsys := fstest.MapFS{
+		"tables/top.yml": {Data: []byte(`definition:
+  name: Top
+  type: flat
+content:
+  - "{#1}"
+  - "{@Missing}"
+inline:
+  - id: 1
+    content:
+      - fine
+      - "{oops"
+`)},
+		"tables/fixed.yml": {Data: []byte(`definition:
+  name: Fixed
+  type: flat
+content:
+  - "{@Missing}"
+`)},
+	}
+
+	repo := NewTableRepository()
+	report, err := repo.LoadFS(fsys)
+	failOnErr("Unable to load file system", err, t)
+
+	failed := report.Failed()
+	if len(failed) != 1 || failed[0].Path != "tables/top.yml" {
+		t.Fatalf("Unexpected failures: %v", failed)
+	}
+	d := failed[0].ValidationResult.Diagnostics[0]
+	if d.Position.String() != "tables/top.yml:11:9" || d.Table != "Top" || d.InlineID != "1" || d.Row != 1 {
+		t.Errorf("Unexpected diagnostic: %+v", d)
+	}
+
+	vr := repo.ValidateReferences()
+	refs := vr.WithCode(validate.CodeMissingTable)
+	if len(refs) != 1 || refs[0].Position.String() != "tables/fixed.yml:5:5" {
+		t.Errorf("Unexpected reference diagnostics: %+v", refs)
+	}
+	unused := vr.WithCode(validate.CodeUnreferencedTable)
+	if len(unused) != 1 || unused[0].Position.String() != "tables/fixed.yml:1:1" {
+		t.Errorf("Unexpected reference diagnostics: %+v", unused)
+	}
+}
@@ -0,0 +1,210 @@
+package lsp
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"tablib"
+	"tablib/util"
+)
+
+var (
+	//table references being typed, up to the cursor
+	openTableRefPattern  = regexp.MustCompile(`\{(@|[0-9]+!)[^{}]*$`)
+	openInlineRefPattern = regexp.MustCompile(`\{#[0-9]*$`)
+	openScriptRefPattern = regexp.MustCompile(`\.\s*(roll|pick)\s*\(\s*["'][^"']*$`)
+)
+
+//definitionAt returns where the table referred to at the position is defined,
+//nil if there is no reference there or the table does not exist
+func (ws *workspace) definitionAt(sf *sourceFile, pos position) *location {
+	ref := ws.refAt(sf, pos)
+	if ref == nil {
+		return nil
+	}
+	loc, _ := ws.definition(ref.name)
+	return loc
+}
+
+//referencesAt returns every reference to the table referred to at the position
+//or, if there is no reference there, to the table being edited. Its definition
+//is included first if asked for
+func (ws *workspace) referencesAt(sf *sourceFile, pos position, includeDeclaration bool) []*location {
+	locs := make([]*location, 0)
+	target := ws.targetAt(sf, pos)
+	if target == "" {
+		return locs
+	}
+	if includeDeclaration {
+		if loc, found := ws.definition(target); found {
+			locs = append(locs, loc)
+		}
+	}
+
+	paths := make([]string, 0, len(ws.files))
+	for p := range ws.files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		for _, ref := range ws.refs(ws.files[p]) {
+			if ref.name == target {
+				locs = append(locs, &location{URI: ws.uri(p), Range: ref.rng})
+			}
+		}
+	}
+	return locs
+}
+
+//the table at the position: the one referred to there, or the inline table or
+//table whose content or definition it is in
+func (ws *workspace) targetAt(sf *sourceFile, pos position) string {
+	if ref := ws.refAt(sf, pos); ref != nil {
+		return ref.name
+	}
+	if sf.tbl == nil {
+		return ""
+	}
+	if rs := sf.rowAt(pos); rs != nil {
+		return rs.table
+	}
+	for i, il := range sf.tbl.Inline {
+		if sf.source.InlineTable(i).Start().Line-1 == pos.Line {
+			return util.BuildFullName(sf.name, il.ID)
+		}
+	}
+	return sf.name
+}
+
+//completionsAt offers the names of tables, or the ids of inline tables, when a
+//reference to one is being typed
+func (ws *workspace) completionsAt(sf *sourceFile, pos position) []*completionItem {
+	before := sf.textBefore(pos)
+	if sf.itemType == itemTypeScript {
+		if openScriptRefPattern.MatchString(before) {
+			return ws.tableCompletions(sf.name)
+		}
+		return []*completionItem{}
+	}
+
+	switch {
+	case openTableRefPattern.MatchString(before):
+		return ws.tableCompletions(sf.name)
+	case openInlineRefPattern.MatchString(before) && sf.tbl != nil:
+		items := make([]*completionItem, 0, len(sf.tbl.Inline))
+		for _, il := range sf.tbl.Inline {
+			item := &completionItem{Label: il.ID, Kind: kindValue}
+			if len(il.Content) > 0 {
+				item.Detail = il.Content[0]
+			}
+			items = append(items, item)
+		}
+		return items
+	}
+	return []*completionItem{}
+}
+
+//every table, named as briefly as it may be from the given table or script
+func (ws *workspace) tableCompletions(from string) []*completionItem {
+	names := make([]string, 0, len(ws.tables))
+	for name := range ws.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	items := make([]*completionItem, 0, len(names))
+	for _, name := range names {
+		label := name
+		if short := name[strings.LastIndex(name, util.NamespaceSeparator)+1:]; ws.resolve(short, from) == name {
+			label = short
+		}
+		item := &completionItem{Label: label, Kind: kindModule}
+		if tbl := ws.tables[name].tbl; tbl != nil {
+			item.Detail = tbl.Definition.Note
+			if item.Detail == "" {
+				item.Detail = fmt.Sprintf("%s table", tbl.Definition.TableType)
+			}
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+//hoverAt shows the chance of rolling each row of the table referred to at the
+//position, or of the row or table being edited
+func (ws *workspace) hoverAt(sf *sourceFile, pos position) *hover {
+	name, row := "", -1
+	var rng *textRange
+	ref, rs := ws.refAt(sf, pos), sf.rowAt(pos)
+	switch {
+	case ref != nil:
+		name, rng = ref.name, &ref.rng
+	case rs != nil:
+		name, row = rs.table, rs.row
+	case sf.tbl != nil && sf.source.DefinitionKey("name").Line-1 == pos.Line:
+		name = sf.name
+	default:
+		return nil
+	}
+
+	var text string
+	ta, err := ws.repo.AnalyzeTable(name)
+	switch {
+	case err != nil:
+		text = err.Error()
+	case row >= 0 && row < len(ta.Rows):
+		text = rowOddsText(ta, ta.Rows[row])
+	default:
+		text = tableOddsText(ta)
+	}
+	return &hover{
+		Contents: markupContent{Kind: "markdown", Value: text},
+		Range:    rng,
+	}
+}
+
+func rowOddsText(ta *tablib.TableAnalysis, ro *tablib.RowOdds) string {
+	if ro.Probability == 0 {
+		return fmt.Sprintf("**%s** row %d can never be rolled on %s", ta.Name, ro.Row, ta.DiceExpr)
+	}
+	return fmt.Sprintf("**%s** row %d: %s on %s, %s", ta.Name, ro.Row, rolls(ro.Low, ro.High),
+		ta.DiceExpr, percent(ro.Probability))
+}
+
+func tableOddsText(ta *tablib.TableAnalysis) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**%s** rolled on %s\n\n", ta.Name, ta.DiceExpr)
+	sb.WriteString("| Roll | Chance | Content |\n| :-- | --: | :-- |\n")
+	for _, ro := range ta.Rows {
+		content := strings.NewReplacer("|", "\\|", "\n", " ").Replace(ro.Content)
+		fmt.Fprintf(&sb, "| %s | %s | %s |\n", rolls(ro.Low, ro.High), percent(ro.Probability), content)
+	}
+	if len(ta.Uncovered) > 0 {
+		fmt.Fprintf(&sb, "\nRolls that select no row: %s, %s\n",
+			strings.Trim(fmt.Sprint(ta.Uncovered), "[]"), percent(ta.UncoveredProbability))
+	}
+	return sb.String()
+}
+
+func rolls(low, high int) string {
+	if low == high {
+		return fmt.Sprintf("%d", low)
+	}
+	return fmt.Sprintf("%d-%d", low, high)
+}
+
+func percent(p float64) string {
+	return fmt.Sprintf("%.1f%%", p*100)
+}
+
+//refAt returns the reference at the position in a file, nil if there is none
+func (ws *workspace) refAt(sf *sourceFile, pos position) *sourceRef {
+	for _, ref := range ws.refs(sf) {
+		if ref.rng.Start.Line == pos.Line && ref.rng.Start.Character <= pos.Character &&
+			pos.Character <= ref.rng.End.Character {
+			return ref
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefinition_shouldFollowReferences(t *testing.T) {
+	ws := newTestWorkspace(t, nil)
+	sundae := ws.files["tables/sundae.yml"]
+
+	tests := []struct {
+		sf   *sourceFile
+		pos  position
+		path string
+		rng  textRange
+	}{
+		{sundae, pos(4, 5), "tables/flavors.yml", rng(1, 8, 15)},   //{@Flavors}
+		{sundae, pos(4, 33), "tables/toppings.yml", rng(1, 8, 16)}, //{2!Toppings}
+		{sundae, pos(5, 14), "tables/sundae.yml", rng(7, 8, 9)},    //{#1}
+		{sundae, pos(10, 12), "tables/flavors.yml", rng(1, 8, 15)}, //{@Flavors} in an inline table
+		{ws.files["tables/dnd/npc.yml"], pos(4, 7), "tables/dnd/names.yml", rng(1, 8, 17)},
+		{ws.files["scripts/order.lua"], pos(4, 32), "tables/flavors.yml", rng(1, 8, 15)},
+	}
+	for _, test := range tests {
+		loc := ws.definitionAt(test.sf, test.pos)
+		if loc == nil || loc.URI != ws.uri(test.path) || loc.Range != test.rng {
+			t.Errorf("Unexpected definition at %s %+v: %+v", test.sf.path, test.pos, loc)
+		}
+	}
+
+	for _, p := range []position{pos(4, 4), pos(4, 18), pos(1, 9)} {
+		if loc := ws.definitionAt(sundae, p); loc != nil {
+			t.Errorf("Expected no definition at %+v: %+v", p, loc)
+		}
+	}
+}
+
+func TestReferences_shouldSearchAllFiles(t *testing.T) {
+	ws := newTestWorkspace(t, nil)
+	flavors := ws.files["tables/flavors.yml"]
+
+	locs := ws.referencesAt(flavors, pos(1, 10), true)
+	expected := []*location{
+		{URI: ws.uri("tables/flavors.yml"), Range: rng(1, 8, 15)},
+		{URI: ws.uri("scripts/order.lua"), Range: rng(4, 29, 38)},
+		{URI: ws.uri("tables/sundae.yml"), Range: rng(4, 5, 15)},
+		{URI: ws.uri("tables/sundae.yml"), Range: rng(10, 9, 19)},
+	}
+	if len(locs) != len(expected) {
+		t.Fatalf("Expected %d references: %+v", len(expected), locs)
+	}
+	for i := range expected {
+		if *locs[i] != *expected[i] {
+			t.Errorf("Expected %+v: %+v", expected[i], locs[i])
+		}
+	}
+
+	//from a reference, without the declaration
+	locs = ws.referencesAt(ws.files["tables/sundae.yml"], pos(4, 25), false)
+	if len(locs) != 1 || locs[0].Range != rng(4, 21, 33) {
+		t.Errorf("Unexpected references: %+v", locs)
+	}
+
+	//to an inline table
+	locs = ws.referencesAt(ws.files["tables/sundae.yml"], pos(9, 10), true)
+	if len(locs) != 2 || locs[0].Range != rng(7, 8, 9) || locs[1].Range != rng(5, 13, 17) {
+		t.Errorf("Unexpected references: %+v", locs)
+	}
+}
+
+func TestCompletion_shouldOfferNames(t *testing.T) {
+	ws := newTestWorkspace(t, nil)
+	labels := func(items []*completionItem) string {
+		names := make([]string, 0, len(items))
+		for _, item := range items {
+			names = append(names, item.Label)
+		}
+		return strings.Join(names, ",")
+	}
+
+	sundae := ws.files["tables/sundae.yml"]
+	items := ws.completionsAt(sundae, pos(4, 7))
+	if l := labels(items); l != "Flavors,Size,Sundae,Toppings,dnd/Names,dnd/Npc" {
+		t.Errorf("Unexpected completions: %s", l)
+	}
+	if items[1].Detail != "range table" || items[1].Kind != kindModule {
+		t.Errorf("Unexpected completion: %+v", items[1])
+	}
+	if l := labels(ws.completionsAt(ws.files["tables/dnd/npc.yml"], pos(4, 7))); l != "Flavors,Size,Sundae,Toppings,Names,Npc" {
+		t.Errorf("Names in the same namespace need not be qualified: %s", l)
+	}
+	if l := labels(ws.completionsAt(sundae, pos(4, 24))); l != "Flavors,Size,Sundae,Toppings,dnd/Names,dnd/Npc" {
+		t.Errorf("Picks should be completed: %s", l)
+	}
+	if l := labels(ws.completionsAt(ws.files["scripts/order.lua"], pos(3, 30))); !strings.HasPrefix(l, "Flavors,") {
+		t.Errorf("Scripts should be completed: %s", l)
+	}
+
+	items = ws.completionsAt(sundae, pos(5, 15))
+	if len(items) != 1 || items[0].Label != "1" || items[0].Detail != "banana" {
+		t.Errorf("Unexpected inline completions: %+v", items)
+	}
+
+	for _, p := range []position{pos(4, 5), pos(4, 16), pos(1, 10)} {
+		if items := ws.completionsAt(sundae, p); len(items) != 0 {
+			t.Errorf("Expected no completions at %+v: %s", p, labels(items))
+		}
+	}
+}
+
+func TestHover_shouldShowOdds(t *testing.T) {
+	ws := newTestWorkspace(t, nil)
+	sundae := ws.files["tables/sundae.yml"]
+
+	h := ws.hoverAt(sundae, pos(5, 7))
+	expected := "**Size** rolled on 1d6\n\n| Roll | Chance | Content |\n| :-- | --: | :-- |\n" +
+		"| 1-4 | 66.7% | small |\n| 5-6 | 33.3% | large |\n"
+	if h == nil || h.Contents.Value != expected || h.Contents.Kind != "markdown" || *h.Range != rng(5, 5, 12) {
+		t.Fatalf("Unexpected hover: %+v", h)
+	}
+
+	if h := ws.hoverAt(ws.files["tables/size.yml"], pos(6, 6)); h == nil ||
+		h.Contents.Value != "**Size** row 1: 5-6 on 1d6, 33.3%" || h.Range != nil {
+		t.Errorf("Unexpected row hover: %+v", h)
+	}
+	if h := ws.hoverAt(sundae, pos(9, 9)); h == nil || h.Contents.Value != "**Sundae.1** row 0: 1 on 1d2, 50.0%" {
+		t.Errorf("Unexpected inline row hover: %+v", h)
+	}
+	if h := ws.hoverAt(sundae, pos(1, 10)); h == nil || !strings.HasPrefix(h.Contents.Value, "**Sundae** rolled on 1d2") {
+		t.Errorf("Unexpected table hover: %+v", h)
+	}
+	if h := ws.hoverAt(sundae, pos(2, 5)); h != nil {
+		t.Errorf("Expected no hover: %+v", h)
+	}
+}
+
+func TestHover_shouldReportMissingTables(t *testing.T) {
+	ws := newTestWorkspace(t, map[string]string{
+		"tables/odd.yml": `definition:
+  name: Odd
+  type: range
+  roll: 1d6
+content:
+  - "{1-2}{@Nowhere}"
+  - "{7}never"`,
+	})
+	odd := ws.files["tables/odd.yml"]
+
+	if h := ws.hoverAt(odd, pos(5, 10)); h == nil || h.Contents.Value != "Table: Nowhere does not exist" {
+		t.Errorf("Unexpected hover: %+v", h)
+	}
+	if h := ws.hoverAt(odd, pos(6, 6)); h == nil || h.Contents.Value != "Table: Odd does not exist" {
+		t.Errorf("Invalid tables cannot be analyzed: %+v", h)
+	}
+}
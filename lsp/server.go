@@ -0,0 +1,319 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//Server is a Language Server Protocol server for a directory of tables and
+//scripts, as loaded by TableRepository.LoadFS. It offers:
+//
+//	diagnostics          the validation results of every file, updated as documents are edited
+//	go to definition     of the tables named by {@table}, {n!table}, {#n} and t.roll("table")
+//	find references      to a table from every table and script in the directory
+//	completion           of table names and inline table ids within references
+//	hover                the chance of rolling each row of a referenced table, or of a row
+//
+//Documents are synchronised in full on every change. Unsaved edits to one
+//document are taken into account in the diagnostics of the others
+type Server struct {
+	ws          *workspace
+	out         io.Writer
+	published   map[string]bool //paths of the files with published diagnostics
+	initialized bool
+	shutdown    bool
+}
+
+type handler func(s *Server, params json.RawMessage) (interface{}, error)
+
+var handlers = map[string]handler{
+	"initialized":                     (*Server).initializedNotification,
+	"shutdown":                        (*Server).shutdownRequest,
+	"textDocument/didOpen":            (*Server).didOpen,
+	"textDocument/didChange":          (*Server).didChange,
+	"textDocument/didSave":            (*Server).reloaded,
+	"textDocument/didClose":           (*Server).didClose,
+	"workspace/didChangeWatchedFiles": (*Server).reloaded,
+	"textDocument/definition":         (*Server).definition,
+	"textDocument/references":         (*Server).references,
+	"textDocument/completion":         (*Server).completion,
+	"textDocument/hover":              (*Server).hover,
+}
+
+//NewServer creates a server for the content directory at root. Clients that
+//name a root when they initialize the server override it
+func NewServer(root string) *Server {
+	return &Server{
+		ws:        newWorkspace(root),
+		published: make(map[string]bool),
+	}
+}
+
+//Serve reads requests from in and writes responses and notifications to out
+//until the client asks the server to exit or in is exhausted. An error is
+//returned if the client exits without first shutting the server down
+func (s *Server) Serve(in io.Reader, out io.Writer) error {
+	s.out = out
+	r := bufio.NewReader(in)
+	for {
+		msg, err := readMessage(r)
+		var re *responseError
+		switch {
+		case errors.As(err, &re): //the request could not be read so its id is unknown
+			if err := s.respond(json.RawMessage("null"), nil, re); err != nil {
+				return err
+			}
+			continue
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return err
+		}
+
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errExitWithoutShutdown
+			}
+			return nil
+		}
+		result, err := s.handle(msg)
+		if msg.isNotification() {
+			if err != nil {
+				s.logMessage(err.Error())
+			}
+			continue
+		}
+		if err := s.respond(msg.ID, result, err); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(msg *message) (interface{}, error) {
+	if msg.Method == "initialize" {
+		return s.initialize(msg.Params)
+	}
+	if !s.initialized {
+		return nil, &responseError{Code: codeServerNotInitialized, Message: "Server is not initialized"}
+	}
+	if s.shutdown {
+		return nil, &responseError{Code: codeInvalidRequest, Message: "Server is shutting down"}
+	}
+	h, found := handlers[msg.Method]
+	if !found && msg.isNotification() && strings.HasPrefix(msg.Method, "$/") {
+		return nil, nil //protocol notifications such as $/cancelRequest may be ignored
+	}
+	if !found {
+		return nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("Method not found: %s", msg.Method)}
+	}
+	return h(s, msg.Params)
+}
+
+func (s *Server) respond(id json.RawMessage, result interface{}, err error) error {
+	resp := &message{ID: id}
+	if err != nil {
+		var re *responseError
+		if !errors.As(err, &re) {
+			re = &responseError{Code: codeInvalidRequest, Message: err.Error()}
+		}
+		resp.Error = re
+		return writeMessage(s.out, resp)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	resp.Result = data
+	return writeMessage(s.out, resp)
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return writeMessage(s.out, &message{Method: method, Params: data})
+}
+
+//messages are logged to the client, there is nowhere else for them to go
+func (s *Server) logMessage(msg string) {
+	s.notify("window/logMessage", &logMessageParams{Type: 1, Message: msg})
+}
+
+func decodeParams(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func (s *Server) initialize(params json.RawMessage) (interface{}, error) {
+	var p initializeParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	switch {
+	case p.RootURI != "":
+		if root, ok := filePath(p.RootURI); ok {
+			s.ws.root = root
+		}
+	case p.RootPath != "":
+		s.ws.root = p.RootPath
+	}
+	if abs, err := filepath.Abs(s.ws.root); err == nil {
+		s.ws.root = abs
+	}
+	s.initialized = true
+	if err := s.ws.load(); err != nil {
+		s.logMessage(fmt.Sprintf("Unable to load content: %v", err))
+	}
+
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"textDocumentSync":   1, //full
+			"definitionProvider": true,
+			"referencesProvider": true,
+			"hoverProvider":      true,
+			"completionProvider": map[string]interface{}{
+				"triggerCharacters": []string{"@", "!", "#", "\"", "'", "/"},
+			},
+		},
+		"serverInfo": map[string]string{"name": "tablib"},
+	}, nil
+}
+
+func (s *Server) initializedNotification(params json.RawMessage) (interface{}, error) {
+	return nil, s.publishDiagnostics()
+}
+
+func (s *Server) shutdownRequest(params json.RawMessage) (interface{}, error) {
+	s.shutdown = true
+	return nil, nil
+}
+
+func (s *Server) didOpen(params json.RawMessage) (interface{}, error) {
+	var p didOpenParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if path, ok := s.ws.pathForURI(p.TextDocument.URI); ok {
+		s.ws.open[path] = p.TextDocument.Text
+	}
+	return s.reloaded(nil)
+}
+
+func (s *Server) didChange(params json.RawMessage) (interface{}, error) {
+	var p didChangeParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	path, ok := s.ws.pathForURI(p.TextDocument.URI)
+	if !ok || len(p.ContentChanges) == 0 {
+		return nil, nil
+	}
+	s.ws.open[path] = p.ContentChanges[len(p.ContentChanges)-1].Text
+	return s.reloaded(nil)
+}
+
+func (s *Server) didClose(params json.RawMessage) (interface{}, error) {
+	var p didCloseParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if path, ok := s.ws.pathForURI(p.TextDocument.URI); ok {
+		delete(s.ws.open, path)
+	}
+	return s.reloaded(nil)
+}
+
+//reloads the workspace after a document or the directory changed
+func (s *Server) reloaded(params json.RawMessage) (interface{}, error) {
+	if err := s.ws.load(); err != nil {
+		return nil, fmt.Errorf("Unable to load content: %v", err)
+	}
+	return nil, s.publishDiagnostics()
+}
+
+//publishes the diagnostics of every file, clearing those of files that are gone
+func (s *Server) publishDiagnostics() error {
+	paths := make([]string, 0, len(s.ws.files))
+	for p := range s.ws.files {
+		paths = append(paths, p)
+	}
+	for p := range s.published {
+		if _, found := s.ws.files[p]; !found {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		diags := make([]*diagnostic, 0)
+		if sf, found := s.ws.files[p]; found {
+			diags = s.ws.diagnostics(sf)
+		}
+		if len(diags) == 0 && !s.published[p] {
+			continue //nothing to say or to clear
+		}
+		s.published[p] = len(diags) > 0
+		if err := s.notify("textDocument/publishDiagnostics",
+			&publishDiagnosticsParams{URI: s.ws.uri(p), Diagnostics: diags}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//the file and position a request is about, nil if the document is not a table
+//or script in the workspace
+func (s *Server) filePosition(params json.RawMessage, p *textDocumentPositionParams) (*sourceFile, error) {
+	if err := decodeParams(params, p); err != nil {
+		return nil, err
+	}
+	return s.ws.fileForURI(p.TextDocument.URI), nil
+}
+
+func (s *Server) definition(params json.RawMessage) (interface{}, error) {
+	var p textDocumentPositionParams
+	sf, err := s.filePosition(params, &p)
+	if sf == nil {
+		return nil, err
+	}
+	return s.ws.definitionAt(sf, p.Position), nil
+}
+
+func (s *Server) references(params json.RawMessage) (interface{}, error) {
+	var p referenceParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	sf := s.ws.fileForURI(p.TextDocument.URI)
+	if sf == nil {
+		return []*location{}, nil
+	}
+	return s.ws.referencesAt(sf, p.Position, p.Context.IncludeDeclaration), nil
+}
+
+func (s *Server) completion(params json.RawMessage) (interface{}, error) {
+	var p textDocumentPositionParams
+	sf, err := s.filePosition(params, &p)
+	if sf == nil {
+		return []*completionItem{}, err
+	}
+	return s.ws.completionsAt(sf, p.Position), nil
+}
+
+func (s *Server) hover(params json.RawMessage) (interface{}, error) {
+	var p textDocumentPositionParams
+	sf, err := s.filePosition(params, &p)
+	if sf == nil {
+		return nil, err
+	}
+	return s.ws.hoverAt(sf, p.Position), nil
+}
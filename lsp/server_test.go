@@ -0,0 +1,221 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+//a client session: the messages to send, built up before the server is run
+type session struct {
+	t   *testing.T
+	in  bytes.Buffer
+	ids int
+}
+
+func (c *session) send(method string, params interface{}, request bool) {
+	msg := &message{Method: method}
+	if request {
+		c.ids++
+		msg.ID = json.RawMessage(fmt.Sprint(c.ids))
+	}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		msg.Params = data
+	}
+	if err := writeMessage(&c.in, msg); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *session) request(method string, params interface{}) {
+	c.send(method, params, true)
+}
+
+func (c *session) notify(method string, params interface{}) {
+	c.send(method, params, false)
+}
+
+//runs the server over the session, returning what it wrote
+func (c *session) serve(s *Server) ([]*message, error) {
+	var out bytes.Buffer
+	err := s.Serve(&c.in, &out)
+	msgs := make([]*message, 0)
+	r := bufio.NewReader(&out)
+	for {
+		msg, readErr := readMessage(r)
+		if readErr == io.EOF {
+			return msgs, err
+		}
+		if readErr != nil {
+			c.t.Fatalf("Unreadable response: %v", readErr)
+		}
+		msgs = append(msgs, msg)
+	}
+}
+
+//the messages with the given method in order, or the responses to requests if ""
+func responses(msgs []*message, method string) []*message {
+	found := make([]*message, 0)
+	for _, msg := range msgs {
+		if (method == "" && msg.Method == "") || (method != "" && msg.Method == method) {
+			found = append(found, msg)
+		}
+	}
+	return found
+}
+
+func TestServer_shouldServeSession(t *testing.T) {
+	dir := workspaceDir(t, map[string]string{
+		"tables/broken.yml": "definition:\n  name: Broken\n  type: flat\ncontent:\n  - \"{@bad name}\"",
+	})
+	ws := newWorkspace(dir)
+	brokenURI := ws.uri("tables/broken.yml")
+	sundaeURI := ws.uri("tables/sundae.yml")
+
+	c := &session{t: t}
+	c.request("initialize", map[string]interface{}{"rootUri": ws.uri("")})
+	c.notify("initialized", struct{}{})
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]string{"uri": brokenURI, "text": "definition:\n  name: Broken\n  type: flat"},
+	})
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]string{"uri": brokenURI},
+		"contentChanges": []map[string]string{{"text": "definition:\n  name: Broken\n  type: flat\ncontent:\n  - \"{@Sundae}\""}},
+	})
+	c.request("textDocument/definition", map[string]interface{}{
+		"textDocument": map[string]string{"uri": sundaeURI},
+		"position":     pos(4, 6),
+	})
+	c.request("textDocument/references", map[string]interface{}{
+		"textDocument": map[string]string{"uri": sundaeURI},
+		"position":     pos(1, 10),
+		"context":      map[string]bool{"includeDeclaration": false},
+	})
+	c.request("textDocument/hover", map[string]interface{}{
+		"textDocument": map[string]string{"uri": sundaeURI},
+		"position":     pos(2, 2),
+	})
+	c.request("textDocument/unknown", struct{}{})
+	c.request("shutdown", nil)
+	c.notify("exit", nil)
+
+	msgs, err := c.serve(NewServer("."))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	resps := responses(msgs, "")
+	if len(resps) != 6 {
+		t.Fatalf("Expected 6 responses: %d", len(resps))
+	}
+	var init struct {
+		Capabilities map[string]interface{} `json:"capabilities"`
+	}
+	if err := json.Unmarshal(resps[0].Result, &init); err != nil || init.Capabilities["definitionProvider"] != true {
+		t.Errorf("Unexpected initialize result: %s", resps[0].Result)
+	}
+	var loc location
+	if err := json.Unmarshal(resps[1].Result, &loc); err != nil || loc.URI != ws.uri("tables/flavors.yml") ||
+		loc.Range != rng(1, 8, 15) {
+		t.Errorf("Unexpected definition: %s", resps[1].Result)
+	}
+	var locs []*location
+	if err := json.Unmarshal(resps[2].Result, &locs); err != nil || len(locs) != 2 ||
+		locs[0].URI != ws.uri("scripts/order.lua") || locs[1].URI != brokenURI {
+		t.Errorf("References should include unsaved edits: %s", resps[2].Result)
+	}
+	if string(resps[3].Result) != "null" || resps[3].Error != nil {
+		t.Errorf("Expected no hover: %+v", resps[3])
+	}
+	if resps[4].Error == nil || resps[4].Error.Code != codeMethodNotFound || string(resps[4].ID) != "5" {
+		t.Errorf("Expected method not found: %+v", resps[4])
+	}
+	if string(resps[5].Result) != "null" || resps[5].Error != nil {
+		t.Errorf("Unexpected shutdown response: %+v", resps[5])
+	}
+
+	//the broken table is reported once loaded, again when opened and once fixed
+	//only the hint that nothing refers to it remains
+	published := make([]*publishDiagnosticsParams, 0)
+	for _, msg := range responses(msgs, "textDocument/publishDiagnostics") {
+		p := &publishDiagnosticsParams{}
+		if err := json.Unmarshal(msg.Params, p); err != nil {
+			t.Fatal(err)
+		}
+		if p.URI == brokenURI {
+			published = append(published, p)
+		}
+	}
+	if len(published) != 3 {
+		t.Fatalf("Expected 3 publications: %+v", published)
+	}
+	if d := published[0].Diagnostics; len(d) != 1 || !strings.Contains(d[0].Message, "Invalid identifier") {
+		t.Errorf("Unexpected diagnostics: %+v", d)
+	}
+	if d := published[1].Diagnostics; len(d) != 1 || d[0].Code != "no-content" {
+		t.Errorf("Unexpected diagnostics: %+v", d)
+	}
+	if d := published[2].Diagnostics; len(d) != 1 || d[0].Severity != severityHint {
+		t.Errorf("Expected errors to be cleared: %+v", d)
+	}
+}
+
+func TestServer_shouldIgnoreProtocolNotifications(t *testing.T) {
+	c := &session{t: t}
+	c.request("initialize", map[string]interface{}{"rootUri": newWorkspace(workspaceDir(t, nil)).uri("")})
+	c.notify("initialized", struct{}{})
+	c.notify("$/cancelRequest", map[string]int{"id": 1})
+	c.notify("$/setTrace", map[string]string{"value": "off"})
+	c.request("$/unknown", struct{}{})
+	c.request("shutdown", nil)
+	c.notify("exit", nil)
+
+	msgs, err := c.serve(NewServer("."))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if logged := responses(msgs, "window/logMessage"); len(logged) != 0 {
+		t.Errorf("Protocol notifications should be ignored: %s", logged[0].Params)
+	}
+	resps := responses(msgs, "")
+	if len(resps) != 3 || resps[1].Error == nil || resps[1].Error.Code != codeMethodNotFound {
+		t.Errorf("Requests should still be answered: %+v", resps)
+	}
+}
+
+func TestServer_shouldRequireInitialize(t *testing.T) {
+	c := &session{t: t}
+	c.request("textDocument/hover", struct{}{})
+	c.in.WriteString("Content-Length: 5\r\n\r\n{bad}")
+	c.notify("exit", nil)
+
+	msgs, err := c.serve(NewServer(t.TempDir()))
+	if err != errExitWithoutShutdown {
+		t.Errorf("Expected exit without shutdown: %v", err)
+	}
+	if len(msgs) != 2 || msgs[0].Error == nil || msgs[0].Error.Code != codeServerNotInitialized {
+		t.Fatalf("Unexpected responses: %+v", msgs)
+	}
+	if msgs[1].Error == nil || msgs[1].Error.Code != codeParseError || string(msgs[1].ID) != "null" {
+		t.Errorf("Unexpected parse error response: %+v", msgs[1])
+	}
+}
+
+func TestServer_shouldStopAtEndOfInput(t *testing.T) {
+	var out bytes.Buffer
+	if err := NewServer(t.TempDir()).Serve(strings.NewReader(""), &out); err != nil || out.Len() != 0 {
+		t.Errorf("Unexpected result: %v %s", err, out.String())
+	}
+	err := NewServer(t.TempDir()).Serve(strings.NewReader("Content-Length: x\r\n\r\n"), &out)
+	if err == nil || !strings.Contains(err.Error(), "Invalid Content-Length") {
+		t.Errorf("Expected a framing error: %v", err)
+	}
+}
@@ -0,0 +1,566 @@
+package lsp
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"tablib"
+	"tablib/table"
+	"tablib/util"
+	"tablib/validate"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+const (
+	itemTypeTable  = "table"
+	itemTypeScript = "script"
+)
+
+var (
+	//table references as found by the execution engine eg {@Foo}, {2!Foo} or {#1}
+	tableRefPattern = regexp.MustCompile(`\{(@|[0-9]+!|#)([^{}]*)\}`)
+
+	//string literal table names passed to the roll and pick functions of the
+	//tables module, as found by the repository's reference graph
+	scriptRefPattern = regexp.MustCompile(`\.\s*(roll|pick)\s*\(\s*(?:"([^"]*)"|'([^']*)')`)
+
+	//where YAML and Lua syntax errors were found
+	yamlErrLinePattern = regexp.MustCompile(`line ([0-9]+)`)
+	luaErrLinePattern  = regexp.MustCompile(`line:([0-9]+)(?:\(column:([0-9]+)\))?`)
+)
+
+//workspace is the content directory as the client sees it: the files on disk
+//with the text of the documents open in the client in place of what is saved.
+//The whole directory is loaded into a new repository whenever it changes, which
+//keeps every cross-file diagnostic current at the cost of reloading content
+//directories that are unusually large
+type workspace struct {
+	root string            //absolute path of the content directory
+	open map[string]string //the text of each open document by its path in the workspace
+
+	repo       tablib.TableRepository
+	references *validate.ValidationResult
+	files      map[string]*sourceFile //every table and script file by path
+	tables     map[string]*sourceFile //table files by table name
+}
+
+//sourceFile is a table or script file as last loaded
+type sourceFile struct {
+	path     string
+	itemType string
+	name     string //qualified name of the table or script, "" if not known
+	lines    []string
+	result   *tablib.FileLoadResult
+
+	//for table files that could be decoded, whether they are valid or not
+	tbl    *table.Table
+	source *table.SourceMap
+	rows   []*rowSpan
+}
+
+//rowSpan is the lines of a content row, including those a long row wraps onto
+type rowSpan struct {
+	table string //the table, or inline table, holding the row
+	row   int
+	start validate.Position
+	last  int //zero based index of the last line of the row
+}
+
+//sourceRef is a reference to a table from a table or script file
+type sourceRef struct {
+	rng  textRange
+	kind string //@, n! or # for tables, roll or pick for scripts
+	name string //the referenced table, resolved as during execution
+}
+
+func newWorkspace(root string) *workspace {
+	return &workspace{
+		root:   root,
+		open:   make(map[string]string),
+		files:  make(map[string]*sourceFile),
+		tables: make(map[string]*sourceFile),
+	}
+}
+
+//load reloads the whole workspace
+func (ws *workspace) load() error {
+	fsys := &overlayFS{base: os.DirFS(ws.root), files: ws.open}
+	repo := tablib.NewTableRepository()
+	report, err := repo.LoadFS(fsys)
+	if err != nil {
+		return err
+	}
+
+	ws.repo = repo
+	ws.references = repo.ValidateReferences()
+	ws.files = make(map[string]*sourceFile, len(report.Files))
+	ws.tables = make(map[string]*sourceFile)
+	for _, f := range report.Files {
+		sf := &sourceFile{
+			path:     f.Path,
+			itemType: f.ItemType,
+			name:     f.Name,
+			lines:    []string{},
+			result:   f,
+		}
+		data, err := fs.ReadFile(fsys, f.Path)
+		if err == nil {
+			sf.lines = splitLines(string(data))
+		}
+		if sf.itemType == itemTypeTable {
+			sf.decode(data)
+
+			//of two files defining the same table, the one the repository kept wins
+			if prev, found := ws.tables[sf.name]; sf.name != "" && (!found || !prev.result.Loaded()) {
+				ws.tables[sf.name] = sf
+			}
+		}
+		ws.files[f.Path] = sf
+	}
+	return nil
+}
+
+//decode parses the table file for navigation. Tables that fail validation are
+//still decoded so that references to and from them can be followed
+func (sf *sourceFile) decode(data []byte) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return
+	}
+	var tbl *table.Table
+	if err := doc.Decode(&tbl); err != nil || tbl == nil || tbl.Definition == nil {
+		return
+	}
+	sf.tbl = tbl
+	sf.source = table.NewSourceMap(sf.path, &doc)
+	sf.rows = make([]*rowSpan, 0)
+	for idx, pos := range sf.source.Rows {
+		sf.rows = append(sf.rows, sf.rowSpan(sf.name, idx, pos))
+	}
+	for i, inline := range sf.source.Inline {
+		if i >= len(tbl.Inline) {
+			break
+		}
+		id := tbl.Inline[i].ID
+		for idx, pos := range inline.Rows {
+			sf.rows = append(sf.rows, sf.rowSpan(util.BuildFullName(sf.name, id), idx, pos))
+		}
+	}
+}
+
+//a row runs on to the following lines that are indented beyond its first
+func (sf *sourceFile) rowSpan(tableName string, row int, pos validate.Position) *rowSpan {
+	first := pos.Line - 1
+	span := &rowSpan{table: tableName, row: row, start: pos, last: first}
+	if first < 0 || first >= len(sf.lines) {
+		return span
+	}
+	base := indent(sf.lines[first])
+	for i := first + 1; i < len(sf.lines); i++ {
+		if strings.TrimSpace(sf.lines[i]) == "" {
+			continue
+		}
+		if indent(sf.lines[i]) <= base {
+			break
+		}
+		span.last = i
+	}
+	return span
+}
+
+//rowAt returns the content row at the given position, nil if there is none.
+//Rows of a flow sequence share a line, the last to start before the position wins
+func (sf *sourceFile) rowAt(pos position) *rowSpan {
+	var found *rowSpan
+	for _, rs := range sf.rows {
+		first := rs.start.Line - 1
+		if pos.Line < first || pos.Line > rs.last {
+			continue
+		}
+		if pos.Line == first && pos.Character < sf.character(first, rs.start.Column-1) {
+			continue
+		}
+		found = rs
+	}
+	return found
+}
+
+//contentLines returns the zero based indexes of the lines holding content rows
+func (sf *sourceFile) contentLines() []int {
+	seen := make(map[int]bool)
+	lines := make([]int, 0)
+	for _, rs := range sf.rows {
+		for i := rs.start.Line - 1; i <= rs.last; i++ {
+			if i >= 0 && !seen[i] {
+				seen[i] = true
+				lines = append(lines, i)
+			}
+		}
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+//refs returns the references to tables made by the file
+func (ws *workspace) refs(sf *sourceFile) []*sourceRef {
+	refs := make([]*sourceRef, 0)
+	if sf.itemType == itemTypeScript {
+		for i, line := range sf.lines {
+			for _, m := range scriptRefPattern.FindAllStringSubmatchIndex(line, -1) {
+				start, end := m[4], m[5]
+				if start == -1 {
+					start, end = m[6], m[7]
+				}
+				refs = append(refs, &sourceRef{
+					rng:  sf.span(i, start-1, end+1), //the name and its quotes
+					kind: line[m[2]:m[3]],
+					name: ws.resolve(line[start:end], sf.name),
+				})
+			}
+		}
+		return refs
+	}
+
+	for _, i := range sf.contentLines() {
+		if i >= len(sf.lines) {
+			continue
+		}
+		line := sf.lines[i]
+		for _, m := range tableRefPattern.FindAllStringSubmatchIndex(line, -1) {
+			ref := &sourceRef{
+				rng:  sf.span(i, m[0], m[1]),
+				kind: line[m[2]:m[3]],
+			}
+			ref.name = ws.refName(ref.kind, line[m[4]:m[5]], sf.name)
+			if ref.name != "" {
+				refs = append(refs, ref)
+			}
+		}
+	}
+	return refs
+}
+
+//the table referred to by a table reference, "" if the reference is malformed
+func (ws *workspace) refName(kind, name, from string) string {
+	if kind != "#" {
+		return ws.resolve(name, from)
+	}
+	if _, err := strconv.Atoi(name); err != nil {
+		return ""
+	}
+	return util.BuildFullName(from, name)
+}
+
+//resolve finds the table an unqualified name refers to as the execution engine
+//would: in the namespace of the referencing item, then its parents and then globally
+func (ws *workspace) resolve(name, from string) string {
+	if util.IsQualified(name) {
+		return name
+	}
+	for ns := util.Namespace(from); ns != ""; ns = util.Namespace(ns) {
+		qualified := util.QualifyName(ns, name)
+		if _, found := ws.tables[qualified]; found {
+			return qualified
+		}
+	}
+	return name
+}
+
+//definition returns where the named table, or inline table, is defined
+func (ws *workspace) definition(name string) (*location, bool) {
+	if sf, found := ws.tables[name]; found && sf.source != nil {
+		pos := sf.source.DefinitionKey("name")
+		return ws.location(sf, pos, sf.tbl.Definition.Name), true
+	}
+
+	//inline tables are named for the table that defines them eg Foo.1
+	idx := strings.LastIndex(name, ".")
+	if idx == -1 {
+		return nil, false
+	}
+	sf, found := ws.tables[name[:idx]]
+	if !found || sf.tbl == nil {
+		return nil, false
+	}
+	for i, il := range sf.tbl.Inline {
+		if il.ID == name[idx+1:] {
+			return ws.location(sf, sf.source.InlineTable(i).Start(), il.ID), true
+		}
+	}
+	return nil, false
+}
+
+//diagnostics returns the problems found in the file, by its own validation and
+//by validating the references between all files
+func (ws *workspace) diagnostics(sf *sourceFile) []*diagnostic {
+	diags := make([]*diagnostic, 0)
+	if sf.result.Err != nil {
+		diags = append(diags, sf.errorDiagnostic(sf.result.Err))
+	}
+	if sf.result.ValidationResult != nil {
+		for _, d := range sf.result.ValidationResult.Diagnostics {
+			diags = append(diags, sf.diagnostic(d))
+		}
+	}
+	for _, d := range ws.references.Diagnostics {
+		if d.File == sf.path {
+			diags = append(diags, sf.diagnostic(d))
+		}
+	}
+
+	//the repository cannot place references made by scripts so they are checked here
+	if sf.itemType == itemTypeScript && sf.result.Loaded() {
+		for _, ref := range ws.refs(sf) {
+			if _, err := ws.repo.List(ref.name, itemTypeTable); err != nil {
+				diags = append(diags, &diagnostic{
+					Range:    ref.rng,
+					Severity: severityError,
+					Code:     string(validate.CodeMissingTable),
+					Source:   "tablib",
+					Message:  fmt.Sprintf("References - Script: %s refers to missing table: %s", sf.name, ref.name),
+				})
+			}
+		}
+	}
+	return diags
+}
+
+//converts a validation diagnostic, unplaced diagnostics are put at the top of the file
+func (sf *sourceFile) diagnostic(d *validate.Diagnostic) *diagnostic {
+	severity := severityError
+	switch {
+	case d.Code == validate.CodeUnreferencedTable:
+		severity = severityHint //tables rolled on directly are often not referenced
+	case d.Severity == validate.SeverityWarn:
+		severity = severityWarning
+	}
+	line, col := 0, 0
+	if d.Position.IsValid() {
+		line, col = d.Line-1, d.Column-1
+	}
+	return &diagnostic{
+		Range:    sf.restOfLine(line, col),
+		Severity: severity,
+		Code:     string(d.Code),
+		Source:   "tablib",
+		Message:  fmt.Sprintf("%s - %s", d.Section, d.Message),
+	}
+}
+
+//converts an error loading the file, placing it on the line named by YAML and
+//Lua syntax errors
+func (sf *sourceFile) errorDiagnostic(err error) *diagnostic {
+	line, col := 0, 0
+	pattern := yamlErrLinePattern
+	if sf.itemType == itemTypeScript {
+		pattern = luaErrLinePattern
+	}
+	if m := pattern.FindStringSubmatch(err.Error()); m != nil {
+		line, _ = strconv.Atoi(m[1])
+		line--
+		if len(m) > 2 && m[2] != "" {
+			col, _ = strconv.Atoi(m[2])
+			col--
+		}
+	}
+	return &diagnostic{
+		Range:    sf.restOfLine(line, col),
+		Severity: severityError,
+		Source:   "tablib",
+		Message:  err.Error(),
+	}
+}
+
+//the range from a zero based line and rune column to the end of the line
+func (sf *sourceFile) restOfLine(line, col int) textRange {
+	if line < 0 || line >= len(sf.lines) {
+		return textRange{}
+	}
+	text := strings.TrimRight(sf.lines[line], " \t")
+	if col < 0 || col > utf8.RuneCountInString(text) {
+		col = 0
+	}
+	return textRange{
+		Start: position{Line: line, Character: sf.character(line, col)},
+		End:   position{Line: line, Character: utf16Len(text)},
+	}
+}
+
+//the range of the given bytes of a zero based line
+func (sf *sourceFile) span(line, start, end int) textRange {
+	text := sf.lines[line]
+	return textRange{
+		Start: position{Line: line, Character: utf16Len(text[:start])},
+		End:   position{Line: line, Character: utf16Len(text[:end])},
+	}
+}
+
+//the LSP character of the given zero based rune column of a zero based line
+func (sf *sourceFile) character(line, col int) int {
+	if line < 0 || line >= len(sf.lines) {
+		return col
+	}
+	runes := []rune(sf.lines[line])
+	if col > len(runes) {
+		col = len(runes)
+	}
+	return len(utf16.Encode(runes[:col]))
+}
+
+//the text of a zero based line up to the given LSP character
+func (sf *sourceFile) textBefore(pos position) string {
+	if pos.Line < 0 || pos.Line >= len(sf.lines) {
+		return ""
+	}
+	text := sf.lines[pos.Line]
+	units := 0
+	for i, r := range text {
+		if units >= pos.Character {
+			return text[:i]
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return text
+}
+
+//the location of text starting at a position in the file
+func (ws *workspace) location(sf *sourceFile, pos validate.Position, text string) *location {
+	line, col := pos.Line-1, pos.Column-1
+	start := sf.character(line, col)
+	return &location{
+		URI: ws.uri(sf.path),
+		Range: textRange{
+			Start: position{Line: line, Character: start},
+			End:   position{Line: line, Character: start + utf16Len(text)},
+		},
+	}
+}
+
+//fileForURI returns the loaded file of a document, nil if it is not a table
+//or script in the workspace
+func (ws *workspace) fileForURI(uri string) *sourceFile {
+	p, ok := ws.pathForURI(uri)
+	if !ok {
+		return nil
+	}
+	return ws.files[p]
+}
+
+//the slash separated path of a document within the workspace
+func (ws *workspace) pathForURI(uri string) (string, bool) {
+	p, ok := filePath(uri)
+	if !ok {
+		return "", false
+	}
+	rel, err := filepath.Rel(ws.root, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+func (ws *workspace) uri(p string) string {
+	u := &url.URL{
+		Scheme: "file",
+		Path:   filepath.ToSlash(filepath.Join(ws.root, filepath.FromSlash(p))),
+	}
+	return u.String()
+}
+
+//the file system path of a file URI
+func filePath(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return "", false
+	}
+	return filepath.FromSlash(u.Path), true
+}
+
+func splitLines(text string) []string {
+	lines := strings.Split(text, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSuffix(l, "\r")
+	}
+	return lines
+}
+
+func indent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+//overlayFS is a file system in which the given files replace, or are added
+//to, those of the base file system
+type overlayFS struct {
+	base  fs.FS
+	files map[string]string //file contents by path
+}
+
+func (o *overlayFS) Open(name string) (fs.File, error) {
+	if text, found := o.files[name]; found {
+		return &memFile{Reader: strings.NewReader(text), info: memFileInfo{name: path.Base(name), size: int64(len(text))}}, nil
+	}
+	return o.base.Open(name)
+}
+
+func (o *overlayFS) ReadFile(name string) ([]byte, error) {
+	if text, found := o.files[name]; found {
+		return []byte(text), nil
+	}
+	return fs.ReadFile(o.base, name)
+}
+
+//ReadDir lists the directory in the base file system along with any of the
+//files that are in it but not yet saved there
+func (o *overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(o.base, name)
+	if err != nil {
+		return nil, err
+	}
+	listed := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		listed[e.Name()] = true
+	}
+	for p, text := range o.files {
+		if path.Dir(p) == name && !listed[path.Base(p)] {
+			info := memFileInfo{name: path.Base(p), size: int64(len(text))}
+			entries = append(entries, fs.FileInfoToDirEntry(info))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+type memFile struct {
+	*strings.Reader
+	info memFileInfo
+}
+
+func (mf *memFile) Stat() (fs.FileInfo, error) { return mf.info, nil }
+func (mf *memFile) Close() error               { return nil }
+
+type memFileInfo struct {
+	name string
+	size int64
+}
+
+func (mfi memFileInfo) Name() string       { return mfi.name }
+func (mfi memFileInfo) Size() int64        { return mfi.size }
+func (mfi memFileInfo) Mode() fs.FileMode  { return 0444 }
+func (mfi memFileInfo) ModTime() time.Time { return time.Time{} }
+func (mfi memFileInfo) IsDir() bool        { return false }
+func (mfi memFileInfo) Sys() interface{}   { return nil }
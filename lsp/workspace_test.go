@@ -0,0 +1,216 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var content = map[string]string{
+	"tables/flavors.yml": `definition:
+  name: Flavors
+  type: flat
+content:
+  - chocolate
+  - vanilla`,
+	"tables/toppings.yml": `definition:
+  name: Toppings
+  type: flat
+content:
+  - nuts
+  - sprinkles
+  - fudge`,
+	"tables/size.yml": `definition:
+  name: Size
+  type: range
+  roll: 1d6
+content:
+  - "{1-4}small"
+  - "{5-6}large"`,
+	"tables/sundae.yml": `definition:
+  name: Sundae
+  type: flat
+content:
+  - "{@Flavors} with {2!Toppings}"
+  - "{@Size} {#1} sundae"
+inline:
+  - id: 1
+    content:
+      - banana
+      - "{@Flavors} cone"`,
+	"tables/dnd/names.yml": `definition:
+  name: dnd/Names
+  type: flat
+content:
+  - Bob`,
+	"tables/dnd/npc.yml": `definition:
+  name: dnd/Npc
+  type: flat
+content:
+  - "{@Names} the bold"`,
+	"scripts/order.lua": `local t = require("tables")
+results = {}
+function main()
+  results["sundae"] = t.roll("Sundae")
+  results["flavor"] = t.pick('Flavors', 1)
+end`,
+}
+
+//a workspace directory holding the content, with the extra files added over it
+func workspaceDir(t *testing.T, extra map[string]string) string {
+	dir := t.TempDir()
+	for _, files := range []map[string]string{content, extra} {
+		for name, data := range files {
+			p := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return dir
+}
+
+func newTestWorkspace(t *testing.T, extra map[string]string) *workspace {
+	ws := newWorkspace(workspaceDir(t, extra))
+	if err := ws.load(); err != nil {
+		t.Fatalf("Unable to load workspace: %v", err)
+	}
+	return ws
+}
+
+func pos(line, character int) position {
+	return position{Line: line, Character: character}
+}
+
+func rng(line, start, end int) textRange {
+	return textRange{Start: pos(line, start), End: pos(line, end)}
+}
+
+func TestWorkspace_shouldLoadContent(t *testing.T) {
+	ws := newTestWorkspace(t, nil)
+
+	if len(ws.files) != len(content) {
+		t.Errorf("Expected %d files: %v", len(content), ws.files)
+	}
+	sf := ws.tables["dnd/Npc"]
+	if sf == nil || sf.path != "tables/dnd/npc.yml" || sf.tbl == nil || !sf.result.Loaded() {
+		t.Fatalf("Unexpected table file: %+v", sf)
+	}
+	if len(ws.files["scripts/order.lua"].lines) != 6 {
+		t.Errorf("Unexpected script lines: %v", ws.files["scripts/order.lua"].lines)
+	}
+	for p, sf := range ws.files {
+		for _, d := range ws.diagnostics(sf) {
+			if d.Severity != severityHint {
+				t.Errorf("Unexpected diagnostic in %s: %+v", p, d)
+			}
+		}
+	}
+}
+
+func TestWorkspace_shouldPlaceDiagnostics(t *testing.T) {
+	ws := newTestWorkspace(t, map[string]string{
+		"tables/broken.yml": `definition:
+  name: Broken
+  type: flat
+content:
+  - "{@bad name}"`,
+		"tables/syntax.yml": `definition:
+  name: Syntax
+ type: flat`,
+		"scripts/syntax.lua": `function main(
+  x = = 1
+end`,
+		"scripts/missing.lua": `local t = require("tables")
+function main()
+  return t.roll("Nowhere")
+end`,
+	})
+
+	diags := ws.diagnostics(ws.files["tables/broken.yml"])
+	if len(diags) != 1 || diags[0].Range != rng(4, 4, 17) || diags[0].Severity != severityError ||
+		!strings.HasPrefix(diags[0].Message, "Content - Invalid identifier") || diags[0].Source != "tablib" {
+		t.Errorf("Unexpected diagnostics: %+v", diags)
+	}
+
+	diags = ws.diagnostics(ws.files["tables/syntax.yml"])
+	if len(diags) != 1 || diags[0].Range != rng(1, 0, 14) || diags[0].Message != "yaml: line 2: did not find expected key" {
+		t.Errorf("Unexpected diagnostics: %+v", diags)
+	}
+
+	diags = ws.diagnostics(ws.files["scripts/syntax.lua"])
+	if len(diags) != 1 || diags[0].Range != rng(1, 4, 9) || !strings.Contains(diags[0].Message, "syntax error") {
+		t.Errorf("Unexpected diagnostics: %+v", diags)
+	}
+
+	diags = ws.diagnostics(ws.files["scripts/missing.lua"])
+	if len(diags) != 1 || diags[0].Range != rng(2, 16, 25) || diags[0].Code != "missing-table" ||
+		diags[0].Message != "References - Script: missing refers to missing table: Nowhere" {
+		t.Errorf("Unexpected diagnostics: %+v", diags)
+	}
+
+	diags = ws.diagnostics(ws.files["tables/dnd/npc.yml"])
+	if len(diags) != 1 || diags[0].Severity != severityHint || diags[0].Range != rng(0, 0, 11) {
+		t.Errorf("Unreferenced tables should be hinted at: %+v", diags)
+	}
+}
+
+func TestWorkspace_shouldPreferOpenDocuments(t *testing.T) {
+	ws := newTestWorkspace(t, nil)
+	ws.open["tables/flavors.yml"] = strings.Replace(content["tables/flavors.yml"], "name: Flavors", "name: Tastes", 1)
+	ws.open["tables/unsaved.yml"] = "definition:\n  name: Unsaved\n  type: flat\ncontent:\n  - \"{@Flavors}\""
+	if err := ws.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, found := ws.tables["Flavors"]; found {
+		t.Error("The saved table should be replaced by the open document")
+	}
+	if sf := ws.tables["Tastes"]; sf == nil || sf.path != "tables/flavors.yml" {
+		t.Errorf("Unexpected table file: %+v", sf)
+	}
+	sf := ws.files["tables/unsaved.yml"]
+	if sf == nil || sf.name != "Unsaved" {
+		t.Fatalf("Unsaved documents should be loaded: %+v", sf)
+	}
+
+	//every reference to the renamed table is now missing
+	diags := ws.diagnostics(sf)
+	if len(diags) != 2 || diags[0].Code != "missing-table" || diags[0].Range != rng(4, 4, 16) {
+		t.Errorf("Unexpected diagnostics: %+v", diags)
+	}
+}
+
+func TestWorkspace_shouldConvertURIs(t *testing.T) {
+	ws := newWorkspace("/content")
+
+	if p, ok := ws.pathForURI("file:///content/tables/my%20table.yml"); !ok || p != "tables/my table.yml" {
+		t.Errorf("Unexpected path: %s %v", p, ok)
+	}
+	for _, uri := range []string{"file:///elsewhere/a.yml", "http://content/a.yml", "file:///content/../a.yml"} {
+		if p, ok := ws.pathForURI(uri); ok {
+			t.Errorf("Expected %s to be outside the workspace: %s", uri, p)
+		}
+	}
+	if uri := ws.uri("tables/my table.yml"); uri != "file:///content/tables/my%20table.yml" {
+		t.Errorf("Unexpected URI: %s", uri)
+	}
+}
+
+func TestSourceFile_shouldCountUTF16(t *testing.T) {
+	sf := &sourceFile{lines: []string{`  - "é𝄞 {@Foo}"`}}
+
+	if c := sf.character(0, 7); c != 8 {
+		t.Errorf("Unexpected character: %d", c)
+	}
+	if r := sf.span(0, strings.Index(sf.lines[0], "{"), len(sf.lines[0])-1); r != rng(0, 9, 15) {
+		t.Errorf("Unexpected range: %+v", r)
+	}
+	if before := sf.textBefore(pos(0, 9)); before != `  - "é𝄞 ` {
+		t.Errorf("Unexpected text: %q", before)
+	}
+}
@@ -1,24 +1,39 @@
 package tablib
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"sort"
+	"strconv"
 	"strings"
+	"tablib/dice"
 
 	"github.com/yuin/gopher-lua"
 )
 
 type luaModule struct {
-	repo TableRepository
+	ctx        context.Context
+	repo       TableRepository
+	nameSvc    nameResolver
+	scriptName string //table names used by the script are resolved relative to it
+	rnd        RandomSource
+	limiter    *scriptLimiter
 }
 
 const (
 	badDiceRollInteger = -9999
 )
 
-func newLuaModule(r TableRepository) *luaModule {
+func newLuaModule(ctx context.Context, r TableRepository, nameSvc nameResolver, scriptName string,
+	rnd RandomSource, limiter *scriptLimiter) *luaModule {
 	return &luaModule{
-		repo: r,
+		ctx:        ctx,
+		repo:       r,
+		nameSvc:    nameSvc,
+		scriptName: scriptName,
+		rnd:        rnd,
+		limiter:    limiter,
 	}
 }
 
@@ -29,10 +44,11 @@ func (lm *luaModule) luaModuleLoader(L *lua.LState) int {
 	//function as it is exposed to lua and the value is a pointer to an LGFunction
 	//(a function type specified in the gopher-lua lib)
 	exportedGoFuncs := map[string]lua.LGFunction{
-		"roll":   lm.rollOnTable,
-		"pick":   lm.pickFromTable,
-		"dice":   lm.evalDiceExpression,
-		"concat": lm.concatTableToString,
+		"roll":          lm.rollOnTable,
+		"pick":          lm.pickFromTable,
+		"dice":          lm.evalDiceExpression,
+		"diceBreakdown": lm.explainDiceExpression,
+		"concat":        lm.concatTableToString,
 	}
 
 	//make the above functions available to lua via module
@@ -43,6 +59,68 @@ func (lm *luaModule) luaModuleLoader(L *lua.LState) int {
 	return 1
 }
 
+//replaceMathRandom swaps the lua math lib's random functions for versions that
+//use the repository's random source. Stock math.random uses the Go global
+//generator (and math.randomseed reseeds it for the whole process!) which
+//would make scripts irreproducible even with a seeded repository
+func (lm *luaModule) replaceMathRandom(lState *lua.LState) {
+	mathMod, ok := lState.GetGlobal(lua.MathLibName).(*lua.LTable)
+	if !ok { //math lib not loaded in this VM, nothing to replace
+		return
+	}
+	lState.SetField(mathMod, "random", lState.NewFunction(lm.mathRandom))
+	lState.SetField(mathMod, "randomseed", lState.NewFunction(lm.mathRandomSeed))
+}
+
+//mathRandom mirrors the semantics of the lua math.random function
+func (lm *luaModule) mathRandom(lState *lua.LState) int {
+	switch lState.GetTop() {
+	case 0: //float in [0,1)
+		lState.Push(lua.LNumber(lm.randomFloat()))
+	case 1: //int in [1,m]
+		upper := lState.CheckInt(1)
+		if upper < 1 {
+			lState.ArgError(1, "interval is empty")
+		}
+		lState.Push(lua.LNumber(lm.rnd.Intn(upper) + 1))
+	default: //int in [m,n]
+		lower := lState.CheckInt(1)
+		upper := lState.CheckInt(2)
+		if upper < lower {
+			lState.ArgError(2, "interval is empty")
+		}
+		//the count of values in the interval must fit an int. The bounds are also
+		//compared as numbers as CheckInt wraps those too large for an int
+		span := upper - lower
+		if span < 0 || span == math.MaxInt || float64(lState.CheckNumber(2))-float64(lState.CheckNumber(1)) >= math.MaxInt {
+			lState.ArgError(2, "interval is too large")
+		}
+		lState.Push(lua.LNumber(lm.rnd.Intn(upper-lower+1) + lower))
+	}
+	return 1
+}
+
+//the number of floats in [0,1) math.random can produce, 2^53. Held in a variable so
+//the conversion to int below is made at run time and compiles where an int is 32 bits
+var randomFloats int64 = 1 << 53
+
+//randomFloat returns a float in [0,1) made from 53 random bits. Where an int
+//holds them they are drawn at once, otherwise they are drawn as 27 high and 26
+//low bits, each of which fits an int32
+func (lm *luaModule) randomFloat() float64 {
+	if strconv.IntSize == 64 {
+		return float64(lm.rnd.Intn(int(randomFloats))) / float64(randomFloats)
+	}
+	hi := int64(lm.rnd.Intn(1 << 27))
+	lo := int64(lm.rnd.Intn(1 << 26))
+	return float64(hi<<26|lo) / float64(randomFloats)
+}
+
+//mathRandomSeed is a no-op - seeding is controlled by the repository
+func (lm *luaModule) mathRandomSeed(lState *lua.LState) int {
+	return 0
+}
+
 //rollOnTable is the lua-visible wrapper function for TableRepository.Roll()
 func (lm *luaModule) rollOnTable(lState *lua.LState) int {
 
@@ -64,8 +142,12 @@ func (lm *luaModule) rollOnTable(lState *lua.LState) int {
 	tblName := lState.ToString(1)
 
 	//Actually roll on the table specified in the lua script
-	tr := lm.repo.Roll(tblName, 1) //always roll once in scripts
-	if len(tr.Result) == 0 {       //problem during execution - tack on message
+	tblName = lm.nameSvc.resolveTableName(tblName, lm.scriptName)
+	tr := lm.repo.RollContext(lm.ctx, tblName, 1) //always roll once in scripts
+	if tr.Err != nil {                            //execution halted - report why
+		tr.Result = []string{fmt.Sprintf("ERROR: %v", tr.Err)}
+	}
+	if len(tr.Result) == 0 { //problem during execution - tack on message
 		tr.AddResult(fmt.Sprintf("ERROR: The roll failed. Does the table: %s exist?", tblName))
 	}
 
@@ -104,7 +186,11 @@ func (lm *luaModule) pickFromTable(lState *lua.LState) int {
 	count := lState.ToInt(2)
 
 	//Actually roll on the table specified in the lua script
-	tr := lm.repo.Pick(tblName, count)
+	tblName = lm.nameSvc.resolveTableName(tblName, lm.scriptName)
+	tr := lm.repo.PickContext(lm.ctx, tblName, count)
+	if tr.Err != nil { //execution halted - report why
+		tr.Result = []string{fmt.Sprintf("ERROR: %v", tr.Err)}
+	}
 	if len(tr.Result) == 0 { //problem during execution - tack on message
 		tr.AddResult(fmt.Sprintf("ERROR: The pick failed. Does the table: %s exist?", tblName))
 	}
@@ -144,6 +230,75 @@ func (lm *luaModule) evalDiceExpression(lState *lua.LState) int {
 	return 1
 }
 
+//explainDiceExpression is the lua-visible wrapper function for
+//TableRepository.ExplainDiceExpression(). It returns the breakdown as a lua table
+//or nil and an error message if the expression is not valid
+func (lm *luaModule) explainDiceExpression(lState *lua.LState) int {
+
+	//confirm arg is a single string
+	argCount := lState.GetTop() //gets count of args passed onto stack
+	if argCount != 1 || lState.Get(1).Type() != lua.LTString {
+		lState.Push(lua.LNil)
+		lState.Push(lua.LString("diceBreakdown(dice-expression) requires a single string parameter"))
+		return 2
+	}
+
+	bd, err := lm.repo.ExplainDiceExpression(lState.ToString(1))
+	if err != nil {
+		lState.Push(lua.LNil)
+		lState.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	//the top of the breakdown also carries the total and a one line summary
+	tbl := breakdownToLuaTable(lState, bd)
+	tbl.RawSetString("total", lua.LNumber(bd.Value))
+	tbl.RawSetString("text", lua.LString(bd.String()))
+	lState.Push(tbl)
+	return 1
+}
+
+//converts a dice breakdown to a lua table with fields named as in dice.Breakdown
+//and dice.Die but in lower case
+func breakdownToLuaTable(lState *lua.LState, bd *dice.Breakdown) *lua.LTable {
+	tbl := lState.NewTable()
+	tbl.RawSetString("kind", lua.LString(bd.Kind))
+	tbl.RawSetString("expr", lua.LString(bd.Expr))
+	tbl.RawSetString("value", lua.LNumber(bd.Value))
+	if bd.Op != "" {
+		tbl.RawSetString("op", lua.LString(bd.Op))
+	}
+	if bd.Kind == dice.KindRoll {
+		dieTbls := lState.NewTable()
+		for _, die := range bd.Dice {
+			dieTbl := lState.NewTable()
+			dieTbl.RawSetString("value", lua.LNumber(die.Value))
+			dieTbl.RawSetString("faces", intsToLuaTable(lState, die.Faces))
+			dieTbl.RawSetString("rerolled", intsToLuaTable(lState, die.Rerolled))
+			dieTbl.RawSetString("exploded", lua.LBool(die.Exploded))
+			dieTbl.RawSetString("kept", lua.LBool(die.Kept))
+			dieTbls.Append(dieTbl)
+		}
+		tbl.RawSetString("dice", dieTbls)
+	}
+	if len(bd.Terms) > 0 {
+		terms := lState.NewTable()
+		for _, term := range bd.Terms {
+			terms.Append(breakdownToLuaTable(lState, term))
+		}
+		tbl.RawSetString("terms", terms)
+	}
+	return tbl
+}
+
+func intsToLuaTable(lState *lua.LState, values []int) *lua.LTable {
+	tbl := lState.NewTable()
+	for _, v := range values {
+		tbl.Append(lua.LNumber(v))
+	}
+	return tbl
+}
+
 //concatTableToString is the lua-visible function to efficiently concatinate
 //strings. Lua doesn't offer a string builder nor does it offer graceful and
 //efficient string concatination for several small strings
@@ -169,7 +324,14 @@ func (lm *luaModule) concatTableToString(lState *lua.LState) int {
 		}
 		sort.Strings(sortedKeys)
 
+		size := 0
+		for _, val := range asGoMap {
+			size += len(val)
+		}
+		lm.limiter.allocate(lState, size)
+
 		var sb strings.Builder
+		sb.Grow(size)
 		for _, key := range sortedKeys {
 			sb.WriteString(asGoMap[key])
 		}
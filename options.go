@@ -0,0 +1,168 @@
+package tablib
+
+import "time"
+
+//RepositoryOption configures a TableRepository when it is created. Options are
+//passed to NewTableRepository and applied in order
+type RepositoryOption func(*concreteTableRepo)
+
+//WithSeed seeds the random number generator used by the repository. A repository
+//created with a given seed will produce identical results for an identical
+//sequence of calls to Roll, Pick, Execute and EvaluateDiceExpression. This is
+//useful to replay a result from a bug report or to write golden tests.
+//
+//Note that results are only reproducible if the calls are made in the same
+//order - concurrent callers share the same random stream
+func WithSeed(seed int64) RepositoryOption {
+	return WithRandomSource(NewSeededRandomSource(seed))
+}
+
+//WithRandomSource replaces the repository's random number generator with the
+//given source. See RandomSource for the built-in implementations
+func WithRandomSource(src RandomSource) RepositoryOption {
+	return func(cr *concreteTableRepo) {
+		if src != nil {
+			cr.rnd = src
+		}
+	}
+}
+
+//WithMaxCallDepth sets how deeply tables may refer to other tables, including
+//themselves, before a request is halted with a LimitError. The default is 100.
+//Values less than 1 are ignored
+func WithMaxCallDepth(depth int) RepositoryOption {
+	return func(cr *concreteTableRepo) {
+		if depth > 0 {
+			cr.config.maxCallDepth = depth
+		}
+	}
+}
+
+//WithMaxRollCount sets the largest count that may be passed to Roll. Requests
+//for more rolls fail with a LimitError without rolling. The default is 100.
+//Values less than 1 are ignored
+func WithMaxRollCount(count int) RepositoryOption {
+	return func(cr *concreteTableRepo) {
+		if count > 0 {
+			cr.config.maxRollCount = count
+		}
+	}
+}
+
+//WithPickDelimiter sets the string used to join the items of a pick. The
+//default is "|"
+func WithPickDelimiter(delim string) RepositoryOption {
+	return func(cr *concreteTableRepo) {
+		cr.config.pickDelim = delim
+	}
+}
+
+//WithCallbackTimeout sets how long a script waits for the caller's
+//ParamSpecificationRequestCallback to respond before using default parameter
+//values. The default is 30 seconds. Values less than 1 are ignored
+func WithCallbackTimeout(timeout time.Duration) RepositoryOption {
+	return func(cr *concreteTableRepo) {
+		if timeout > 0 {
+			cr.config.callbackTimeout = timeout
+		}
+	}
+}
+
+//WithMaxExpansions sets the number of times a single Roll or Pick may roll or
+//pick on a table or roll dice, counting those needed to expand table refs,
+//before it is halted with a LimitError. Tables that refer to other tables
+//several times over can otherwise grow exponentially without ever recursing
+//too deeply. The default is 10000. Values less than 1 are ignored
+func WithMaxExpansions(count int) RepositoryOption {
+	return func(cr *concreteTableRepo) {
+		if count > 0 {
+			cr.config.maxExpansions = count
+		}
+	}
+}
+
+//WithMaxOutputSize sets the largest number of bytes a single Roll or Pick may
+//generate across all of its results. A request that generates more is halted
+//with a LimitError. The default is 1MB. Values less than 1 are ignored
+func WithMaxOutputSize(bytes int) RepositoryOption {
+	return func(cr *concreteTableRepo) {
+		if bytes > 0 {
+			cr.config.maxOutputSize = bytes
+		}
+	}
+}
+
+//WithScriptTimeout sets how long a Lua script may run before it is terminated
+//with a LimitError. Time spent waiting for a ParamSpecificationRequestCallback
+//counts. The default is 30 seconds. Values less than 1 are ignored
+func WithScriptTimeout(timeout time.Duration) RepositoryOption {
+	return func(cr *concreteTableRepo) {
+		if timeout > 0 {
+			cr.config.scriptTimeout = timeout
+		}
+	}
+}
+
+//WithScriptCallStackSize sets how deeply Lua functions may call one another
+//before a script is terminated with a LimitError. The default is 256. Values
+//less than 1 are ignored
+func WithScriptCallStackSize(size int) RepositoryOption {
+	return func(cr *concreteTableRepo) {
+		if size > 0 {
+			cr.config.scriptCallStackSize = size
+		}
+	}
+}
+
+//WithScriptRegistrySize sets the number of values the Lua data stack may hold
+//before a script is terminated with a LimitError. Local variables, function
+//arguments and temporaries all use the data stack. The default is 5120. Values
+//less than 128 are ignored
+func WithScriptRegistrySize(size int) RepositoryOption {
+	return func(cr *concreteTableRepo) {
+		if size >= 128 {
+			cr.config.scriptRegistrySize = size
+		}
+	}
+}
+
+//WithScriptMemoryLimit sets the number of bytes a Lua script may use before it
+//is terminated with a LimitError. Strings built by the string, table and tables
+//library functions (eg string.rep, table.concat) are counted as they are built.
+//The strings and tables the script holds, however they were built, are
+//measured periodically as it runs so a script may briefly hold somewhat more
+//than the limit before it is stopped. The default is 64MB. Values less than 1
+//are ignored
+func WithScriptMemoryLimit(bytes int) RepositoryOption {
+	return func(cr *concreteTableRepo) {
+		if bytes > 0 {
+			cr.config.scriptMemory = bytes
+		}
+	}
+}
+
+//CollisionPolicy decides what AddTable does when a table of the same name is
+//already in the repository
+type CollisionPolicy int
+
+const (
+	//CollisionReplace replaces the existing table. This is the default
+	CollisionReplace CollisionPolicy = iota
+
+	//CollisionWarn replaces the existing table and adds a warning to the
+	//ValidationResult
+	CollisionWarn
+
+	//CollisionError keeps the existing table and returns ErrTableExists
+	CollisionError
+)
+
+//WithCollisionPolicy sets what AddTable, LoadFS and LoadFSNamespace do when a
+//table is given the name of a table already in the repository. Tables may be
+//placed in namespaces (eg dnd5e/names) to keep content from different sources
+//apart. Scripts are always replaced
+func WithCollisionPolicy(policy CollisionPolicy) RepositoryOption {
+	return func(cr *concreteTableRepo) {
+		cr.collisions = policy
+	}
+}
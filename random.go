@@ -0,0 +1,136 @@
+package tablib
+
+import (
+	crand "crypto/rand"
+	"math/big"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//RandomSource supplies the random numbers used to roll dice, select table rows
+//and pick table entries. A single RandomSource is shared by every execution in
+//a repository, so implementations must be safe for concurrent use.
+type RandomSource interface {
+
+	//Intn returns a random int in [0,n). The engine never calls Intn with n <= 0
+	Intn(n int) int
+}
+
+//NewSeededRandomSource returns a RandomSource backed by math/rand. The same
+//seed always produces the same sequence of numbers
+func NewSeededRandomSource(seed int64) RandomSource {
+	return &seededSource{
+		rnd:  rand.New(rand.NewSource(seed)),
+		lock: &sync.Mutex{},
+	}
+}
+
+//NewCryptoRandomSource returns a RandomSource backed by crypto/rand. It is
+//considerably slower than the other sources but its results cannot be
+//predicted, making it suitable for prize draws and the like. Results are
+//never reproducible.
+func NewCryptoRandomSource() RandomSource {
+	return &cryptoSource{}
+}
+
+//NewCounterRandomSource returns a RandomSource whose n-th value is a pure
+//function of seed, stream and n. Sources sharing a seed but using distinct
+//streams produce independent sequences, so parallel shards can each own a
+//source without coordinating with one another.
+func NewCounterRandomSource(seed uint64, stream uint64) RandomSource {
+	return &counterSource{
+		key: splitmix64(seed ^ splitmix64(stream)),
+	}
+}
+
+//NewScriptedRandomSource returns a RandomSource that replays the given die
+//faces in order, which is handy for unit tests. Each face is 1-based, so a
+//face of 3 makes a roll on a flat table return its 3rd row and makes a d6
+//come up 3. Faces larger than the die being rolled wrap around. Once all faces
+//are used the sequence starts over. With no faces, every roll is a 1.
+func NewScriptedRandomSource(faces ...int) RandomSource {
+	return &scriptedSource{
+		faces: faces,
+		lock:  &sync.Mutex{},
+	}
+}
+
+//seededSource is a goroutine-safe wrapper around math/rand
+type seededSource struct {
+	rnd  *rand.Rand
+	lock *sync.Mutex
+}
+
+func newTimeSeededSource() RandomSource {
+	return NewSeededRandomSource(time.Now().UnixNano())
+}
+
+func (ss *seededSource) Intn(n int) int {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	return ss.rnd.Intn(n)
+}
+
+type cryptoSource struct{}
+
+func (cs *cryptoSource) Intn(n int) int {
+	val, err := crand.Int(crand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		//the system's secure random generator is broken, there is no
+		//reasonable way to continue
+		panic(err)
+	}
+	return int(val.Int64())
+}
+
+type counterSource struct {
+	key     uint64
+	counter uint64
+}
+
+func (cs *counterSource) Intn(n int) int {
+	//reject values from the top, partial 'bucket' of the uint64 space to
+	//avoid modulo bias
+	bound := uint64(n)
+	limit := ^uint64(0) - (^uint64(0) % bound)
+	for {
+		next := atomic.AddUint64(&cs.counter, 1)
+		val := splitmix64(cs.key + next)
+		if val < limit {
+			return int(val % bound)
+		}
+	}
+}
+
+//see http://xoshiro.di.unimi.it/splitmix64.c
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+type scriptedSource struct {
+	faces []int
+	next  int
+	lock  *sync.Mutex
+}
+
+func (ss *scriptedSource) Intn(n int) int {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	if len(ss.faces) == 0 {
+		return 0
+	}
+	face := ss.faces[ss.next]
+	ss.next = (ss.next + 1) % len(ss.faces)
+
+	val := (face - 1) % n
+	if val < 0 {
+		val += n
+	}
+	return val
+}
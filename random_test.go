@@ -0,0 +1,122 @@
+package tablib
+
+/*
+These tests focus on the random sources that drive table and dice execution
+*/
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScriptedRandomSource_shouldForceTableRow(t *testing.T) {
+	yml := `
+  definition:
+    name: TestTable_Flat
+    type: flat
+  content:
+    - item 1
+    - item 2
+    - item 3
+    - item 4`
+
+	repo := NewTableRepository(WithRandomSource(NewScriptedRandomSource(3)))
+	repo.AddTable([]byte(yml))
+	tr := repo.Roll("TestTable_Flat", 5)
+	for _, r := range tr.Result {
+		if r != "item 3" {
+			t.Errorf("Scripted source did not force row 3, got: %s", r)
+		}
+	}
+}
+
+func TestScriptedRandomSource_shouldReplayFacesInOrder(t *testing.T) {
+	src := NewScriptedRandomSource(1, 6, 8)
+	expected := []int{0, 5, 1, 0, 5}
+	for i, e := range expected {
+		if val := src.Intn(6); val != e {
+			t.Errorf("Face %d: expected %d, got %d", i, e, val)
+		}
+	}
+
+	empty := NewScriptedRandomSource()
+	if empty.Intn(20) != 0 {
+		t.Error("Empty scripted source should always roll a 1")
+	}
+}
+
+func TestCounterRandomSource_shouldBeReproducibleAndIndependent(t *testing.T) {
+	a1 := NewCounterRandomSource(99, 1)
+	a2 := NewCounterRandomSource(99, 1)
+	b := NewCounterRandomSource(99, 2)
+
+	same := true
+	for i := 0; i < 100; i++ {
+		va1 := a1.Intn(1000)
+		va2 := a2.Intn(1000)
+		vb := b.Intn(1000)
+		if va1 != va2 {
+			t.Fatal("Counter sources with same seed and stream diverged")
+		}
+		if va1 < 0 || va1 >= 1000 {
+			t.Fatalf("Counter source out of bounds: %d", va1)
+		}
+		if va1 != vb {
+			same = false
+		}
+	}
+	if same {
+		t.Error("Counter sources on different streams produced identical output")
+	}
+}
+
+func TestCryptoRandomSource_shouldStayInBounds(t *testing.T) {
+	src := NewCryptoRandomSource()
+	for i := 0; i < 100; i++ {
+		if val := src.Intn(6); val < 0 || val >= 6 {
+			t.Fatalf("Crypto source out of bounds: %d", val)
+		}
+	}
+}
+
+func TestRandomSource_shouldDriveLuaMathRandom(t *testing.T) {
+	lua := `
+  results = {}
+  function main()
+    math.randomseed(7)
+    results["int"] = math.random(10)
+    results["range"] = math.random(5, 7)
+    local f = math.random()
+    results["float"] = tostring(f >= 0 and f < 1)
+  end
+  `
+
+	repo := NewTableRepository(WithRandomSource(NewScriptedRandomSource(4, 2)))
+	repo.AddLuaScript("test", lua)
+	mp := repo.Execute("test", nil)
+	if mp["int"] != "4" {
+		t.Errorf("math.random(10) did not use the repository source: %v", mp)
+	}
+	if mp["range"] != "6" {
+		t.Errorf("math.random(5, 7) did not use the repository source: %v", mp)
+	}
+	if mp["float"] != "true" {
+		t.Errorf("math.random() is outside [0,1): %v", mp)
+	}
+}
+
+func TestRandomSource_shouldRejectLuaIntervalsTooLarge(t *testing.T) {
+	lua := `
+  results = {}
+  function main()
+    results["range"] = math.random(-9e18, 9e18)
+  end
+  `
+
+	repo := NewTableRepository()
+	failOnErr("Unable to add script", repo.AddLuaScript("test", lua), t)
+	mp := repo.Execute("test", nil)
+	if !strings.Contains(mp["Script-Error"], "interval is too large") {
+		t.Errorf("Expected the interval to be rejected: %v", mp)
+	}
+}
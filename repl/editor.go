@@ -0,0 +1,197 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const prompt = "> "
+
+//Run reads commands from in and writes their output to out until in is
+//exhausted or the user quits. If in is a terminal, lines may be edited with tab
+//completion and the up and down keys recall earlier commands
+func (s *Session) Run(in io.Reader, out io.Writer) error {
+	if f, ok := in.(*os.File); ok {
+		if restore, err := makeRaw(f); err == nil {
+			defer restore()
+			ed := &editor{
+				in:       bufio.NewReader(f),
+				out:      out,
+				complete: s.Complete,
+			}
+			return s.loop(ed.readLine, out)
+		}
+	}
+
+	scanner := bufio.NewScanner(in)
+	readLine := func() (string, error) {
+		fmt.Fprint(out, prompt)
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			if err := scanner.Err(); err != nil {
+				return "", err
+			}
+			return "", io.EOF
+		}
+		return scanner.Text(), nil
+	}
+	return s.loop(readLine, out)
+}
+
+func (s *Session) loop(readLine func() (string, error), out io.Writer) error {
+	for {
+		line, err := readLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		output, err := s.Eval(line)
+		switch {
+		case errors.Is(err, ErrQuit):
+			return nil
+		case err != nil:
+			fmt.Fprintf(out, "error: %v\n", err)
+		case output != "":
+			fmt.Fprintln(out, output)
+		}
+	}
+}
+
+//editor reads lines from a terminal in raw mode, echoing as it goes
+type editor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	complete func(string) []string
+	inputs   []string //earlier lines, oldest first, for the up and down keys
+}
+
+//bell is written when a key can not be acted on
+const bell = "\a"
+
+const (
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyBackspace = 8
+	keyTab       = '\t'
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+func (e *editor) readLine() (string, error) {
+	var line []rune
+	recalled := len(e.inputs) //index of the input shown, len for a new line
+	tabbed := false           //true if the last key was an unresolved tab
+	redraw := func() {
+		fmt.Fprintf(e.out, "\r\033[K%s%s", prompt, string(line))
+	}
+	fmt.Fprint(e.out, prompt)
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(line) > 0 { //treat the end of input as enter
+				break
+			}
+			return "", err
+		}
+
+		wasTabbed := tabbed
+		tabbed = false
+		switch {
+		case r == '\r' || r == '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return e.remember(string(line)), nil
+		case r == keyCtrlC: //abandon the line
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", nil
+		case r == keyCtrlD:
+			if len(line) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+		case r == keyBackspace || r == keyDelete:
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				redraw()
+			}
+		case r == keyTab:
+			completions := e.complete(string(line))
+			switch len(completions) {
+			case 0:
+				fmt.Fprint(e.out, bell)
+			case 1:
+				line = []rune(completions[0] + " ")
+				redraw()
+			default:
+				common := commonPrefix(completions)
+				if len(common) > len(string(line)) {
+					line = []rune(common)
+					redraw()
+				} else if wasTabbed { //a second tab lists the choices
+					fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(lastWords(completions), "  "))
+					redraw()
+				} else {
+					fmt.Fprint(e.out, bell)
+					tabbed = true
+				}
+			}
+		case r == keyEscape:
+			//arrow keys arrive as ESC [ A and so on. Other sequences are ignored
+			if b, _ := e.in.ReadByte(); b != '[' {
+				continue
+			}
+			b, _ := e.in.ReadByte()
+			switch {
+			case b == 'A' && recalled > 0:
+				recalled--
+				line = []rune(e.inputs[recalled])
+				redraw()
+			case b == 'B' && recalled < len(e.inputs):
+				recalled++
+				line = nil
+				if recalled < len(e.inputs) {
+					line = []rune(e.inputs[recalled])
+				}
+				redraw()
+			}
+		case r >= ' ':
+			line = append(line, r)
+			fmt.Fprint(e.out, string(r))
+		}
+	}
+	fmt.Fprint(e.out, "\r\n")
+	return e.remember(string(line)), nil
+}
+
+//adds a line to those the up key recalls
+func (e *editor) remember(line string) string {
+	if strings.TrimSpace(line) != "" {
+		e.inputs = append(e.inputs, line)
+	}
+	return line
+}
+
+func commonPrefix(list []string) string {
+	prefix := list[0]
+	for _, s := range list[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+//the last word of each completion, which is all that differs between them
+func lastWords(completions []string) []string {
+	words := make([]string, 0, len(completions))
+	for _, c := range completions {
+		words = append(words, c[strings.LastIndex(c, " ")+1:])
+	}
+	return words
+}
@@ -0,0 +1,86 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func newTestEditor(keys string, complete func(string) []string) (*editor, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	return &editor{
+		in:       bufio.NewReader(strings.NewReader(keys)),
+		out:      out,
+		complete: complete,
+	}, out
+}
+
+func TestRun_shouldReadLines(t *testing.T) {
+	s := newTestSession(t)
+	var out bytes.Buffer
+	err := s.Run(strings.NewReader("roll encounters\nbogus\nquit\nroll encounters\n"), &out)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := "> goblins\n> error: Unknown command: bogus, try help\n> "
+	if out.String() != want {
+		t.Errorf("Unexpected output: %q", out.String())
+	}
+
+	//ends at the end of input too
+	out.Reset()
+	if err := s.Run(strings.NewReader("1d1"), &out); err != nil || out.String() != "> 1d1 = [1] = 1\n> \n" {
+		t.Errorf("Unexpected output: %v %q", err, out.String())
+	}
+}
+
+func TestEditor_shouldEditLines(t *testing.T) {
+	ed, _ := newTestEditor("rolx\x7fl loot\r", nil)
+	if line, err := ed.readLine(); err != nil || line != "roll loot" {
+		t.Errorf("Unexpected line: %q %v", line, err)
+	}
+
+	//ctrl-c abandons the line, ctrl-d on an empty line ends input
+	ed, _ = newTestEditor("roll\x03\x04", nil)
+	if line, err := ed.readLine(); err != nil || line != "" {
+		t.Errorf("Unexpected line: %q %v", line, err)
+	}
+	if _, err := ed.readLine(); err != io.EOF {
+		t.Errorf("Expected end of input: %v", err)
+	}
+}
+
+func TestEditor_shouldCompleteWithTab(t *testing.T) {
+	s := newTestSession(t)
+
+	ed, _ := newTestEditor("ro\tl\r", s.Complete)
+	if line, _ := ed.readLine(); line != "roll l" {
+		t.Errorf("Unexpected line: %q", line)
+	}
+
+	//a unique completion is finished with a space
+	ed, _ = newTestEditor("roll l\t\r", s.Complete)
+	if line, _ := ed.readLine(); line != "roll loot " {
+		t.Errorf("Unexpected line: %q", line)
+	}
+
+	//the common prefix is completed then a second tab lists the choices
+	ed, out := newTestEditor("roll e\t\t\t\r", s.Complete)
+	if line, _ := ed.readLine(); line != "roll e" {
+		t.Errorf("Unexpected line: %q", line)
+	}
+	if !strings.Contains(out.String(), "\r\nencounters  equipment\r\n") {
+		t.Errorf("Choices not listed: %q", out.String())
+	}
+}
+
+func TestEditor_shouldRecallEarlierLines(t *testing.T) {
+	ed, _ := newTestEditor("roll loot\rpick 1 loot\r\x1b[A\x1b[A\r\x1b[A\x1b[B\r", nil)
+	for _, want := range []string{"roll loot", "pick 1 loot", "roll loot", ""} {
+		if line, _ := ed.readLine(); line != want {
+			t.Errorf("Unexpected line: %q want %q", line, want)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package repl
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"tablib"
+	"tablib/tableresult"
+)
+
+//ErrQuit is returned by Eval when the user asks to leave the session
+var ErrQuit = errors.New("quit")
+
+const helpText = `commands:
+  roll <table> [count]           roll on a table, once unless count is given
+  pick <count> <table>           pick count unique items from a table
+  run <script> [name=value]...   run a script, parameters not given take their defaults
+  <dice expression>              roll dice eg 2d6+3
+  again, !!                      repeat the last command
+  history                        show every command and its result so far
+  trace [on|off]                 show the log of the last roll or pick, or turn
+                                 showing it after every roll and pick on or off
+  help                           show this help
+  quit, exit                     leave the session
+Press tab to complete commands, table names and script names`
+
+//commands offered by tab completion
+var commandNames = []string{"again", "exit", "help", "history", "pick", "quit", "roll", "run", "trace"}
+
+var (
+	//lines that are probably dice expressions rather than mistyped commands
+	dicePattern = regexp.MustCompile(`^([-(0-9]|d[0-9%F])`)
+)
+
+//Entry is a command and the output it produced
+type Entry struct {
+	Input  string
+	Output string
+}
+
+//Session holds the state of a REPL session over a TableRepository: the history
+//of results, the last command, which may be repeated, and whether table logs
+//are shown
+type Session struct {
+	repo      tablib.TableRepository
+	history   []*Entry
+	last      string   //the last command that ran successfully
+	lastLog   []string //the log of the last roll or pick
+	showTrace bool
+}
+
+//NewSession creates a session over the given repository
+func NewSession(repo tablib.TableRepository) *Session {
+	return &Session{
+		repo:    repo,
+		history: make([]*Entry, 0),
+	}
+}
+
+//History returns every command that ran successfully and its output, oldest first
+func (s *Session) History() []*Entry {
+	return s.history
+}
+
+//Eval runs a single command and returns its output. An error is returned if the
+//command failed, or ErrQuit if the user asked to leave
+func (s *Session) Eval(line string) (string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return "", nil
+	}
+
+	fields := strings.Fields(line)
+	switch strings.ToLower(fields[0]) {
+	case "quit", "exit":
+		return "", ErrQuit
+	case "help", "?":
+		return helpText, nil
+	case "history":
+		return s.formatHistory(), nil
+	case "trace":
+		return s.trace(fields[1:])
+	case "again", "!!":
+		if s.last == "" {
+			return "", errors.New("There is no command to repeat")
+		}
+		line = s.last
+		fields = strings.Fields(line)
+	}
+
+	output, err := s.execute(fields, line)
+	if err != nil {
+		return "", err
+	}
+	s.last = line
+	s.history = append(s.history, &Entry{Input: line, Output: output})
+	return output, nil
+}
+
+//Complete returns the possible completions of the line, each as the whole line
+//with its last word completed. Commands are completed as are the names of
+//tables, after roll or pick, and scripts, after run
+func (s *Session) Complete(line string) []string {
+	fields := strings.Fields(line)
+	word := "" //the word being completed, empty if the line ends with a space
+	if len(fields) > 0 && !strings.HasSuffix(line, " ") {
+		word = fields[len(fields)-1]
+		fields = fields[:len(fields)-1]
+	}
+	prefix := line[:len(line)-len(word)]
+
+	command := "" //commands are matched ignoring case, as execute does
+	if len(fields) > 0 {
+		command = strings.ToLower(fields[0])
+	}
+
+	var options []string
+	switch {
+	case len(fields) == 0:
+		options = commandNames
+	case command == "roll" && len(fields) == 1:
+		options = s.names("table")
+	case command == "pick" && len(fields) == 2:
+		options = s.names("table")
+	case command == "run" && len(fields) == 1:
+		options = s.names("script")
+	}
+
+	completions := make([]string, 0)
+	for _, o := range options {
+		if strings.HasPrefix(o, word) {
+			completions = append(completions, prefix+o)
+		}
+	}
+	sort.Strings(completions)
+	return completions
+}
+
+func (s *Session) execute(fields []string, line string) (string, error) {
+	switch strings.ToLower(fields[0]) {
+	case "roll":
+		return s.roll(fields[1:])
+	case "pick":
+		return s.pick(fields[1:])
+	case "run":
+		return s.run(fields[1:])
+	}
+
+	//anything else should be a dice expression
+	bd, err := s.repo.ExplainDiceExpression(line)
+	if err != nil {
+		if dicePattern.MatchString(line) {
+			return "", err
+		}
+		return "", fmt.Errorf("Unknown command: %s, try help", fields[0])
+	}
+	return bd.String(), nil
+}
+
+func (s *Session) roll(args []string) (string, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return "", errors.New("usage: roll <table> [count]")
+	}
+	count := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return "", fmt.Errorf("Invalid count: %s", args[1])
+		}
+		count = n
+	}
+	if _, err := s.repo.List(args[0], "table"); err != nil {
+		return "", err
+	}
+	return s.tableOutput(s.repo.Roll(args[0], count))
+}
+
+//accepts pick 3 loot and pick loot 3 as table names can not start with a digit
+func (s *Session) pick(args []string) (string, error) {
+	if len(args) != 2 {
+		return "", errors.New("usage: pick <count> <table>")
+	}
+	name, countArg := args[1], args[0]
+	if _, err := strconv.Atoi(countArg); err != nil {
+		name, countArg = args[0], args[1]
+	}
+	count, err := strconv.Atoi(countArg)
+	if err != nil || count < 1 {
+		return "", fmt.Errorf("Invalid count: %s", countArg)
+	}
+	if _, err := s.repo.List(name, "table"); err != nil {
+		return "", err
+	}
+	return s.tableOutput(s.repo.Pick(name, count))
+}
+
+func (s *Session) run(args []string) (string, error) {
+	if len(args) < 1 {
+		return "", errors.New("usage: run <script> [name=value]...")
+	}
+	values := make(map[string]string)
+	for _, p := range args[1:] {
+		parts := strings.SplitN(p, "=", 2)
+		if len(parts) != 2 {
+			return "", fmt.Errorf("Invalid parameter: %s, expected name=value", p)
+		}
+		values[parts[0]] = parts[1]
+	}
+	if _, err := s.repo.List(args[0], "script"); err != nil {
+		return "", err
+	}
+
+	results := s.repo.Execute(args[0], func(specs []*tablib.ParamSpecification) map[string]string {
+		chosen := tablib.DefaultParamSpecificationCallback(specs)
+		for name, v := range values {
+			chosen[name] = v
+		}
+		return chosen
+	})
+	if scriptErr, failed := results["Script-Error"]; failed {
+		return "", fmt.Errorf("Script: %s failed: %s", args[0], scriptErr)
+	}
+	keys := make([]string, 0, len(results))
+	for k := range results {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		lines = append(lines, fmt.Sprintf("%s: %s", k, results[k]))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (s *Session) tableOutput(tr *tableresult.TableResult) (string, error) {
+	s.lastLog = tr.Log
+	if tr.Err != nil {
+		return "", tr.Err
+	}
+	if len(tr.Result) == 0 {
+		return "", errors.New(strings.Join(tr.Log, "\n"))
+	}
+	output := strings.Join(tr.Result, "\n")
+	if s.showTrace {
+		output += "\n" + formatLog(tr.Log)
+	}
+	return output, nil
+}
+
+func (s *Session) trace(args []string) (string, error) {
+	if len(args) == 0 {
+		if len(s.lastLog) == 0 {
+			return "", errors.New("There is no roll or pick to trace")
+		}
+		return formatLog(s.lastLog), nil
+	}
+	switch strings.ToLower(args[0]) {
+	case "on":
+		s.showTrace = true
+		return "trace on", nil
+	case "off":
+		s.showTrace = false
+		return "trace off", nil
+	}
+	return "", errors.New("usage: trace [on|off]")
+}
+
+func (s *Session) formatHistory() string {
+	lines := make([]string, 0, len(s.history))
+	for i, e := range s.history {
+		lines = append(lines, fmt.Sprintf("%d> %s", i+1, e.Input))
+		for _, l := range strings.Split(e.Output, "\n") {
+			lines = append(lines, "   "+l)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+//the names of the tables or scripts in the repository, inline tables are not included
+func (s *Session) names(itemType string) []string {
+	items, _ := s.repo.Search("", nil) //can not fail without a regex
+	names := make([]string, 0, len(items))
+	for _, sr := range items {
+		if sr.Type == itemType {
+			names = append(names, sr.Name)
+		}
+	}
+	return names
+}
+
+func formatLog(log []string) string {
+	lines := make([]string, 0, len(log))
+	for _, l := range log {
+		lines = append(lines, "  | "+l)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,171 @@
+package repl
+
+import (
+	"errors"
+	"strings"
+	"tablib"
+	"testing"
+)
+
+const (
+	encountersYml = `
+  definition:
+    name: encounters
+    type: flat
+  content:
+    - goblins`
+
+	equipmentYml = `
+  definition:
+    name: equipment
+    type: flat
+  content:
+    - "{@loot}"`
+
+	lootYml = `
+  definition:
+    name: loot
+    type: flat
+  content:
+    - gold
+    - gems
+    - silver`
+
+	npcLua = `
+  local t = require("tables")
+  results = {}
+  params = {}
+  params["mood"] = "calm|angry"
+  function main(p)
+    results["meets"] = t.roll("encounters")
+    results["mood"] = p["mood"]
+  end`
+)
+
+func newTestSession(t *testing.T) *Session {
+	repo := tablib.NewTableRepository(tablib.WithRandomSource(tablib.NewScriptedRandomSource(1)))
+	for _, yml := range []string{encountersYml, equipmentYml, lootYml} {
+		if _, err := repo.AddTable([]byte(yml)); err != nil {
+			t.Fatalf("Unable to add table: %v", err)
+		}
+	}
+	if err := repo.AddLuaScript("npc", npcLua); err != nil {
+		t.Fatalf("Unable to add script: %v", err)
+	}
+	return NewSession(repo)
+}
+
+func evalOK(t *testing.T, s *Session, line string) string {
+	out, err := s.Eval(line)
+	if err != nil {
+		t.Fatalf("%s: unexpected error: %v", line, err)
+	}
+	return out
+}
+
+func TestEval_shouldRunCommands(t *testing.T) {
+	s := newTestSession(t)
+	for line, want := range map[string]string{
+		"roll encounters":    "goblins",
+		"roll encounters 2":  "goblins\ngoblins",
+		"pick 1 loot":        "gold",
+		"pick loot 1":        "gold",
+		"2d6+3":              "2d6 + 3 = [1, 1] + 3 = 5",
+		"run npc":            "meets: goblins\nmood: calm",
+		"run npc mood=angry": "meets: goblins\nmood: angry",
+		"  ":                 "",
+	} {
+		if out := evalOK(t, s, line); out != want {
+			t.Errorf("%s: got %q want %q", line, out, want)
+		}
+	}
+}
+
+func TestEval_shouldReportErrors(t *testing.T) {
+	s := newTestSession(t)
+	for line, want := range map[string]string{
+		"again":          "There is no command to repeat",
+		"roll missing":   "Table: missing does not exist",
+		"roll loot x":    "Invalid count: x",
+		"pick 3":         "usage: pick <count> <table>",
+		"pick x loot":    "Invalid count: loot",
+		"run nobody":     "Script: nobody does not exist",
+		"run npc mood":   "Invalid parameter: mood, expected name=value",
+		"dance":          "Unknown command: dance, try help",
+		"2d":             "Invalid dice expression: 2d",
+		"trace":          "There is no roll or pick to trace",
+		"trace sideways": "usage: trace [on|off]",
+	} {
+		_, err := s.Eval(line)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got %v want %s", line, err, want)
+		}
+	}
+
+	for _, line := range []string{"quit", "exit", "QUIT"} {
+		if _, err := s.Eval(line); !errors.Is(err, ErrQuit) {
+			t.Errorf("%s: expected to quit: %v", line, err)
+		}
+	}
+}
+
+func TestEval_shouldRepeatAndRecordHistory(t *testing.T) {
+	s := newTestSession(t)
+	evalOK(t, s, "roll encounters")
+	evalOK(t, s, "history")
+	if out := evalOK(t, s, "!!"); out != "goblins" {
+		t.Errorf("Unexpected repeat: %q", out)
+	}
+	s.Eval("roll missing") //failures are neither recorded nor repeated
+	if out := evalOK(t, s, "again"); out != "goblins" {
+		t.Errorf("Unexpected repeat: %q", out)
+	}
+
+	history := s.History()
+	if len(history) != 3 || history[0].Input != "roll encounters" || history[0].Output != "goblins" {
+		t.Errorf("Unexpected history: %v", history)
+	}
+	if out := evalOK(t, s, "history"); !strings.HasPrefix(out, "1> roll encounters\n   goblins\n2> roll encounters") {
+		t.Errorf("Unexpected history: %q", out)
+	}
+}
+
+func TestEval_shouldShowTrace(t *testing.T) {
+	s := newTestSession(t)
+	evalOK(t, s, "roll equipment")
+	out := evalOK(t, s, "trace")
+	if !strings.Contains(out, "  | Executing Roll") || !strings.Contains(out, "loot") {
+		t.Errorf("Unexpected trace: %q", out)
+	}
+
+	evalOK(t, s, "trace on")
+	if out := evalOK(t, s, "roll equipment"); !strings.HasPrefix(out, "gold\n  | ") {
+		t.Errorf("Unexpected output with trace on: %q", out)
+	}
+	evalOK(t, s, "trace off")
+	if out := evalOK(t, s, "roll equipment"); out != "gold" {
+		t.Errorf("Unexpected output with trace off: %q", out)
+	}
+}
+
+func TestComplete_shouldCompleteCommandsAndNames(t *testing.T) {
+	s := newTestSession(t)
+	for line, want := range map[string][]string{
+		"":          commandNames,
+		"r":         {"roll", "run"},
+		"roll e":    {"roll encounters", "roll equipment"},
+		"roll ":     {"roll encounters", "roll equipment", "roll loot"},
+		"pick 3 l":  {"pick 3 loot"},
+		"run n":     {"run npc"},
+		"ROLL e":    {"ROLL encounters", "ROLL equipment"},
+		"Run n":     {"Run npc"},
+		"run npc ":  {},
+		"roll x":    {},
+		"dance wit": {},
+	} {
+		got := s.Complete(line)
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%q: got %v want %v", line, got, want)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package repl
+
+import (
+	"errors"
+	"os"
+)
+
+//makeRaw is only supported on linux. Elsewhere lines are read as typed, without
+//completion or recall
+func makeRaw(f *os.File) (func(), error) {
+	return nil, errors.New("line editing is not supported on this platform")
+}
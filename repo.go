@@ -1,6 +1,7 @@
 package tablib
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"regexp"
@@ -37,11 +38,15 @@ type concreteTableRepo struct {
 	tagSearchCache  map[string][]*SearchResult
 	nameSearchCache map[string]*SearchResult
 	lock            *sync.RWMutex
+	rnd             RandomSource
+	config          *executionConfig
+	collisions      CollisionPolicy
 }
 
 type nameResolver interface {
 	tableForName(name string) (*table.Table, error)
 	scriptForName(name string) (*lua.FunctionProto, error)
+	resolveTableName(name, from string) string
 }
 
 const (
@@ -54,46 +59,109 @@ var (
 )
 
 func (cr *concreteTableRepo) AddTable(yamlBytes []byte) (*validate.ValidationResult, error) {
+	_, vr, err := cr.addTable(yamlBytes, "", "", "")
+	return vr, err
+}
+
+//addTable does the work of AddTable but also returns the parsed table so
+//callers can learn its name. The table is returned whenever the yaml parsed,
+//even if it was not stored due to validation errors. The table's name is placed
+//in the given namespace, if any. The table named by replaces, if any, may be
+//replaced whatever the collision policy as the caller is reloading it. Diagnostics
+//point into the named file, if any
+func (cr *concreteTableRepo) addTable(yamlBytes []byte, file, namespace, replaces string) (*table.Table,
+	*validate.ValidationResult, error) {
+
+	tf, err := parseTable(yamlBytes, file, namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tf.tbl, tf.validationResults, cr.storeTable(tf, replaces)
+}
+
+//tableFile is a table that has been parsed and validated, ready to be stored
+type tableFile struct {
+	yamlBytes         []byte
+	tbl               *table.Table
+	inlines           []*table.Table
+	validationResults *validate.ValidationResult
+}
+
+//parseTable parses and validates a table without storing it. An error is
+//returned only if the yaml does not hold a table, a table that fails validation
+//is returned along with its validation results
+func parseTable(yamlBytes []byte, file, namespace string) (*tableFile, error) {
 
 	//Note: not locking repo here so parse + validate can be multithreaded if caller desires
 
-	//is this even valid YAML?
+	//is this even valid YAML? It is decoded via its nodes so that the positions
+	//of its parts are known
+	var doc yaml.Node
+	if err := yaml.Unmarshal(yamlBytes, &doc); err != nil {
+		return nil, err
+	}
 	var tbl *table.Table
-	err := yaml.Unmarshal(yamlBytes, &tbl)
-	if err != nil {
+	if err := doc.Decode(&tbl); err != nil {
 		return nil, err
 	}
 
+	//valid YAML but is it a table at all?
+	if tbl == nil || tbl.Definition == nil {
+		return nil, errors.New("YAML does not contain a table definition")
+	}
+	tbl.Source = table.NewSourceMap(file, &doc)
+
+	tbl.Definition.Name = util.QualifyName(namespace, tbl.Definition.Name)
+	return prepareTable(yamlBytes, tbl), nil
+}
+
+//prepareTable validates a decoded table and builds the parts of it needed to
+//roll on it: its dice and its inline tables. The table is returned along with
+//its validation results whether or not it is valid
+func prepareTable(yamlBytes []byte, tbl *table.Table) *tableFile {
+
 	//validate the table and parse portions of it since we are tearing the table
 	//apart to do the validation anyway
 	validationResults := tbl.Validate()
+	tf := &tableFile{yamlBytes: yamlBytes, tbl: tbl, validationResults: validationResults}
 
 	//by definition, tables that arrive here are not inline tables
 	tbl.IsInlineTable = false
 
 	//do not proceed if the table is invalid (but its ok if there are warnings)
 	if !validationResults.Valid() {
-		return validationResults, nil
+		return tf
 	}
 
-	//add dice information to flat tables since we need to roll on them
-	if tbl.Definition.TableType == table.TypeFlat {
+	//add dice information to flat and weighted tables since we need to roll on them
+	if tbl.Definition.TableType == table.TypeFlat || tbl.Definition.TableType == table.TypeWeighted {
 		addDiceParseResultForFlatAndInlineTables(tbl)
 	}
 
 	//build out inline tables in this table as first-class tables, then validate
 	//the inline content for proper tablerefs
-	var inlines []*table.Table
 	if len(tbl.Inline) > 0 {
-		inlines = extractInlineTables(tbl)
-		for _, ilt := range inlines {
+		tf.inlines = extractInlineTables(tbl)
+		for idx, ilt := range tf.inlines {
+			start := len(validationResults.Diagnostics)
 			ilt.ValidateContent(validationResults)
+			for _, d := range validationResults.Diagnostics[start:] {
+				d.WithTable(tbl.Definition.Name).WithInline(tbl.Inline[idx].ID)
+			}
 		}
 	}
+	return tf
+}
+
+//storeTable puts a parsed table and its inline tables in the repo, subject to
+//the collision policy unless it replaces the table named by replaces. Tables
+//that failed validation are not stored
+func (cr *concreteTableRepo) storeTable(tf *tableFile, replaces string) error {
+	tbl, validationResults := tf.tbl, tf.validationResults
 
 	//final validity check to prevent storing a bad table in the repo
 	if !validationResults.Valid() {
-		return validationResults, nil
+		return nil
 	}
 
 	//lock the repo now since we will write to it
@@ -104,15 +172,45 @@ func (cr *concreteTableRepo) AddTable(yamlBytes []byte) (*validate.ValidationRes
 	//can compare how the table has changed if it is being updated
 
 	fullName := util.BuildFullName(tbl.Definition.Name, "")
+	existing, found := cr.tableStore[fullName]
+	if found && fullName != replaces {
+		if err := cr.collide(fullName, validationResults); err != nil {
+			return err
+		}
+	}
+
+	//inline tables are stored under their own names so they are subject to the
+	//policy too, other than those of the table being replaced
+	ownInlines := make(map[string]bool)
+	if found {
+		for _, name := range existing.parsedTable.InlineNames() {
+			ownInlines[name] = true
+		}
+	}
+	for _, ilt := range tf.inlines {
+		name := ilt.Definition.Name
+		if _, taken := cr.tableStore[name]; taken && !ownInlines[name] {
+			if err := cr.collide(name, validationResults); err != nil {
+				return err
+			}
+		}
+	}
+
 	//update the tag cache with the new table info
 	cr.updateTagCache(fullName, itemTypeTable, tbl.Definition.Tags)
 
 	//update the name cache
 	cr.addToNameCache(fullName, itemTypeTable, tbl.Definition.Tags)
 
+	//if this table is replacing an existing one, drop the old inline tables since
+	//the new version may define fewer of them
+	if found {
+		cr.removeInlineTables(existing.parsedTable)
+	}
+
 	//put the valid table in the repo
 	cr.tableStore[fullName] = &tableData{
-		yamlSource:  string(yamlBytes),
+		yamlSource:  string(tf.yamlBytes),
 		parsedTable: tbl,
 		tags:        tbl.Definition.Tags,
 	}
@@ -120,7 +218,7 @@ func (cr *concreteTableRepo) AddTable(yamlBytes []byte) (*validate.ValidationRes
 	//store the inline tables for this table as first-class tables
 	//note that inline tables are not returned in searches and cant be Listed
 	//seperately from their mater table
-	for _, ilt := range inlines {
+	for _, ilt := range tf.inlines {
 		cr.tableStore[ilt.Definition.Name] = &tableData{
 			yamlSource:  "",
 			parsedTable: ilt,
@@ -128,7 +226,20 @@ func (cr *concreteTableRepo) AddTable(yamlBytes []byte) (*validate.ValidationRes
 		}
 	}
 
-	return validationResults, nil
+	return nil
+}
+
+//collide applies the collision policy to a table about to replace the table of
+//the same name. Caller must hold a lock
+func (cr *concreteTableRepo) collide(name string, validationResults *validate.ValidationResult) error {
+	switch cr.collisions {
+	case CollisionError:
+		return fmt.Errorf("%w: %s", ErrTableExists, name)
+	case CollisionWarn:
+		validationResults.Warn("Definition", fmt.Sprintf("Table: %s replaces an existing table", name)).
+			WithCode(validate.CodeTableReplaced).WithTable(name)
+	}
+	return nil
 }
 
 func (cr *concreteTableRepo) AddLuaScript(scriptName, luaScript string) error {
@@ -155,15 +266,7 @@ func (cr *concreteTableRepo) AddLuaScript(scriptName, luaScript string) error {
 	}
 
 	//read and compile the lua script
-	reader := strings.NewReader(luaScript)
-	astStatements, err := parse.Parse(reader, luaScript)
-	if err != nil {
-		return err
-	}
-
-	//compile the script. Not sure what kind of error could happen here. From
-	//a read of the source this is pretty unlikely but catching it anyway
-	proto, err := lua.Compile(astStatements, luaScript)
+	proto, err := compileLuaScript(luaScript)
 	if err != nil {
 		return err
 	}
@@ -187,6 +290,57 @@ func (cr *concreteTableRepo) AddLuaScript(scriptName, luaScript string) error {
 	return nil
 }
 
+//parses and compiles a lua script to bytecode
+func compileLuaScript(luaScript string) (*lua.FunctionProto, error) {
+	reader := strings.NewReader(luaScript)
+	astStatements, err := parse.Parse(reader, luaScript)
+	if err != nil {
+		return nil, err
+	}
+
+	//compile the script. Not sure what kind of error could happen here. From
+	//a read of the source this is pretty unlikely but catching it anyway
+	return lua.Compile(astStatements, luaScript)
+}
+
+func (cr *concreteTableRepo) RemoveLuaScript(scriptName string) error {
+	cr.lock.Lock()
+	defer cr.lock.Unlock()
+
+	item, found := cr.scriptStore[scriptName]
+	if !found {
+		return newNotFoundError(itemTypeScript, scriptName)
+	}
+
+	cr.removeFromCaches(scriptName, itemTypeScript, item.tags)
+	delete(cr.scriptStore, scriptName)
+	return nil
+}
+
+func (cr *concreteTableRepo) RemoveTable(tableName string, refuseIfReferenced bool) error {
+	cr.lock.Lock()
+	defer cr.lock.Unlock()
+
+	item, found := cr.tableStore[tableName]
+	if !found {
+		return newNotFoundError(itemTypeTable, tableName)
+	}
+	if item.parsedTable.IsInlineTable {
+		return fmt.Errorf("Table: %s is an inline table and cannot be removed on its own", tableName)
+	}
+
+	if refuseIfReferenced {
+		if referrers := cr.referrersOf(tableName); len(referrers) > 0 {
+			return fmt.Errorf("Table: %s is still referenced by: %s", tableName, strings.Join(referrers, ", "))
+		}
+	}
+
+	cr.removeFromCaches(tableName, itemTypeTable, item.tags)
+	cr.removeInlineTables(item.parsedTable)
+	delete(cr.tableStore, tableName)
+	return nil
+}
+
 func (cr *concreteTableRepo) List(name string, itemType string) (string, error) {
 	cr.lock.RLock()
 	defer cr.lock.RUnlock()
@@ -195,13 +349,13 @@ func (cr *concreteTableRepo) List(name string, itemType string) (string, error)
 	case itemTypeTable:
 		item, found := cr.tableStore[name]
 		if !found {
-			return "", fmt.Errorf("Table: %s does not exist", name)
+			return "", newNotFoundError(itemTypeTable, name)
 		}
 		return item.yamlSource, nil
 	case itemTypeScript:
 		item, found := cr.scriptStore[name]
 		if !found {
-			return "", fmt.Errorf("Script: %s does not exist", name)
+			return "", newNotFoundError(itemTypeScript, name)
 		}
 		return item.scriptSource, nil
 	default:
@@ -216,62 +370,83 @@ func (cr *concreteTableRepo) Search(namePredicate string, tags []string) ([]*Sea
 }
 
 func (cr *concreteTableRepo) Roll(tableName string, execsDesired int) *tableresult.TableResult {
-	cr.lock.RLock()
-	defer cr.lock.RUnlock()
+	return cr.RollContext(context.Background(), tableName, execsDesired)
+}
+
+func (cr *concreteTableRepo) RollContext(ctx context.Context, tableName string,
+	execsDesired int) *tableresult.TableResult {
 
+	//the repo is not locked for the whole execution, only for each lookup made
+	//by it. Scripts may roll on tables and wait on callbacks for as long as they
+	//like, a writer arriving meanwhile must not be left waiting for them and
+	//so block their lookups in turn
 	tr := tableresult.NewTableResult()
 
 	if execsDesired <= 0 {
 		tr.AddLog(fmt.Sprintf("Attempt to roll 0 or fewer times on table: %s", tableName))
 	}
 
-	tbl, found := cr.tableStore[tableName]
-	if !found {
-		tr.AddLog(fmt.Sprintf("Table: %s does not exist", tableName))
+	tbl, err := cr.tableForName(tableName)
+	if err != nil {
+		tr.AddLog(err.Error())
+		tr.AddError(err)
 		return tr
 	}
 
 	wp := &workPackage{
 		nameSvc:   cr,
-		table:     tbl.parsedTable,
+		table:     tbl,
 		operation: table.OpRoll,
 		count:     execsDesired,
 	}
-	exeng := newExecutionEngine()
+	exeng := newExecutionEngine(ctx, cr.rnd, cr.config)
 	exeng.execute(wp, tr)
 	return tr
 }
 
 func (cr *concreteTableRepo) Pick(tableName string, count int) *tableresult.TableResult {
-	cr.lock.RLock()
-	defer cr.lock.RUnlock()
+	return cr.PickContext(context.Background(), tableName, count)
+}
+
+func (cr *concreteTableRepo) PickContext(ctx context.Context, tableName string,
+	count int) *tableresult.TableResult {
 
+	//locked only for each lookup, see RollContext
 	tr := tableresult.NewTableResult()
 
-	tbl, found := cr.tableStore[tableName]
-	if !found {
-		tr.AddLog(fmt.Sprintf("Table: %s does not exist", tableName))
+	tbl, err := cr.tableForName(tableName)
+	if err != nil {
+		tr.AddLog(err.Error())
+		tr.AddError(err)
 		return tr
 	}
 
 	wp := &workPackage{
 		nameSvc:   cr,
-		table:     tbl.parsedTable,
+		table:     tbl,
 		operation: table.OpPick,
 		count:     1,
 		pickCount: count,
 	}
-	exeng := newExecutionEngine()
+	exeng := newExecutionEngine(ctx, cr.rnd, cr.config)
 	exeng.execute(wp, tr)
 	return tr
 }
 
 func (cr *concreteTableRepo) Execute(scriptName string,
 	callback ParamSpecificationRequestCallback) map[string]string {
-	cr.lock.RLock()
-	defer cr.lock.RUnlock()
+	results, err := cr.ExecuteContext(context.Background(), scriptName, callback)
+	if err != nil { //the script is missing or was cut off by a sandbox limit
+		return createErrorMap(scriptName, err.Error())
+	}
+	return results
+}
 
-	return executeScript(scriptName, cr, cr, callback)
+func (cr *concreteTableRepo) ExecuteContext(ctx context.Context, scriptName string,
+	callback ParamSpecificationRequestCallback) (map[string]string, error) {
+
+	//never locked while the script runs or waits on the callback, see RollContext
+	return executeScript(ctx, scriptName, cr, cr, cr.rnd, cr.config, callback)
 }
 
 func (cr *concreteTableRepo) EvaluateDiceExpression(diceExpr string) (int, error) {
@@ -287,7 +462,23 @@ func (cr *concreteTableRepo) EvaluateDiceExpression(diceExpr string) (int, error
 	}
 
 	//roll
-	return newExecutionEngine().rollDice(diceParsed), nil
+	return newExecutionEngine(context.Background(), cr.rnd, cr.config).rollDice(diceParsed), nil
+}
+
+func (cr *concreteTableRepo) ExplainDiceExpression(diceExpr string) (*dice.Breakdown, error) {
+
+	//validate and parse the dice
+	if diceExpr == "" {
+		return nil, fmt.Errorf("diceExpr cannot be empty")
+	}
+	vr := validate.NewValidationResult()
+	diceParsed := dice.ValidateDiceExpr(diceExpr, "Explain Dice Expression", vr)
+	if !vr.Valid() {
+		return nil, errors.New(vr.Errors[0])
+	}
+
+	//roll
+	return diceParsed.Explain(cr.rnd), nil
 }
 
 func (cr *concreteTableRepo) Tags() []string {
@@ -311,11 +502,35 @@ func (cr *concreteTableRepo) tableForName(name string) (*table.Table, error) {
 
 	tblData, found := cr.tableStore[name]
 	if !found {
-		return nil, fmt.Errorf("Table does not exist: %s", name)
+		return nil, newNotFoundError(itemTypeTable, name)
 	}
 	return tblData.parsedTable, nil
 }
 
+//resolveTableName finds the table that a table name refers to when used by the
+//named table or script. Unqualified names are looked for in the namespace of
+//from, then in each enclosing namespace and finally outside of any namespace.
+//Qualified names, and names that can not be found, are returned as is
+func (cr *concreteTableRepo) resolveTableName(name, from string) string {
+	cr.lock.RLock()
+	defer cr.lock.RUnlock()
+	return cr.resolveName(name, from)
+}
+
+//resolveName does the work of resolveTableName. Caller must hold a lock
+func (cr *concreteTableRepo) resolveName(name, from string) string {
+	if util.IsQualified(name) {
+		return name
+	}
+	for ns := util.Namespace(from); ns != ""; ns = util.Namespace(ns) {
+		qualified := util.QualifyName(ns, name)
+		if _, found := cr.tableStore[qualified]; found {
+			return qualified
+		}
+	}
+	return name
+}
+
 //scriptForName returns the underlying compiled script for give table name
 func (cr *concreteTableRepo) scriptForName(name string) (*lua.FunctionProto, error) {
 	cr.lock.RLock()
@@ -323,7 +538,7 @@ func (cr *concreteTableRepo) scriptForName(name string) (*lua.FunctionProto, err
 
 	scriptData, found := cr.scriptStore[name]
 	if !found {
-		return nil, fmt.Errorf("Script does not exist: %s", name)
+		return nil, newNotFoundError(itemTypeScript, name)
 	}
 	return scriptData.parsedScript, nil
 }
@@ -415,6 +630,53 @@ func (cr *concreteTableRepo) addToTagCache(sr *SearchResult) {
 	}
 }
 
+//removes an item from the tag and name caches. Caller must hold the write lock
+func (cr *concreteTableRepo) removeFromCaches(fullName string, itemType string, tags []string) {
+	sr := &SearchResult{
+		Name: fullName,
+		Type: itemType,
+		Tags: tags,
+	}
+	cr.removeFromTagCache(sr, tags)
+	delete(cr.nameSearchCache, sr.toComparable())
+}
+
+//drops the first-class copies of a table's inline tables from the repo. Caller
+//must hold the write lock
+func (cr *concreteTableRepo) removeInlineTables(tbl *table.Table) {
+	for _, name := range tbl.InlineNames() {
+		delete(cr.tableStore, name)
+	}
+}
+
+//returns the sorted names of the tables, other than the named table itself,
+//that refer to the named table. References made by inline tables are
+//attributed to the table that defines them. Caller must hold a lock
+func (cr *concreteTableRepo) referrersOf(tableName string) []string {
+	referrers := make(map[string]struct{})
+	for name, td := range cr.tableStore {
+		for _, ref := range td.parsedTable.References() {
+			if cr.resolveName(ref.Name, name) != tableName {
+				continue
+			}
+			owner := name
+			if td.parsedTable.IsInlineTable {
+				owner = strings.SplitN(name, ".", 2)[0]
+			}
+			if owner != tableName {
+				referrers[owner] = struct{}{}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(referrers))
+	for name := range referrers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (cr *concreteTableRepo) addToNameCache(fullName string, itemType string, tags []string) {
 	//name is the key identifier (well name and type) for an object. When an
 	//object arrives via one of the Add API's, it is hard to know if we are actually
@@ -434,7 +696,7 @@ func (cr *concreteTableRepo) addToNameCache(fullName string, itemType string, ta
 //enables inline lookups to be handled like any other table ref during execution
 func extractInlineTables(mainTable *table.Table) []*table.Table {
 	inlinesAsTables := make([]*table.Table, 0, len(mainTable.Inline))
-	for _, ilt := range mainTable.Inline {
+	for idx, ilt := range mainTable.Inline {
 
 		def := &table.DefinitionPart{
 			Name:      ilt.FullyQualifiedName,
@@ -451,6 +713,7 @@ func extractInlineTables(mainTable *table.Table) []*table.Table {
 			RawContent:    content,
 			IsValid:       true,
 			IsInlineTable: true,
+			Source:        mainTable.Source.InlineTable(idx),
 		}
 
 		//add dice info to this inline table since we need to roll on it
@@ -460,16 +723,13 @@ func extractInlineTables(mainTable *table.Table) []*table.Table {
 	return inlinesAsTables
 }
 
-//creates parsed dice info to make rolling on the flat or inline
+//creates parsed dice info to make rolling on the flat, weighted or inline
 //table easier at exection - now these table types have dice info
-//just as if they were ranged tables
+//just as if they were ranged tables. Weighted tables roll a die with one face
+//per unit of weight
 func addDiceParseResultForFlatAndInlineTables(tbl *table.Table) {
-	dpr := &dice.ParseResult{
-		Count:    1,
-		DieType:  len(tbl.RawContent),
-		Operator: "none",
-	}
-	dp := make([]*dice.ParseResult, 1, 1)
-	dp[0] = dpr
-	tbl.Definition.DiceParsed = dp
+	tbl.Definition.DiceParsed = &dice.Roll{
+		Count: 1,
+		Sides: tbl.TotalWeight(),
+	}
 }
@@ -6,7 +6,10 @@ and scripts, searching and listing etc. Tests focused on table or script
 execution are located in other test files.
 */
 import (
-	"sync"
+	"errors"
+	"fmt"
+	"strings"
+	"tablib/dice"
 	"tablib/validate"
 	"testing"
 )
@@ -56,18 +59,16 @@ func TestAddTable_shouldAddValidFlatTableToRepo(t *testing.T) {
 	}
 
 	//check implicit dice on flat table
-	if len(tbl.Definition.DiceParsed) != 1 {
-		t.Error("Missing or invalid parsed dice")
+	roll, ok := tbl.Definition.DiceParsed.(*dice.Roll)
+	if !ok {
+		t.Fatal("Missing or invalid parsed dice")
 	}
-	if tbl.Definition.DiceParsed[0].Count != 1 {
+	if roll.Count != 1 {
 		t.Error("Failed to set implicit Count")
 	}
-	if tbl.Definition.DiceParsed[0].DieType != len(tbl.RawContent) {
+	if roll.Sides != len(tbl.RawContent) {
 		t.Error("Failed to set implicit Dice Type based on content length")
 	}
-	if tbl.Definition.DiceParsed[0].Operator != "none" {
-		t.Error("Failed to set implicit operator")
-	}
 
 	//ensure that the inline table has been properly set up as a first-class table
 	tblData, found = cr.tableStore["TestTable_Flat.1"]
@@ -86,18 +87,16 @@ func TestAddTable_shouldAddValidFlatTableToRepo(t *testing.T) {
 	if !tbl.IsInlineTable {
 		t.Error("Inline table not flagged properly")
 	}
-	if len(tbl.Definition.DiceParsed) != 1 {
-		t.Error("Missing or invalid parsed dice for inline table")
+	roll, ok = tbl.Definition.DiceParsed.(*dice.Roll)
+	if !ok {
+		t.Fatal("Missing or invalid parsed dice for inline table")
 	}
-	if tbl.Definition.DiceParsed[0].Count != 1 {
+	if roll.Count != 1 {
 		t.Error("Failed to set implicit Count for inline table")
 	}
-	if tbl.Definition.DiceParsed[0].DieType != len(tbl.RawContent) {
+	if roll.Sides != len(tbl.RawContent) {
 		t.Error("Failed to set implicit Dice Type based on content length for inline table")
 	}
-	if tbl.Definition.DiceParsed[0].Operator != "none" {
-		t.Error("Failed to set implicit operator for inline table")
-	}
 }
 
 func TestAddTable_shouldAddValidFlatRangeToRepo(t *testing.T) {
@@ -147,18 +146,16 @@ func TestAddTable_shouldAddValidFlatRangeToRepo(t *testing.T) {
 	}
 
 	//check implicit dice on flat table
-	if len(tbl.Definition.DiceParsed) != 1 {
-		t.Error("Missing or invalid parsed dice")
+	roll, ok := tbl.Definition.DiceParsed.(*dice.Roll)
+	if !ok {
+		t.Fatal("Missing or invalid parsed dice")
 	}
-	if tbl.Definition.DiceParsed[0].Count != 1 {
+	if roll.Count != 1 {
 		t.Error("Failed to set die Count")
 	}
-	if tbl.Definition.DiceParsed[0].DieType != 4 {
+	if roll.Sides != 4 {
 		t.Error("Failed to set Dice Type based on roll description")
 	}
-	if tbl.Definition.DiceParsed[0].Operator != "none" {
-		t.Error("Failed to set die operator")
-	}
 
 	//ensure that the inline table has been properly set up as a first-class table
 	tblData, found = cr.tableStore["TestTable_Range.1"]
@@ -177,18 +174,16 @@ func TestAddTable_shouldAddValidFlatRangeToRepo(t *testing.T) {
 	if !tbl.IsInlineTable {
 		t.Error("Inline table not flagged properly")
 	}
-	if len(tbl.Definition.DiceParsed) != 1 {
-		t.Error("Missing or invalid parsed dice for inline table")
+	roll, ok = tbl.Definition.DiceParsed.(*dice.Roll)
+	if !ok {
+		t.Fatal("Missing or invalid parsed dice for inline table")
 	}
-	if tbl.Definition.DiceParsed[0].Count != 1 {
+	if roll.Count != 1 {
 		t.Error("Failed to set implicit Count for inline table")
 	}
-	if tbl.Definition.DiceParsed[0].DieType != len(tbl.RawContent) {
+	if roll.Sides != len(tbl.RawContent) {
 		t.Error("Failed to set implicit Dice Type based on content length for inline table")
 	}
-	if tbl.Definition.DiceParsed[0].Operator != "none" {
-		t.Error("Failed to set implicit operator for inline table")
-	}
 }
 
 func TestAddTable_shouldNotAddInvalidTableToRepo(t *testing.T) {
@@ -837,7 +832,7 @@ func TestList_errorWhenTypeDoesNotExist(t *testing.T) {
 //the tabexe extensively tests the roller, this just ensures the API
 //is handling things properly
 func TestEvalDiceExpr_shouldReturnExpectedValues(t *testing.T) {
-	data := []*rollTestData{toRTD("1d6", 1, 6)}
+	data := []*rollTestData{toRTD("1d6", 1, 6), toRTD("4d6kh3", 3, 18), toRTD("(d4 + 1) * 2", 4, 10)}
 	repo := NewTableRepository()
 
 	for i := 1; i <= 5; i++ {
@@ -868,6 +863,24 @@ func TestEvalDiceExpr_shouldFailOnBadDiceExpression(t *testing.T) {
 
 }
 
+func TestExplainDiceExpr_shouldDescribeRoll(t *testing.T) {
+	repo := NewTableRepository(WithRandomSource(NewScriptedRandomSource(4, 2)))
+
+	bd, err := repo.ExplainDiceExpression("2d6+3")
+	if err != nil {
+		t.Fatalf("Unexpected error with valid dice expression: %v", err)
+	}
+	if bd.Value != 9 || bd.String() != "2d6 + 3 = [4, 2] + 3 = 9" {
+		t.Errorf("Unexpected breakdown: %s", bd)
+	}
+
+	for _, expr := range []string{"", "2d6+"} {
+		if _, err := repo.ExplainDiceExpression(expr); err == nil {
+			t.Errorf("Did not error as expected on invalid dice expression: %s", expr)
+		}
+	}
+}
+
 func TestTags_shouldReturnSortedAndUniqueTags(t *testing.T) {
 
 	yml1 := `
@@ -919,10 +932,306 @@ func TestTags_shouldReturnSortedAndUniqueTags(t *testing.T) {
 	}
 }
 
+func TestRemoveTable_shouldRemoveTableInlinesAndCaches(t *testing.T) {
+	yml := `
+  definition:
+    name: foo
+    type: flat
+    tags:
+      - tag1
+  content:
+    - item 1 - {#1}
+  inline:
+    - id: 1
+      content:
+        - Inline 1`
+
+	ymlOther := `
+  definition:
+    name: bar
+    type: flat
+    tags:
+      - tag1
+  content:
+    - item 1`
+
+	cr := newConcreteRepo()
+	cr.AddTable([]byte(yml))
+	cr.AddTable([]byte(ymlOther))
+
+	err := cr.RemoveTable("foo", false)
+	failOnErr("Unable to remove table", err, t)
+
+	if len(cr.tableStore) != 1 {
+		t.Error("Table or its inline table was not removed")
+	}
+	if _, found := cr.tableStore["foo.1"]; found {
+		t.Error("Inline table was not removed")
+	}
+	if len(cr.nameSearchCache) != 1 {
+		t.Error("Name cache not updated")
+	}
+	if len(cr.tagSearchCache["tag1"]) != 1 || cr.tagSearchCache["tag1"][0].Name != "bar" {
+		t.Error("Tag cache not updated")
+	}
+}
+
+func TestRemoveTable_shouldErrorOnMissingOrInlineTable(t *testing.T) {
+	yml := `
+  definition:
+    name: foo
+    type: flat
+  content:
+    - item 1 - {#1}
+  inline:
+    - id: 1
+      content:
+        - Inline 1`
+
+	cr := newConcreteRepo()
+	cr.AddTable([]byte(yml))
+
+	if err := cr.RemoveTable("bar", false); err == nil {
+		t.Error("Did not receive expected error removing missing table")
+	}
+	if err := cr.RemoveTable("foo.1", false); err == nil {
+		t.Error("Did not receive expected error removing inline table")
+	}
+	if len(cr.tableStore) != 2 {
+		t.Error("Tables removed unexpectedly")
+	}
+}
+
+func TestRemoveTable_shouldRefuseWhenReferenced(t *testing.T) {
+	ymlfoo := `
+  definition:
+    name: foo
+    type: flat
+  content:
+    - item 1 - {@foo}`
+
+	ymlbar := `
+  definition:
+    name: bar
+    type: flat
+  content:
+    - item 1 - {#1}
+  inline:
+    - id: 1
+      content:
+        - "{2!foo}"`
+
+	cr := newConcreteRepo()
+	cr.AddTable([]byte(ymlfoo))
+	cr.AddTable([]byte(ymlbar))
+
+	err := cr.RemoveTable("foo", true)
+	if err == nil {
+		t.Fatal("Did not refuse to remove a referenced table")
+	}
+	if !strings.HasSuffix(err.Error(), "still referenced by: bar") {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	//self references and references from its own inlines dont count
+	failOnErr("Unable to remove table", cr.RemoveTable("bar", true), t)
+	failOnErr("Unable to remove table", cr.RemoveTable("foo", true), t)
+	if len(cr.tableStore) != 0 {
+		t.Error("Tables not removed")
+	}
+}
+
+func TestRemoveLuaScript_shouldRemoveScriptAndCaches(t *testing.T) {
+	lua := `
+	--TAGS: tag1
+  print("dlrow olleh")
+  `
+	cr := newConcreteRepo()
+	cr.AddLuaScript("foo", lua)
+
+	failOnErr("Unable to remove script", cr.RemoveLuaScript("foo"), t)
+	if len(cr.scriptStore) != 0 || len(cr.nameSearchCache) != 0 || len(cr.tagSearchCache) != 0 {
+		t.Error("Script not fully removed")
+	}
+	if err := cr.RemoveLuaScript("foo"); err == nil {
+		t.Error("Did not receive expected error removing missing script")
+	}
+}
+
+func TestAddTable_shouldDropStaleInlineTablesOnReplace(t *testing.T) {
+	yml1 := `
+  definition:
+    name: foo
+    type: flat
+  content:
+    - item 1 - {#1} {#2}
+  inline:
+    - id: 1
+      content:
+        - Inline 1
+    - id: 2
+      content:
+        - Inline 2`
+
+	yml2 := `
+  definition:
+    name: foo
+    type: flat
+  content:
+    - item 1 - {#1}
+  inline:
+    - id: 1
+      content:
+        - Inline 1`
+
+	cr := newConcreteRepo()
+	cr.AddTable([]byte(yml1))
+	cr.AddTable([]byte(yml2))
+
+	if len(cr.tableStore) != 2 {
+		t.Error("Stale inline table left in the repo")
+	}
+	if _, found := cr.tableStore["foo.2"]; found {
+		t.Error("Stale inline table left in the repo")
+	}
+}
+
+func TestAddTable_shouldApplyCollisionPolicy(t *testing.T) {
+	yml := `
+  definition:
+    name: Collides
+    type: flat
+  content:
+    - item 1`
+
+	//replace is the default
+	repo := NewTableRepository()
+	repo.AddTable([]byte(yml))
+	vr, err := repo.AddTable([]byte(yml))
+	if err != nil || vr.HasWarnings {
+		t.Errorf("Table should have been replaced quietly: %v %v", err, vr.Errors)
+	}
+
+	repo = NewTableRepository(WithCollisionPolicy(CollisionWarn))
+	repo.AddTable([]byte(yml))
+	vr, err = repo.AddTable([]byte(yml))
+	if err != nil || len(vr.Errors) != 1 ||
+		vr.Errors[0] != "WARN: Definition - Table: Collides replaces an existing table" {
+		t.Errorf("Table should have been replaced with a warning: %v %v", err, vr.Errors)
+	}
+
+	repo = NewTableRepository(WithCollisionPolicy(CollisionError))
+	repo.AddTable([]byte(yml))
+	_, err = repo.AddTable([]byte(strings.Replace(yml, "item 1", "item 2", 1)))
+	if !errors.Is(err, ErrTableExists) || err.Error() != "table already exists: Collides" {
+		t.Errorf("Expected a collision error: %v", err)
+	}
+	if tr := repo.Roll("Collides", 1); tr.Result[0] != "item 1" {
+		t.Errorf("Existing table should have been kept: %v", tr.Result)
+	}
+
+	//inline tables are stored under their own names and may collide too
+	cr := NewTableRepository(WithCollisionPolicy(CollisionError)).(*concreteTableRepo)
+	cr.AddTable([]byte(yml))
+	cr.tableStore["Inlined.1"] = cr.tableStore["Collides"]
+	_, err = cr.AddTable([]byte(`
+  definition:
+    name: Inlined
+    type: flat
+  content:
+    - "{#1}"
+  inline:
+    - id: 1
+      content:
+        - inline 1`))
+	if !errors.Is(err, ErrTableExists) || err.Error() != "table already exists: Inlined.1" {
+		t.Errorf("Expected an inline collision error: %v", err)
+	}
+	if _, err := cr.List("Inlined", itemTypeTable); err == nil {
+		t.Error("Colliding table should not have been stored")
+	}
+}
+
+func TestRoll_shouldResolveNamesWithinNamespace(t *testing.T) {
+	ymls := []string{`
+  definition:
+    name: dnd5e/npc
+    type: flat
+  content:
+    - "{@names} the {@trade} {#1}"
+  inline:
+    - id: 1
+      content:
+        - "of {@dnd5e/places}"`, `
+  definition:
+    name: dnd5e/names
+    type: flat
+  content:
+    - Bruenor`, `
+  definition:
+    name: dnd5e/places
+    type: flat
+  content:
+    - "{@names}hall"`, `
+  definition:
+    name: names
+    type: flat
+  content:
+    - Bob`, `
+  definition:
+    name: trade
+    type: flat
+  content:
+    - smith`}
+
+	repo := NewTableRepository()
+	for _, yml := range ymls {
+		vr, err := repo.AddTable([]byte(yml))
+		failOnErr("Unable to add table", err, t)
+		failOnInvalid("Invalid table", vr, t)
+	}
+
+	//names resolves within dnd5e, trade falls back to the global table and the
+	//inline table resolves relative to the table that defines it
+	tr := repo.Roll("dnd5e/npc", 1)
+	if len(tr.Result) != 1 || tr.Result[0] != "Bruenor the smith of Bruenorhall" {
+		t.Errorf("Unexpected result: %v %v", tr.Result, tr.Log)
+	}
+	if tr := repo.Roll("names", 1); tr.Result[0] != "Bob" {
+		t.Errorf("Unqualified roll should use the global table: %v", tr.Result)
+	}
+}
+
+func TestAddTable_shouldRejectBadNamespaces(t *testing.T) {
+	for _, name := range []string{"/names", "dnd5e/", "dnd5e//names"} {
+		yml := fmt.Sprintf(`
+  definition:
+    name: %s
+    type: flat
+  content:
+    - item 1`, name)
+		vr, err := NewTableRepository().AddTable([]byte(yml))
+		failOnErr("Unable to parse table", err, t)
+		if vr.Valid() {
+			t.Errorf("Table name should be invalid: %s", name)
+		}
+	}
+}
+
 /* ***********************************************
 * Test Helpers
 * ***********************************************/
 
+//builds a repository holding the given tables, failing the test if any can not be added
+func newTestRepo(t *testing.T, ymls []string, opts ...RepositoryOption) TableRepository {
+	repo := NewTableRepository(opts...)
+	for _, yml := range ymls {
+		_, err := repo.AddTable([]byte(yml))
+		failOnErr("Unable to add table", err, t)
+	}
+	return repo
+}
+
 func failOnErr(msg string, err error, t *testing.T) {
 	if err != nil {
 		t.Errorf("Unexpected err: %s: %s", msg, err)
@@ -936,11 +1245,5 @@ func failOnInvalid(msg string, vr *validate.ValidationResult, t *testing.T) {
 }
 
 func newConcreteRepo() *concreteTableRepo {
-	return &concreteTableRepo{
-		tableStore:      make(map[string]*tableData),
-		scriptStore:     make(map[string]*scriptData),
-		tagSearchCache:  make(map[string][]*SearchResult),
-		nameSearchCache: make(map[string]*SearchResult),
-		lock:            &sync.RWMutex{},
-	}
+	return NewTableRepository().(*concreteTableRepo)
 }
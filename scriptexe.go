@@ -1,6 +1,7 @@
 package tablib
 
 import (
+	"context"
 	"fmt"
 	"tablib/util"
 	"time"
@@ -13,20 +14,52 @@ const (
 	wellKnownLuaParamTable   = "params"
 	wellKnownLuaReturnTable  = "results"
 	wellKnownGoNameForModule = "tables"
-
-	defaultcallbackWaitTimeSeconds = 30 //TODO: this should ultimately be a config param
 )
 
-func executeScript(scriptName string, nameSvc nameResolver, repo TableRepository,
+//executeScript runs the named script. An error is returned, with a nil map, if
+//the script does not exist (a *NotFoundError) or if it was cut off, either
+//because the context was cancelled (the context's error) or because the script
+//exceeded one of the sandbox limits (a *LimitError). Any other problem running
+//the script is reported in the returned map
+func executeScript(ctx context.Context, scriptName string, nameSvc nameResolver, repo TableRepository,
+	rnd RandomSource, config *executionConfig, callback ParamSpecificationRequestCallback) (map[string]string, error) {
+
+	//a missing script is reported as an error callers can test for
+	if _, err := nameSvc.scriptForName(scriptName); err != nil {
+		return nil, err
+	}
+
+	scriptCtx, cancel := context.WithTimeout(ctx, config.scriptTimeout)
+	defer cancel()
+	limiter := newScriptLimiter(scriptName, config, cancel)
+
+	retmap := runScript(scriptCtx, limiter, scriptName, nameSvc, repo, rnd, config, callback)
+	if err := ctx.Err(); err != nil { //the caller gave up
+		return nil, err
+	}
+	if err := limiter.err(scriptCtx); err != nil {
+		return nil, err
+	}
+	return retmap, nil
+}
+
+func runScript(ctx context.Context, limiter *scriptLimiter, scriptName string, nameSvc nameResolver,
+	repo TableRepository, rnd RandomSource, config *executionConfig,
 	callback ParamSpecificationRequestCallback) map[string]string {
 
-	//Obtain a new Lua virtual machine
-	lState := util.NewLuaState()
+	//Obtain a new Lua virtual machine, sized per the sandbox limits. The context
+	//stops the VM when cancelled, when the script times out or when the limiter
+	//finds the script has exceeded some other limit. The VM checks it before each
+	//instruction, when the limiter measures the memory the script holds
+	lState := util.NewLimitedLuaState(config.scriptCallStackSize, config.scriptRegistrySize)
 	defer lState.Close()
+	lState.SetContext(limiter.meter(ctx, lState))
 
 	//tell the lua VM about the go code we are exposing to it
-	luaMod := newLuaModule(repo)
+	luaMod := newLuaModule(ctx, repo, nameSvc, scriptName, rnd, limiter)
 	lState.PreloadModule(wellKnownGoNameForModule, luaMod.luaModuleLoader)
+	luaMod.replaceMathRandom(lState)
+	limiter.install(lState)
 
 	//fetch the precompiled lua script by name
 	scriptData, err := nameSvc.scriptForName(scriptName)
@@ -34,12 +67,16 @@ func executeScript(scriptName string, nameSvc nameResolver, repo TableRepository
 		return createErrorMap(scriptName, fmt.Sprintf("%s", err))
 	}
 
-	//execute the lua script
+	//execute the lua script in a fresh environment holding only safe globals.
+	//The script's globals, including those the host reads, live there
+	env := util.NewSandboxEnv(lState, wellKnownGoNameForModule)
 	luafunc := lState.NewFunctionFromProto(scriptData)
+	luafunc.Env = env
 	lState.Push(luafunc)
 	err = lState.PCall(0, lua.MultRet, nil)
-	//unsure how this could fail but trapping it here
+	//fails if the script's top level code raises an error
 	if err != nil {
+		limiter.noteError(err)
 		return createErrorMap(scriptName,
 			fmt.Sprintf("failed to execute compiled script: %s", err))
 	}
@@ -51,7 +88,7 @@ func executeScript(scriptName string, nameSvc nameResolver, repo TableRepository
 
 	//retrieve the well-known param map from lua - this holds parameters the
 	//lua program requires to operate
-	luaParams := lState.GetGlobal(wellKnownLuaParamTable)
+	luaParams := lState.GetField(env, wellKnownLuaParamTable)
 	if luaParams.Type() == lua.LTTable { //process only if present and well-formed in lua
 		paramMap := fromLuaTable(scriptName, lState, luaParams.(*lua.LTable))
 		pspecs := paramSpecificationsFromMap(paramMap)
@@ -71,41 +108,40 @@ func executeScript(scriptName string, nameSvc nameResolver, repo TableRepository
 			responseChan <- callback(pspecs)
 		}()
 
-		//either use the caller's response or use default values
-		//the timeout case does not have a test but has been tested by radically
-		//shortening the time to ensure it works as expected (3 microseconds)
+		//either use the caller's response or use default values if the caller
+		//does not respond in time. See WithCallbackTimeout
 		var responseMap map[string]string
 		select {
 		case responseMap = <-responseChan:
-		case <-time.After(defaultcallbackWaitTimeSeconds * time.Second):
+		case <-time.After(config.callbackTimeout):
 			responseMap = DefaultParamSpecificationCallback(pspecs)
+		case <-ctx.Done():
+			return nil //reported by executeScript
 		}
 
 		//call the lua main
 		if err := lState.CallByParam(lua.P{
-			Fn:      lState.GetGlobal(wellKnownLuaMainFunc),
+			Fn:      lState.GetField(env, wellKnownLuaMainFunc),
 			NRet:    0,
 			Protect: true,
 		}, toLuaLTable(responseMap)); err != nil {
-			if err != nil {
-				return createErrorMap(scriptName, fmt.Sprintf("executing main(): %s", err))
-			}
+			limiter.noteError(err)
+			return createErrorMap(scriptName, fmt.Sprintf("executing main(): %s", err))
 		}
 	} else {
 		//call the well-known function "main" which is the 'main' for our lua script
 		if err := lState.CallByParam(lua.P{
-			Fn:      lState.GetGlobal(wellKnownLuaMainFunc),
+			Fn:      lState.GetField(env, wellKnownLuaMainFunc),
 			NRet:    0,
 			Protect: true,
 		}); err != nil {
-			if err != nil {
-				return createErrorMap(scriptName, fmt.Sprintf("executing main(): %s", err))
-			}
+			limiter.noteError(err)
+			return createErrorMap(scriptName, fmt.Sprintf("executing main(): %s", err))
 		}
 	}
 
 	//retrieve the well-known return value from lua
-	luaRetval := lState.GetGlobal(wellKnownLuaReturnTable)
+	luaRetval := lState.GetField(env, wellKnownLuaReturnTable)
 	var retmap map[string]string
 	if luaRetval.Type() == lua.LTTable { //process only if present and well-formed in lua
 		retmap = fromLuaTable(scriptName, lState, luaRetval.(*lua.LTable))
@@ -8,9 +8,12 @@ some of these tests are more like integration tests than unit tests.
 */
 
 import (
+	"context"
+	"errors"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestExecute_shouldErrorOnBadScriptName(t *testing.T) {
@@ -144,6 +147,34 @@ func TestExecute_shouldFailIfRollCalledBadTable(t *testing.T) {
 	}
 }
 
+func TestExecute_shouldReportRecursionInRoll(t *testing.T) {
+	yml := `
+  definition:
+    name: Forever
+    type: flat
+  content:
+    - "{@Forever}"`
+
+	lua := `
+  local t = require("tables")
+  results = {}
+  function main(goData)
+  results["val1"] = t.roll("Forever")
+  end
+  `
+
+	repo := NewTableRepository()
+	repo.AddTable([]byte(yml))
+	repo.AddLuaScript("test", lua)
+	mp := repo.Execute("test", DefaultParamSpecificationCallback)
+
+	val := mp["val1"]
+	if !strings.HasPrefix(val, "ERROR: Table: Forever exceeded max call depth") ||
+		!strings.HasSuffix(val, "Forever -> Forever") {
+		t.Errorf("Did not receive expected recursion error: %s", val)
+	}
+}
+
 func TestExecute_shouldFailIfRollCalledNoTable(t *testing.T) {
 	yml := `
   definition:
@@ -670,6 +701,50 @@ func TestExecute_shouldFailIfPickCalledBadTable(t *testing.T) {
 	}
 }
 
+func TestExecute_shouldExecuteFullDiceSyntax(t *testing.T) {
+	lua := `
+  local t = require("tables")
+  results = {}
+  function main(goData)
+  results["dice"] = t.dice("(1d1 + 2) * 3d1kh2 - d1 / 2")
+  end
+  `
+
+	repo := NewTableRepository()
+	repo.AddLuaScript("test", lua)
+	mp := repo.Execute("test", nil)
+	if mp["dice"] != "6" {
+		t.Errorf("Unexpected script results: %v", mp)
+	}
+}
+
+func TestExecute_shouldExplainDiceExpression(t *testing.T) {
+	lua := `
+  local t = require("tables")
+  results = {}
+  function main(goData)
+  local bd = t.diceBreakdown("4d6kh3 + 1")
+  results["total"] = bd.total
+  results["text"] = bd.text
+  local roll = bd.terms[1]
+  results["kind"] = roll.kind .. " " .. bd.op
+  results["dropped"] = roll.dice[4].faces[1]
+  results["kept"] = tostring(roll.dice[4].kept)
+  local bad, err = t.diceBreakdown("4d")
+  results["bad"] = tostring(bad) .. " " .. err
+  end
+  `
+
+	repo := NewTableRepository(WithRandomSource(NewScriptedRandomSource(4, 2, 5, 1)))
+	repo.AddLuaScript("test", lua)
+	mp := repo.Execute("test", nil)
+	if mp["total"] != "12" || mp["text"] != "4d6kh3 + 1 = [4, 2, 5, ~1] + 1 = 12" ||
+		mp["kind"] != "roll +" || mp["dropped"] != "1" || mp["kept"] != "false" ||
+		!strings.HasPrefix(mp["bad"], "nil ERROR: Explain Dice Expression - Invalid dice expression: 4d") {
+		t.Errorf("Unexpected script results: %v", mp)
+	}
+}
+
 func TestExecute_shouldExecuteValidDiceExpression(t *testing.T) {
 	lua1 := `
   local t = require("tables")
@@ -1020,3 +1095,221 @@ func TestExecute_moduleCompatibilityTest(t *testing.T) {
 	}
 
 }
+
+func TestExecute_shouldBeReproducibleWithSeed(t *testing.T) {
+	yml := `
+  definition:
+    name: Icecream_Flavors
+    type: flat
+  content:
+    - chocolate
+    - vanilla
+    - strawberry
+    - rocky road
+    - mint`
+
+	lua := `
+  local t = require("tables")
+  results = {}
+  function main()
+    for i=1,10
+    do
+      results["roll" .. i] = t.roll("Icecream_Flavors")
+    end
+    results["pick"] = t.pick("Icecream_Flavors", 3)
+    results["dice"] = t.dice("4d20")
+  end
+  `
+
+	runScript := func(seed int64) map[string]string {
+		repo := NewTableRepository(WithSeed(seed))
+		repo.AddTable([]byte(yml))
+		repo.AddLuaScript("test", lua)
+		return repo.Execute("test", nil)
+	}
+
+	first := runScript(1234)
+	second := runScript(1234)
+	if len(first) != 12 {
+		t.Errorf("Unexpected script results: %v", first)
+	}
+	for k, v := range first {
+		if second[k] != v {
+			t.Errorf("Same seed generated different results for key: %s", k)
+		}
+	}
+}
+
+func TestExecuteContext_shouldInterruptScript(t *testing.T) {
+	lua := `
+  results = {}
+  function main(goData)
+  while true do end
+  end
+  `
+
+	repo := NewTableRepository()
+	repo.AddLuaScript("test", lua)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	mp, err := repo.ExecuteContext(ctx, "test", nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Script was not cut off: %v", err)
+	}
+	if mp != nil {
+		t.Errorf("Unexpected script results: %v", mp)
+	}
+}
+
+func TestExecuteContext_shouldStopWaitingForCallback(t *testing.T) {
+	lua := `
+  params = {}
+  params["p1"] = "opt1-1|opt1-2"
+
+  results = {}
+  function main(goData)
+  results["p1"] = goData["p1"]
+  end
+  `
+
+	repo := NewTableRepository()
+	repo.AddLuaScript("test", lua)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	defer close(release)
+	_, err := repo.ExecuteContext(ctx, "test", func([]*ParamSpecification) map[string]string {
+		cancel()
+		<-release //never answers
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Script was not cut off: %v", err)
+	}
+}
+
+func TestExecute_shouldNotBlockWritersWhileRunning(t *testing.T) {
+	yml := `
+  definition:
+    name: TT
+    type: flat
+  content:
+    - item 1`
+
+	lua := `
+  local t = require("tables")
+  params = {}
+  params["p1"] = "opt1-1|opt1-2"
+
+  results = {}
+  function main(goData)
+  results["roll"] = t.roll("TT")
+  end
+  `
+
+	repo := NewTableRepository()
+	repo.AddLuaScript("test", lua)
+
+	//the table is added by another writer while the script waits on its callback
+	//and is then rolled on by the script
+	done := make(chan map[string]string)
+	go func() {
+		done <- repo.Execute("test", func([]*ParamSpecification) map[string]string {
+			added := make(chan error)
+			go func() {
+				_, err := repo.AddTable([]byte(yml))
+				added <- err
+			}()
+			select {
+			case err := <-added:
+				if err != nil {
+					t.Errorf("Unable to add table: %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Error("Writer blocked by the running script")
+			}
+			return nil
+		})
+	}()
+
+	select {
+	case results := <-done:
+		if results["roll"] != "item 1" {
+			t.Errorf("Unexpected results: %v", results)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Script deadlocked with the writer")
+	}
+}
+
+func TestExecuteContext_shouldCompleteNormally(t *testing.T) {
+	yml := `
+  definition:
+    name: TestTable_Flat
+    type: flat
+  content:
+    - item 1`
+
+	lua := `
+  local t = require("tables")
+  results = {}
+  function main(goData)
+  results["val1"] = t.roll("TestTable_Flat")
+  end
+  `
+
+	repo := NewTableRepository()
+	repo.AddTable([]byte(yml))
+	repo.AddLuaScript("test", lua)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	mp, err := repo.ExecuteContext(ctx, "test", nil)
+	if err != nil || mp["val1"] != "item 1" {
+		t.Errorf("Unexpected script results: %v %v", mp, err)
+	}
+}
+
+func TestExecute_shouldRunInSandbox(t *testing.T) {
+	repo := NewTableRepository()
+	for name, lua := range map[string]string{
+		"os":         `os.execute("echo escaped")`,
+		"require":    `require("io")`,
+		"loadstring": `loadstring("return 1")()`,
+		"setfenv":    `setfenv(1, {})`,
+	} {
+		repo.AddLuaScript(name, `
+  results = {}
+  function main(goData)
+  `+lua+`
+  results["val"] = "escaped"
+  end
+  `)
+		mp := repo.Execute(name, nil)
+		if _, ok := mp["Script-Error"]; !ok || mp["val"] == "escaped" {
+			t.Errorf("%s: escape attempt succeeded: %v", name, mp)
+		}
+	}
+
+	//script globals are visible to the host but not to later runs
+	repo.AddLuaScript("first", `
+  results = {}
+  function main(goData)
+  leaked = "yes"
+  results["val"] = leaked
+  end
+  `)
+	repo.AddLuaScript("second", `
+  results = {}
+  function main(goData)
+  results["val"] = tostring(leaked)
+  end
+  `)
+	if mp := repo.Execute("first", nil); mp["val"] != "yes" {
+		t.Errorf("Unexpected script results: %v", mp)
+	}
+	if mp := repo.Execute("second", nil); mp["val"] != "nil" {
+		t.Errorf("Global leaked between runs: %v", mp)
+	}
+}
@@ -0,0 +1,583 @@
+package tablib
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+
+	"github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/pm"
+)
+
+//scriptLimiter enforces the Lua sandbox limits for a single script execution.
+//The call stack and registry limits are enforced by the VM itself, the limiter
+//recognizes the errors it raises. Memory is accounted for by checking the size
+//of what those library functions that can build large strings will build, and
+//by measuring the strings and tables the script holds as it runs (see
+//meteredContext). Once any limit is exceeded the script's context is cancelled
+//so the VM stops at its next instruction, even if the script tries to catch the
+//error with pcall
+type scriptLimiter struct {
+	scriptName string
+	config     *executionConfig
+	cancel     context.CancelFunc
+	exceeded   *LimitError
+
+	//the value of the last error the script raised itself, see noteErrorValue
+	raised lua.LValue
+
+	//the bytes the script is thought to hold: what it held when last measured
+	//plus what library functions have built since. building is the part of that
+	//in a result still being built, which the script can not yet see
+	held     int
+	building int
+
+	//instructions run so far, when the script's memory is next measured and
+	//what it held when first measured, before it had built anything
+	ticks       int
+	nextMeasure int
+	baseline    int
+}
+
+func newScriptLimiter(scriptName string, config *executionConfig, cancel context.CancelFunc) *scriptLimiter {
+	return &scriptLimiter{
+		scriptName: scriptName,
+		config:     config,
+		cancel:     cancel,
+	}
+}
+
+//install wraps the library functions of the VM that need watching. It must be
+//called after the standard libs are opened and before the script is run
+func (sl *scriptLimiter) install(lState *lua.LState) {
+	sl.wrapStringRep(lState)
+	sl.checkBuiltSize(lState, lua.StringLibName, "format", formatSize)
+	sl.checkBuiltSize(lState, lua.TabLibName, "concat", concatSize)
+	if mod, ok := lState.GetGlobal(lua.StringLibName).(*lua.LTable); ok {
+		lState.SetField(mod, "gsub", lState.NewFunction(sl.gsub))
+	}
+	for _, name := range []string{"error", "assert"} {
+		sl.wrapRaise(lState, name)
+	}
+	for _, name := range []string{"pcall", "xpcall"} {
+		sl.wrapProtectedCall(lState, name)
+	}
+}
+
+//allocate accounts for a string of n bytes about to be built for the script.
+//When there looks to be no room for it what the script holds is measured again,
+//it may have let go of what was built before, and the script is terminated if
+//there is still no room
+func (sl *scriptLimiter) allocate(lState *lua.LState, n int) {
+	if n > sl.config.scriptMemory-sl.held {
+		sl.held = sl.measure(lState) + sl.building
+		if n > sl.config.scriptMemory-sl.held {
+			sl.exceed(lState, sl.memoryError())
+		}
+	}
+	sl.held += n
+}
+
+func (sl *scriptLimiter) memoryError() *LimitError {
+	return newLimitError(LimitScriptMemory, sl.config.scriptMemory,
+		"Script: %s exceeded max memory of: %d bytes", sl.scriptName, sl.config.scriptMemory)
+}
+
+//exceed records the limit that was exceeded, stops the VM and raises a lua error
+//to unwind the script. It does not return
+func (sl *scriptLimiter) exceed(lState *lua.LState, le *LimitError) {
+	if sl.exceeded == nil {
+		sl.exceeded = le
+	}
+	sl.cancel()
+	lState.RaiseError("%s", sl.exceeded.Error())
+}
+
+//noteError checks an error from running the script for the VM's own limits
+func (sl *scriptLimiter) noteError(err error) {
+	if apiErr, ok := err.(*lua.ApiError); ok {
+		sl.noteErrorValue(apiErr.Object)
+	}
+}
+
+//noteErrorValue checks the value of a lua error for the VM's own limits. The VM
+//only says its call stack or registry overflowed in its message, which a script
+//could also raise with error or assert, so the error is only taken to be the
+//VM's when it is not the last one the script raised itself
+func (sl *scriptLimiter) noteErrorValue(value lua.LValue) {
+	if sl.exceeded != nil {
+		return
+	}
+	if value == sl.raised {
+		sl.raised = nil
+		return
+	}
+	msg, ok := value.(lua.LString)
+	if !ok {
+		return
+	}
+	switch {
+	case strings.HasSuffix(string(msg), "stack overflow"):
+		sl.exceeded = newLimitError(LimitScriptCallStack, sl.config.scriptCallStackSize,
+			"Script: %s exceeded max call stack size of: %d", sl.scriptName, sl.config.scriptCallStackSize)
+	case strings.HasSuffix(string(msg), "registry overflow"):
+		sl.exceeded = newLimitError(LimitScriptRegistry, sl.config.scriptRegistrySize,
+			"Script: %s exceeded max registry size of: %d", sl.scriptName, sl.config.scriptRegistrySize)
+	default:
+		return
+	}
+	sl.cancel()
+}
+
+//err returns the LimitError for the first limit the script exceeded, if any.
+//scriptCtx is the context the script ran under, it carries the script timeout
+func (sl *scriptLimiter) err(scriptCtx context.Context) error {
+	if sl.exceeded != nil {
+		return sl.exceeded
+	}
+	if errors.Is(scriptCtx.Err(), context.DeadlineExceeded) {
+		return newLimitError(LimitScriptTime, int(sl.config.scriptTimeout.Milliseconds()),
+			"Script: %s exceeded max run time of: %s", sl.scriptName, sl.config.scriptTimeout)
+	}
+	return nil
+}
+
+const (
+	//how often, in instructions, the strings in the registers of the running
+	//function are measured. Strings built with .. are caught here before they
+	//can double in size more than a few times
+	registerInterval = 8
+
+	//the fewest instructions between measuring everything the script holds.
+	//It is measured less often the more it holds, after at least measureRatio
+	//instructions per value measured, so that measuring costs a fraction of
+	//running the script
+	measureInterval = 4096
+	measureRatio    = 4
+
+	//rough sizes, in bytes, of a value held by a table or register and of a
+	//table itself. Strings add their length
+	valueSize = 16
+	tableSize = 64
+)
+
+//meteredContext is the context of the script's VM. The VM checks its context
+//before every instruction, which gives the limiter somewhere to measure the
+//memory the script holds as it runs. It must only be used by the VM
+type meteredContext struct {
+	context.Context
+	limiter *scriptLimiter
+	lState  *lua.LState
+}
+
+func (mc *meteredContext) Done() <-chan struct{} {
+	mc.limiter.tick(mc.lState)
+	return mc.Context.Done()
+}
+
+//meter returns a context for the script's VM that measures the memory held by
+//the script as it runs
+func (sl *scriptLimiter) meter(ctx context.Context, lState *lua.LState) context.Context {
+	return &meteredContext{Context: ctx, limiter: sl, lState: lState}
+}
+
+//tick is called before each instruction. When the script holds too much the
+//limit is recorded and its context cancelled, the VM then raises the error
+func (sl *scriptLimiter) tick(lState *lua.LState) {
+	if sl.exceeded != nil {
+		return
+	}
+	sl.ticks++
+	held := 0
+	switch {
+	case sl.ticks >= sl.nextMeasure:
+		var values int
+		held, values = measureHeld(lState)
+		if sl.nextMeasure == 0 {
+			sl.baseline = held
+		}
+		held -= sl.baseline
+		sl.held = held + sl.building
+		sl.nextMeasure = sl.ticks + measureInterval
+		if values*measureRatio > measureInterval {
+			sl.nextMeasure = sl.ticks + values*measureRatio
+		}
+	case sl.ticks%registerInterval == 0:
+		held = measureRegisters(lState)
+	}
+	if held > sl.config.scriptMemory {
+		sl.exceeded = sl.memoryError()
+		sl.cancel()
+	}
+}
+
+//measure returns the bytes held by the script beyond what it was given to start
+//with
+func (sl *scriptLimiter) measure(lState *lua.LState) int {
+	held, _ := measureHeld(lState)
+	return held - sl.baseline
+}
+
+//the bytes of the strings in the registers of the running function
+func measureRegisters(lState *lua.LState) int {
+	n := 0
+	for i := lState.GetTop(); i > 0; i-- {
+		if str, ok := lState.Get(i).(lua.LString); ok {
+			n += len(str)
+		}
+	}
+	return n
+}
+
+//measureHeld estimates the bytes held by the script: everything reachable from
+//the locals, functions and environments of the call stack. It also returns the
+//number of values measured. A string held in several places is counted in each
+func measureHeld(lState *lua.LState) (int, int) {
+	seen := make(map[lua.LValue]bool)
+	pending := make([]lua.LValue, 0)
+	for level := 0; ; level++ {
+		dbg, ok := lState.GetStack(level)
+		if !ok {
+			break
+		}
+		for n := 1; ; n++ {
+			name, v := lState.GetLocal(dbg, n)
+			if name == "" {
+				break
+			}
+			pending = append(pending, v)
+		}
+		if fn, err := lState.GetInfo("f", dbg, lua.LNil); err == nil {
+			pending = append(pending, fn)
+		}
+	}
+
+	bytes, values := 0, 0
+	for len(pending) > 0 {
+		v := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		values++
+		bytes += valueSize
+		switch v := v.(type) {
+		case lua.LString:
+			bytes += len(v)
+		case *lua.LTable:
+			if seen[v] {
+				continue
+			}
+			seen[v] = true
+			bytes += tableSize
+			v.ForEach(func(key, val lua.LValue) {
+				pending = append(pending, key, val)
+			})
+			if v.Metatable != nil {
+				pending = append(pending, v.Metatable)
+			}
+		case *lua.LFunction:
+			if v.IsG || seen[v] {
+				continue //go functions hold nothing the script built
+			}
+			seen[v] = true
+			for n := 1; n <= len(v.Upvalues); n++ {
+				_, uv := lState.GetUpvalue(v, n)
+				pending = append(pending, uv)
+			}
+			if v.Env != nil {
+				pending = append(pending, v.Env)
+			}
+		}
+	}
+	return bytes, values
+}
+
+//string.rep can build a huge string from tiny arguments so check its size
+//before building it
+func (sl *scriptLimiter) wrapStringRep(lState *lua.LState) {
+	orig, mod := libFunction(lState, lua.StringLibName, "rep")
+	if orig == nil {
+		return
+	}
+	lState.SetField(mod, "rep", lState.NewFunction(func(L *lua.LState) int {
+		str, strOk := L.Get(1).(lua.LString)
+		n, nOk := L.Get(2).(lua.LNumber)
+		if strOk && nOk && n > 0 && len(str) > 0 {
+			if float64(n) > float64(sl.config.scriptMemory)/float64(len(str)) {
+				sl.exceed(L, sl.memoryError())
+			}
+			sl.allocate(L, len(str)*int(n))
+		}
+		return callOriginal(L, orig)
+	}))
+}
+
+//for library functions whose output size can be bounded from their arguments,
+//account for that much before calling them
+func (sl *scriptLimiter) checkBuiltSize(lState *lua.LState, lib, name string, size func(*lua.LState) int) {
+	orig, mod := libFunction(lState, lib, name)
+	if orig == nil {
+		return
+	}
+	lState.SetField(mod, name, lState.NewFunction(func(L *lua.LState) int {
+		sl.allocate(L, size(L))
+		return callOriginal(L, orig)
+	}))
+}
+
+const (
+	//the most a value other than a string adds to a formatted string, and the
+	//most a format directive adds beyond its width and argument, eg when go's
+	//fmt reports a bad argument
+	formattedValueSize = 32
+	formatSlack        = 16
+)
+
+//formatSize bounds the length of the string built by string.format: the format
+//itself plus, for each directive, its width and precision and its argument
+func formatSize(L *lua.LState) int {
+	format, ok := L.Get(1).(lua.LString)
+	if !ok {
+		return 0 //string.format raises the error
+	}
+	size, arg := len(format), 2
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		width, number := 0, 0
+		for ; i < len(format) && strings.IndexByte("+-# 0123456789.", format[i]) >= 0; i++ {
+			if d := format[i]; d >= '0' && d <= '9' {
+				if number < math.MaxInt32/10 {
+					number = number*10 + int(d-'0')
+				}
+				continue
+			}
+			width += number
+			number = 0
+		}
+		width += number
+		if i < len(format) && format[i] == '%' {
+			continue
+		}
+		size += width + formatSlack
+		switch v := L.Get(arg).(type) {
+		case lua.LString:
+			size += 4*len(v) + 2 //%q may escape every byte
+		default:
+			size += formattedValueSize
+		}
+		arg++
+	}
+	return size
+}
+
+//concatSize bounds the length of the string built by table.concat
+func concatSize(L *lua.LState) int {
+	tbl, ok := L.Get(1).(*lua.LTable)
+	if !ok {
+		return 0 //table.concat raises the error
+	}
+	sep, _ := L.Get(2).(lua.LString)
+	first, last := 1, tbl.Len()
+	if n, ok := L.Get(3).(lua.LNumber); ok && int(n) > first {
+		first = int(n)
+	}
+	if n, ok := L.Get(4).(lua.LNumber); ok && int(n) < last {
+		last = int(n)
+	}
+	size := 0
+	for i := first; i <= last; i++ {
+		switch v := tbl.RawGetInt(i).(type) {
+		case lua.LString:
+			size += len(v)
+		case lua.LNumber:
+			size += formattedValueSize
+		default:
+			return size //table.concat raises the error
+		}
+		if i != last {
+			size += len(sep)
+		}
+	}
+	return size
+}
+
+//gsub replaces string.gsub, which builds its result in go where the VM can not
+//stop it. It accounts for the result as it grows and stops when the script's
+//context is done
+func (sl *scriptLimiter) gsub(L *lua.LState) int {
+	str := L.CheckString(1)
+	pattern := L.CheckString(2)
+	L.CheckTypes(3, lua.LTString, lua.LTTable, lua.LTFunction)
+	repl := L.CheckAny(3)
+	limit := L.OptInt(4, -1)
+
+	matches, err := pm.Find(pattern, []byte(str), 0, limit)
+	if err != nil {
+		L.RaiseError(err.Error())
+	}
+	if len(matches) == 0 {
+		L.SetTop(1)
+		L.Push(lua.LNumber(0))
+		return 2
+	}
+
+	//a function replacement may call gsub itself
+	outer := sl.building
+	defer func() { sl.building = outer }()
+
+	var sb strings.Builder
+	end := 0
+	for _, md := range matches {
+		if ctx := L.Context(); ctx != nil && ctx.Err() != nil {
+			L.RaiseError("%s", ctx.Err())
+		}
+		sl.build(L, &sb, str[end:md.Capture(0)])
+		end = md.Capture(1)
+
+		var value lua.LValue
+		switch r := repl.(type) {
+		case lua.LString:
+			sl.expandReplacement(L, &sb, str, string(r), md)
+			continue
+		case *lua.LTable:
+			idx := 0
+			if md.CaptureLength() > 2 {
+				idx = 2
+			}
+			if md.IsPosCapture(idx) {
+				value = L.GetTable(r, lua.LNumber(md.Capture(idx)))
+			} else {
+				value = L.GetField(r, str[md.Capture(idx):md.Capture(idx+1)])
+			}
+		case *lua.LFunction:
+			L.Push(r)
+			nargs := 0
+			for i := 2; i < md.CaptureLength(); i += 2 {
+				L.Push(capturedValue(L, str, md, i))
+				nargs++
+			}
+			if nargs == 0 {
+				L.Push(capturedValue(L, str, md, 0))
+				nargs++
+			}
+			L.Call(nargs, 1)
+			value = L.Get(-1)
+			L.Pop(1)
+		}
+		if lua.LVIsFalse(value) {
+			sl.build(L, &sb, str[md.Capture(0):md.Capture(1)])
+		} else {
+			sl.build(L, &sb, lua.LVAsString(value))
+		}
+	}
+	sl.build(L, &sb, str[end:])
+
+	L.Push(lua.LString(sb.String()))
+	L.Push(lua.LNumber(len(matches)))
+	return 2
+}
+
+//expands a gsub replacement string for a match: %0 to %9 are the captures and
+//%% is a percent sign
+func (sl *scriptLimiter) expandReplacement(L *lua.LState, sb *strings.Builder, str, repl string, md *pm.MatchData) {
+	for i := 0; i < len(repl); i++ {
+		if repl[i] != '%' || i == len(repl)-1 {
+			sl.build(L, sb, repl[i:i+1])
+			continue
+		}
+		i++
+		switch c := repl[i]; {
+		case c == '%':
+			sl.build(L, sb, "%")
+		case c >= '0' && c <= '9':
+			sl.build(L, sb, capturedValue(L, str, md, 2*int(c-'0')).String())
+		default:
+			sl.build(L, sb, repl[i-1:i+1])
+		}
+	}
+}
+
+//the capture at idx of a match, idx 0 is the whole match. As in lua, %1 is the
+//whole match when the pattern has no captures
+func capturedValue(L *lua.LState, str string, md *pm.MatchData, idx int) lua.LValue {
+	if idx > 2 && idx >= md.CaptureLength() {
+		L.RaiseError("invalid capture index")
+	}
+	if idx == 2 && idx >= md.CaptureLength() {
+		idx = 0
+	}
+	if md.IsPosCapture(idx) {
+		return lua.LNumber(md.Capture(idx))
+	}
+	return lua.LString(str[md.Capture(idx):md.Capture(idx+1)])
+}
+
+//build appends s to a result being built for the script, accounting for it first
+func (sl *scriptLimiter) build(L *lua.LState, sb *strings.Builder, s string) {
+	sl.allocate(L, len(s))
+	sl.building += len(s)
+	sb.WriteString(s)
+}
+
+//error and assert are how a script raises errors of its own. Record the value
+//of those errors so they are not mistaken for the VM's
+func (sl *scriptLimiter) wrapRaise(lState *lua.LState, name string) {
+	orig, ok := lState.GetGlobal(name).(*lua.LFunction)
+	if !ok {
+		return
+	}
+	lState.SetGlobal(name, lState.NewFunction(func(L *lua.LState) int {
+		defer func() {
+			if r := recover(); r != nil {
+				if apiErr, ok := r.(*lua.ApiError); ok {
+					sl.raised = apiErr.Object
+				}
+				panic(r)
+			}
+		}()
+		return callOriginal(L, orig)
+	}))
+}
+
+//pcall and xpcall would let a script catch the error raised when a limit is
+//exceeded and carry on, so raise it again
+func (sl *scriptLimiter) wrapProtectedCall(lState *lua.LState, name string) {
+	orig, ok := lState.GetGlobal(name).(*lua.LFunction)
+	if !ok {
+		return
+	}
+	lState.SetGlobal(name, lState.NewFunction(func(L *lua.LState) int {
+		nret := callOriginal(L, orig)
+		if nret >= 2 && L.Get(1) == lua.LFalse {
+			sl.noteErrorValue(L.Get(2))
+		}
+		if sl.exceeded != nil {
+			L.RaiseError("%s", sl.exceeded.Error())
+		}
+		return nret
+	}))
+}
+
+//calls a lua function with the arguments of the current call, leaving only its
+//results on the stack
+func callOriginal(L *lua.LState, fn *lua.LFunction) int {
+	nargs := L.GetTop()
+	L.Insert(fn, 1)
+	L.Call(nargs, lua.MultRet)
+	return L.GetTop()
+}
+
+//finds a function in a library table
+func libFunction(lState *lua.LState, lib, name string) (*lua.LFunction, *lua.LTable) {
+	mod, ok := lState.GetGlobal(lib).(*lua.LTable)
+	if !ok {
+		return nil, nil
+	}
+	fn, ok := lState.GetField(mod, name).(*lua.LFunction)
+	if !ok {
+		return nil, nil
+	}
+	return fn, mod
+}
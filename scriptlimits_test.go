@@ -0,0 +1,321 @@
+package tablib
+
+/*
+These tests focus on the Lua sandbox limits
+*/
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func executeLimited(lua string, t *testing.T, opts ...RepositoryOption) (map[string]string, error) {
+	t.Helper()
+	repo := NewTableRepository(opts...)
+	failOnErr("Unable to add script", repo.AddLuaScript("test", lua), t)
+	return repo.ExecuteContext(context.Background(), "test", nil)
+}
+
+func TestScriptLimits_shouldTerminateLongRunningScript(t *testing.T) {
+	lua := `
+  results = {}
+  function main(goData)
+  while true do end
+  end
+  `
+
+	mp, err := executeLimited(lua, t, WithScriptTimeout(50*time.Millisecond))
+	expectLimitError(err, LimitScriptTime, 50, t)
+	if mp != nil {
+		t.Errorf("Unexpected script results: %v", mp)
+	}
+
+	//without a context the error is reported in the map
+	repo := NewTableRepository(WithScriptTimeout(50 * time.Millisecond))
+	repo.AddLuaScript("test", lua)
+	mp = repo.Execute("test", nil)
+	if len(mp) != 1 || mp["Script-Error"] != "Script: test exceeded max run time of: 50ms" {
+		t.Errorf("Unexpected script results: %v", mp)
+	}
+}
+
+func TestScriptLimits_shouldTerminateDeepRecursion(t *testing.T) {
+	lua := `
+  results = {}
+  local function deeper(n)
+    return deeper(n + 1) + 1
+  end
+  function main(goData)
+  results["val"] = deeper(1)
+  end
+  `
+
+	_, err := executeLimited(lua, t, WithScriptCallStackSize(64))
+	expectLimitError(err, LimitScriptCallStack, 64, t)
+}
+
+func TestScriptLimits_shouldNotLetPcallHideLimits(t *testing.T) {
+	lua := `
+  results = {}
+  local function deeper(n)
+    return deeper(n + 1) + 1
+  end
+  function main(goData)
+  local ok = pcall(deeper, 1)
+  results["val"] = "carried on"
+  end
+  `
+
+	mp, err := executeLimited(lua, t, WithScriptCallStackSize(64))
+	expectLimitError(err, LimitScriptCallStack, 64, t)
+	if mp != nil {
+		t.Errorf("Script was not terminated: %v", mp)
+	}
+
+	lua = `
+  results = {}
+  function main(goData)
+  local ok = pcall(string.rep, "x", 2000)
+  results["val"] = "carried on"
+  end
+  `
+	_, err = executeLimited(lua, t, WithScriptMemoryLimit(1000))
+	expectLimitError(err, LimitScriptMemory, 1000, t)
+}
+
+func TestScriptLimits_shouldTerminateRegistryOverflow(t *testing.T) {
+	lua := `
+  results = {}
+  function main(goData)
+  local t = {}
+  for i = 1, 1000 do t[i] = i end
+  results["val"] = select("#", unpack(t))
+  end
+  `
+
+	_, err := executeLimited(lua, t, WithScriptRegistrySize(256))
+	expectLimitError(err, LimitScriptRegistry, 256, t)
+
+	//the default registry is big enough
+	mp, err := executeLimited(lua, t)
+	if err != nil || mp["val"] != "1000" {
+		t.Errorf("Unexpected script results: %v %v", mp, err)
+	}
+}
+
+func TestScriptLimits_shouldLimitStringMemory(t *testing.T) {
+	for name, lua := range map[string]string{
+		"rep": `
+  results = {}
+  function main(goData)
+  results["val"] = string.rep("ab", 600)
+  end
+  `,
+		"method": `
+  results = {}
+  function main(goData)
+  local s = "ab"
+  results["val"] = s:rep(1e15)
+  end
+  `,
+		"concat": `
+  results = {}
+  function main(goData)
+  local parts = {}
+  for i = 1, 200 do parts[i] = "0123456789" end
+  results["val"] = table.concat(parts)
+  end
+  `,
+		"tables": `
+  local t = require("tables")
+  results = {}
+  function main(goData)
+  local parts = {}
+  for i = 1, 200 do parts[tostring(i)] = "0123456789" end
+  results["val"] = t.concat(parts)
+  end
+  `,
+		"gsub": `
+  results = {}
+  function main(goData)
+  results["val"] = string.gsub(string.rep("x", 20), ".", string.rep("y", 100))
+  end
+  `,
+		"format": `
+  results = {}
+  function main(goData)
+  results["val"] = string.format("%2000d", 1)
+  end
+  `,
+	} {
+		_, err := executeLimited(lua, t, WithScriptMemoryLimit(1000))
+		var le *LimitError
+		if !errors.As(err, &le) || le.Limit != LimitScriptMemory {
+			t.Errorf("%s: did not receive expected memory error: %v", name, err)
+		}
+	}
+
+	//within limits
+	mp, err := executeLimited(`
+  results = {}
+  function main(goData)
+  results["val"] = string.rep("ab", 400)
+  end
+  `, t, WithScriptMemoryLimit(1000))
+	if err != nil || len(mp["val"]) != 800 {
+		t.Errorf("Unexpected script results: %v", err)
+	}
+
+	//strings the script has let go of are not counted
+	mp, err = executeLimited(`
+  results = {}
+  function main(goData)
+  for i = 1, 100 do
+    results["val"] = string.rep("x", 200) .. string.format("%d", i)
+    results["val"] = string.gsub(results["val"], "x", "y")
+  end
+  end
+  `, t, WithScriptMemoryLimit(1000))
+	if err != nil || len(mp["val"]) != 203 {
+		t.Errorf("Unexpected script results: %v %v", mp, err)
+	}
+}
+
+func TestScriptLimits_shouldStopGsubBeforeItBuildsTooMuch(t *testing.T) {
+	lua := `
+  results = {}
+  function main(goData)
+  results["val"] = string.gsub(string.rep("x", 2000), ".", string.rep("y", 5000))
+  end
+  `
+
+	start := time.Now()
+	_, err := executeLimited(lua, t, WithScriptMemoryLimit(1024*1024), WithScriptTimeout(2*time.Second))
+	expectLimitError(err, LimitScriptMemory, 1024*1024, t)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("gsub ran for: %s", elapsed)
+	}
+}
+
+func TestScriptLimits_shouldGsubAsLuaDoes(t *testing.T) {
+	mp, err := executeLimited(`
+  results = {}
+  function main(goData)
+  results["captures"] = string.gsub("hello world", "(%w+) (%w+)", "%2 %1 %0 %%")
+  results["table"] = string.gsub("$name is $age", "%$(%w+)", {name = "bob"})
+  results["func"] = string.gsub("abc", "%w", function(c) return c:upper() .. "." end)
+  results["empty"] = string.gsub("abc", "", "-")
+  results["limit"], results["count"] = string.gsub("aaa", "a", "b", 2)
+  results["none"] = string.gsub("abc", "x", "y")
+  end
+  `, t)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for key, expected := range map[string]string{
+		"captures": "world hello hello world %",
+		"table":    "bob is $age",
+		"func":     "A.B.C.",
+		"empty":    "-a-b-c-",
+		"limit":    "bba",
+		"count":    "2",
+		"none":     "abc",
+	} {
+		if mp[key] != expected {
+			t.Errorf("%s: expected: %q, received: %q", key, expected, mp[key])
+		}
+	}
+}
+
+func TestScriptLimits_shouldNotMistakeScriptErrorsForLimits(t *testing.T) {
+	for _, lua := range []string{`
+  results = {}
+  function main(goData)
+  error("stack overflow")
+  end
+  `, `
+  results = {}
+  function main(goData)
+  local ok, msg = pcall(error, "registry overflow")
+  results["val"] = msg
+  end
+  `} {
+		mp, err := executeLimited(lua, t)
+		if err != nil || len(mp) != 1 {
+			t.Errorf("Unexpected script results: %v %v", mp, err)
+		}
+	}
+}
+
+func TestScriptLimits_shouldLimitHeldMemory(t *testing.T) {
+	for name, lua := range map[string]string{
+		"doubling": `
+  results = {}
+  function main(goData)
+  local s = "x"
+  for i = 1, 24 do s = s .. s end
+  results["val"] = #s
+  end
+  `,
+		"appending": `
+  results = {}
+  local s = ""
+  function main(goData)
+  for i = 1, 100000 do s = s .. "x" end
+  results["val"] = #s
+  end
+  `,
+		"table": `
+  results = {}
+  function main(goData)
+  local t = {}
+  for i = 1, 1000000 do t[i] = i end
+  results["val"] = #t
+  end
+  `,
+		"global": `
+  results = {}
+  words = {}
+  for i = 1, 1000000 do words[i] = "word" .. i end
+  function main(goData)
+  results["val"] = #words
+  end
+  `,
+	} {
+		mp, err := executeLimited(lua, t, WithScriptMemoryLimit(1024))
+		expectLimitError(err, LimitScriptMemory, 1024, t)
+		if mp != nil {
+			t.Errorf("%s: script was not terminated: %v", name, mp)
+		}
+	}
+
+	//pcall can not hide it
+	_, err := executeLimited(`
+  results = {}
+  function main(goData)
+  local ok = pcall(function()
+    local s = "x"
+    for i = 1, 24 do s = s .. s end
+  end)
+  results["val"] = "carried on"
+  end
+  `, t, WithScriptMemoryLimit(1024))
+	expectLimitError(err, LimitScriptMemory, 1024, t)
+
+	//what the script is given to start with is not counted, nor what it has let go
+	mp, err := executeLimited(`
+  results = {}
+  function main(goData)
+  for i = 1, 2000 do
+    local s = "x"
+    for j = 1, 8 do s = s .. s end
+  end
+  results["val"] = "done"
+  end
+  `, t, WithScriptMemoryLimit(1024))
+	if err != nil || mp["val"] != "done" {
+		t.Errorf("Unexpected script results: %v %v", mp, err)
+	}
+}
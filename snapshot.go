@@ -0,0 +1,252 @@
+package tablib
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"tablib/dice"
+	"tablib/table"
+	"tablib/util"
+	"tablib/validate"
+)
+
+//SnapshotVersion is the format version of the snapshots written by SaveSnapshot.
+//It changes whenever the format changes in a way older versions can not read
+const SnapshotVersion = 1
+
+const snapshotMagic = "tablib-snapshot"
+
+//ErrSnapshotVersion is returned by LoadSnapshot for snapshots written in an
+//incompatible format version
+var ErrSnapshotVersion = errors.New("incompatible snapshot format version")
+
+//a snapshot is written as a header followed by the body so the version can be
+//checked before an incompatible body is decoded
+type snapshotHeader struct {
+	Magic   string
+	Version int
+}
+
+type snapshotBody struct {
+	Tables  []*snapshotTable //including inline tables
+	Scripts []*snapshotScript
+}
+
+type snapshotTable struct {
+	Name   string
+	Source string
+	Table  *table.Table
+	Tags   []string
+}
+
+type snapshotScript struct {
+	Name   string
+	Source string
+	Tags   []string
+}
+
+var registerSnapshotTypes sync.Once
+
+//dice expressions are stored as interfaces so their concrete types must be
+//known to gob
+func registerDiceTypes() {
+	registerSnapshotTypes.Do(func() {
+		gob.Register(&dice.Constant{})
+		gob.Register(&dice.Roll{})
+		gob.Register(&dice.BinaryOp{})
+		gob.Register(&dice.Negation{})
+		gob.Register(&dice.Group{})
+	})
+}
+
+func (cr *concreteTableRepo) SaveSnapshot(w io.Writer) error {
+	registerDiceTypes()
+
+	cr.lock.RLock()
+	body := &snapshotBody{
+		Tables:  make([]*snapshotTable, 0, len(cr.tableStore)),
+		Scripts: make([]*snapshotScript, 0, len(cr.scriptStore)),
+	}
+	for name, td := range cr.tableStore {
+		body.Tables = append(body.Tables, &snapshotTable{
+			Name:   name,
+			Source: td.yamlSource,
+			Table:  td.parsedTable,
+			Tags:   td.tags,
+		})
+	}
+	for name, sd := range cr.scriptStore {
+		body.Scripts = append(body.Scripts, &snapshotScript{
+			Name:   name,
+			Source: sd.scriptSource,
+			Tags:   sd.tags,
+		})
+	}
+	cr.lock.RUnlock()
+
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(&snapshotHeader{Magic: snapshotMagic, Version: SnapshotVersion}); err != nil {
+		return err
+	}
+	return enc.Encode(body)
+}
+
+func (cr *concreteTableRepo) LoadSnapshot(r io.Reader) error {
+	registerDiceTypes()
+
+	dec := gob.NewDecoder(r)
+	var header snapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return fmt.Errorf("Unable to read snapshot: %w", err)
+	}
+	if header.Magic != snapshotMagic {
+		return errors.New("Unable to read snapshot: not a repository snapshot")
+	}
+	if header.Version != SnapshotVersion {
+		return fmt.Errorf("Snapshot version: %d can not be loaded, expected version: %d: %w",
+			header.Version, SnapshotVersion, ErrSnapshotVersion)
+	}
+	var body snapshotBody
+	if err := dec.Decode(&body); err != nil {
+		return fmt.Errorf("Unable to read snapshot: %w", err)
+	}
+
+	//a damaged or edited snapshot may decode without error but hold tables that
+	//are incomplete or inconsistent. Tables are not validated again, which would
+	//undo the point of a snapshot, but each is checked to be whole and its dice
+	//are parsed again from its roll
+	parents := make(map[string]*table.Table)
+	for _, st := range body.Tables {
+		if err := restoreTable(st); err != nil {
+			return fmt.Errorf("Unable to read snapshot: %w", err)
+		}
+		if !st.Table.IsInlineTable {
+			parents[st.Name] = st.Table
+		}
+	}
+	for _, st := range body.Tables {
+		if st.Table.IsInlineTable && !definesInline(parents, st.Name) {
+			return fmt.Errorf("Unable to read snapshot: inline table: %s has no table defining it", st.Name)
+		}
+	}
+	for _, ss := range body.Scripts {
+		if ss == nil {
+			return errors.New("Unable to read snapshot: a script is missing")
+		}
+	}
+
+	//gopher-lua can not restore compiled scripts so they are compiled again.
+	//Do so before taking the lock, as AddLuaScript does
+	scripts := make(map[string]*scriptData, len(body.Scripts))
+	for _, ss := range body.Scripts {
+		proto, err := compileLuaScript(ss.Source)
+		if err != nil {
+			return fmt.Errorf("Unable to compile script: %s from snapshot: %w", ss.Name, err)
+		}
+		scripts[ss.Name] = &scriptData{
+			scriptSource: ss.Source,
+			parsedScript: proto,
+			tags:         ss.Tags,
+		}
+	}
+
+	cr.lock.Lock()
+	defer cr.lock.Unlock()
+
+	//the snapshot replaces everything in the repository
+	cr.tableStore = make(map[string]*tableData, len(body.Tables))
+	cr.scriptStore = scripts
+	cr.tagSearchCache = make(map[string][]*SearchResult)
+	cr.nameSearchCache = make(map[string]*SearchResult)
+	for _, st := range body.Tables {
+		cr.tableStore[st.Name] = &tableData{
+			yamlSource:  st.Source,
+			parsedTable: st.Table,
+			tags:        st.Tags,
+		}
+		if !st.Table.IsInlineTable {
+			cr.updateTagCache(st.Name, itemTypeTable, st.Tags)
+			cr.addToNameCache(st.Name, itemTypeTable, st.Tags)
+		}
+	}
+	for name, sd := range scripts {
+		cr.updateTagCache(name, itemTypeScript, sd.tags)
+		cr.addToNameCache(name, itemTypeScript, sd.tags)
+	}
+	return nil
+}
+
+//checks a table from a snapshot holds what executing it needs and parses its
+//dice again. These checks are cheap, unlike validating the table
+func restoreTable(st *snapshotTable) error {
+	if st == nil || st.Table == nil || st.Table.Definition == nil {
+		return errors.New("a table is missing its definition")
+	}
+	tbl, def := st.Table, st.Table.Definition
+	if st.Name != def.Name {
+		return fmt.Errorf("table: %s is stored as: %s", def.Name, st.Name)
+	}
+	if !tbl.IsInlineTable {
+		vr := validate.NewValidationResult()
+		util.IsValidName(def.Name, "Name", "Definition", vr)
+		if !vr.Valid() {
+			return fmt.Errorf("table: %s has an invalid name", def.Name)
+		}
+	}
+	if len(tbl.RawContent) == 0 {
+		return fmt.Errorf("table: %s has no content", def.Name)
+	}
+
+	switch def.TableType {
+	case table.TypeFlat:
+	case table.TypeRange:
+		if len(tbl.RangeContent) != len(tbl.RawContent) {
+			return fmt.Errorf("table: %s is missing its ranges", def.Name)
+		}
+		for _, rc := range tbl.RangeContent {
+			if rc == nil {
+				return fmt.Errorf("table: %s is missing its ranges", def.Name)
+			}
+		}
+		expr, err := dice.Parse(def.Roll)
+		if err != nil {
+			return fmt.Errorf("table: %s has an invalid roll: %w", def.Name, err)
+		}
+		def.DiceParsed = expr
+		return nil
+	case table.TypeWeighted:
+		if len(tbl.WeightedContent) != len(tbl.RawContent) {
+			return fmt.Errorf("table: %s is missing its weights", def.Name)
+		}
+		for _, wc := range tbl.WeightedContent {
+			if wc == nil || wc.Weight < 1 {
+				return fmt.Errorf("table: %s has an invalid weight", def.Name)
+			}
+		}
+	default:
+		return fmt.Errorf("table: %s has unknown type: %s", def.Name, def.TableType)
+	}
+	addDiceParseResultForFlatAndInlineTables(tbl)
+	return nil
+}
+
+//reports whether one of the tables defines the named inline table
+func definesInline(parents map[string]*table.Table, name string) bool {
+	idx := strings.LastIndex(name, ".")
+	if idx == -1 {
+		return false
+	}
+	parent, found := parents[name[:idx]]
+	if !found {
+		return false
+	}
+	for _, n := range parent.InlineNames() {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+package tablib
+
+/*
+These tests focus on saving and loading repository snapshots
+*/
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"tablib/dice"
+	"tablib/table"
+	"testing"
+)
+
+const (
+	snapshotYmlRange = `
+  definition:
+    name: Snapshot_Range
+    type: range
+    roll: 1d4 + 1
+    tags:
+      - snap
+  content:
+    - "{2-3}low {#1}"
+    - "{4-5}high"
+  inline:
+    - id: 1
+      content:
+        - inline item`
+
+	snapshotLua = `
+  --TAGS: snap, script
+  local t = require("tables")
+  results = {}
+  function main()
+    results["range"] = t.roll("Snapshot_Range")
+    results["weighted"] = t.roll("TestTable_Weighted")
+  end`
+)
+
+var snapshotYmls = []string{snapshotYmlRange, weightedYml}
+
+func TestSnapshot_shouldRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	saved := newTestRepo(t, snapshotYmls)
+	failOnErr("Unable to add script", saved.AddLuaScript("Snapshot_Script", snapshotLua), t)
+	err := saved.SaveSnapshot(&buf)
+	failOnErr("Unable to save snapshot", err, t)
+
+	repo := NewTableRepository(WithRandomSource(NewScriptedRandomSource(1, 1, 9)))
+	err = repo.LoadSnapshot(&buf)
+	failOnErr("Unable to load snapshot", err, t)
+
+	items, err := repo.Search("", nil)
+	failOnErr("Unable to search", err, t)
+	if len(items) != 3 {
+		t.Fatalf("Unexpected items: %d", len(items))
+	}
+	tags := repo.Tags()
+	if len(tags) != 2 || tags[0] != "script" || tags[1] != "snap" {
+		t.Errorf("Unexpected tags: %v", tags)
+	}
+	src, err := repo.List("Snapshot_Range", "table")
+	if err != nil || src != snapshotYmlRange {
+		t.Errorf("Table source not restored: %v", err)
+	}
+	src, err = repo.List("Snapshot_Script", "script")
+	if err != nil || src != snapshotLua {
+		t.Errorf("Script source not restored: %v", err)
+	}
+
+	//1d4 + 1 rolls 2 for the low row and its inline table, then the weighted
+	//table rolls its last row
+	res := repo.Execute("Snapshot_Script", nil)
+	if res["range"] != "low inline item" || res["weighted"] != "troll" {
+		t.Errorf("Unexpected results: %v", res)
+	}
+}
+
+func TestSnapshot_shouldReplaceRepositoryContents(t *testing.T) {
+	var buf bytes.Buffer
+	err := newTestRepo(t, snapshotYmls).SaveSnapshot(&buf)
+	failOnErr("Unable to save snapshot", err, t)
+
+	repo := newTestRepo(t, graphYmls)
+	err = repo.LoadSnapshot(&buf)
+	failOnErr("Unable to load snapshot", err, t)
+
+	if _, err := repo.List("Top", "table"); err == nil {
+		t.Error("Table should have been replaced by the snapshot")
+	}
+	if items, _ := repo.Search("Leaf", nil); len(items) != 0 {
+		t.Errorf("Name cache should have been replaced: %v", items)
+	}
+	if tr := repo.Roll("TestTable_Weighted", 1); len(tr.Result) != 1 {
+		t.Errorf("Unable to roll restored table: %v", tr.Log)
+	}
+}
+
+func TestSnapshot_shouldRefuseOtherVersions(t *testing.T) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	err := enc.Encode(&snapshotHeader{Magic: snapshotMagic, Version: SnapshotVersion + 1})
+	failOnErr("Unable to write header", err, t)
+
+	repo := newTestRepo(t, graphYmls)
+	err = repo.LoadSnapshot(&buf)
+	if !errors.Is(err, ErrSnapshotVersion) {
+		t.Fatalf("Expected a version error: %v", err)
+	}
+	if _, err := repo.List("Top", "table"); err != nil {
+		t.Error("Repository should be unchanged after a failed load")
+	}
+}
+
+func TestSnapshot_shouldRefuseOtherData(t *testing.T) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	err := enc.Encode(&snapshotHeader{Magic: "something else", Version: SnapshotVersion})
+	failOnErr("Unable to write header", err, t)
+
+	repo := NewTableRepository()
+	if err := repo.LoadSnapshot(&buf); err == nil {
+		t.Error("Expected an error loading foreign data")
+	}
+	if err := repo.LoadSnapshot(bytes.NewReader([]byte("not a snapshot"))); err == nil {
+		t.Error("Expected an error loading garbage")
+	}
+}
+
+func TestSnapshot_shouldRefuseCorruptTables(t *testing.T) {
+	registerDiceTypes()
+	for _, st := range []*snapshotTable{
+		{Name: "NoTable", Source: "definition:"},
+		{Name: "NoDefinition", Table: &table.Table{RawContent: []string{"item"}}},
+		{Name: "Bad name", Table: &table.Table{
+			Definition: &table.DefinitionPart{Name: "Bad name", TableType: table.TypeFlat},
+			RawContent: []string{"item"}}},
+		{Name: "Renamed", Table: &table.Table{
+			Definition: &table.DefinitionPart{Name: "Original", TableType: table.TypeFlat},
+			RawContent: []string{"item"}}},
+		{Name: "BadRange", Table: &table.Table{
+			Definition: &table.DefinitionPart{Name: "BadRange", TableType: table.TypeRange, Roll: "1d4"},
+			RawContent: []string{"{1-2}low"}}},
+		{Name: "NoWeights", Table: &table.Table{
+			Definition: &table.DefinitionPart{Name: "NoWeights", TableType: table.TypeWeighted},
+			RawContent: []string{"{1}item"}}},
+		{Name: "Orphan.1", Table: &table.Table{
+			Definition:    &table.DefinitionPart{Name: "Orphan.1", TableType: table.TypeFlat},
+			RawContent:    []string{"item"},
+			IsInlineTable: true}},
+	} {
+		var buf bytes.Buffer
+		enc := gob.NewEncoder(&buf)
+		err := enc.Encode(&snapshotHeader{Magic: snapshotMagic, Version: SnapshotVersion})
+		failOnErr("Unable to write header", err, t)
+		err = enc.Encode(&snapshotBody{Tables: []*snapshotTable{st}})
+		failOnErr("Unable to write body", err, t)
+
+		repo := newTestRepo(t, graphYmls)
+		if err := repo.LoadSnapshot(&buf); err == nil {
+			t.Errorf("%s: expected an error loading a corrupt snapshot", st.Name)
+		}
+		if _, err := repo.List("Top", "table"); err != nil {
+			t.Errorf("%s: repository should be unchanged after a failed load", st.Name)
+		}
+	}
+}
+
+func TestSnapshot_shouldRefuseInlineTablesNotDefined(t *testing.T) {
+	var buf bytes.Buffer
+	failOnErr("Unable to save snapshot", newTestRepo(t, graphYmls).SaveSnapshot(&buf), t)
+
+	dec := gob.NewDecoder(&buf)
+	var header snapshotHeader
+	var body snapshotBody
+	failOnErr("Unable to read header", dec.Decode(&header), t)
+	failOnErr("Unable to read body", dec.Decode(&body), t)
+	for _, st := range body.Tables {
+		if st.Name == "Top.1" {
+			st.Name, st.Table.Definition.Name = "Top.9", "Top.9"
+		}
+	}
+	buf.Reset()
+	enc := gob.NewEncoder(&buf)
+	failOnErr("Unable to write header", enc.Encode(&header), t)
+	failOnErr("Unable to write body", enc.Encode(&body), t)
+
+	if err := NewTableRepository().LoadSnapshot(&buf); err == nil {
+		t.Error("Expected an error loading an inline table its parent does not define")
+	}
+}
+
+func TestSnapshot_shouldParseDiceAgain(t *testing.T) {
+	var buf bytes.Buffer
+	err := newTestRepo(t, snapshotYmls).SaveSnapshot(&buf)
+	failOnErr("Unable to save snapshot", err, t)
+
+	//damage the dice, which are parsed again from each table's roll
+	dec := gob.NewDecoder(&buf)
+	var header snapshotHeader
+	var body snapshotBody
+	failOnErr("Unable to read header", dec.Decode(&header), t)
+	failOnErr("Unable to read body", dec.Decode(&body), t)
+	for _, st := range body.Tables {
+		st.Table.Definition.DiceParsed = &dice.Constant{Value: 99}
+	}
+	buf.Reset()
+	enc := gob.NewEncoder(&buf)
+	failOnErr("Unable to write header", enc.Encode(&header), t)
+	failOnErr("Unable to write body", enc.Encode(&body), t)
+
+	repo := NewTableRepository()
+	failOnErr("Unable to load snapshot", repo.LoadSnapshot(&buf), t)
+	for _, name := range []string{"Snapshot_Range", "TestTable_Weighted"} {
+		if tr := repo.Roll(name, 5); tr.Err != nil || len(tr.Result) != 5 {
+			t.Errorf("%s: unable to roll on restored table: %v", name, tr.Err)
+		}
+	}
+}
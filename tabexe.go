@@ -1,8 +1,8 @@
 package tablib
 
 import (
+	"context"
 	"fmt"
-	"math/rand"
 	"strconv"
 	"strings"
 	"tablib/dice"
@@ -10,14 +10,6 @@ import (
 	res "tablib/tableresult"
 	"tablib/util"
 	"tablib/validate"
-	"time"
-)
-
-const (
-	//max number of table subcalls before we punt on possible recursion
-	//TODO: these should ultimately be a config param
-	defaultMaxCallDepth = 100
-	defaultPickDelim    = "|"
 )
 
 type workPackage struct {
@@ -26,33 +18,60 @@ type workPackage struct {
 	operation  string
 	count      int
 	pickCount  int
-	diceParsed []*dice.ParseResult
+	diceParsed dice.Expr
+	diceExpr   string
+
+	//execution trace bookkeeping. parent is the trace node of the work package
+	//that generated this one (nil for top-level requests), reference is the table
+	//ref that was expanded to create it and trace is this package's own node
+	parent    *res.TraceNode
+	reference string
+	trace     *res.TraceNode
 }
 
 type executionEngine struct {
-	callDepth int //number of table calls - prevent malicious or inadvertent circular refs with a hammer
-	rnd       *rand.Rand
+	//the tables currently being expanded, outermost first. A table that recurses
+	//too deeply (directly or through other tables) is stopped and the cycle named
+	callStack  []string
+	expansions int //tables rolled or picked on and dice rolled by this request
+	produced   int //bytes generated by completed results
+	ctx        context.Context
+	rnd        RandomSource
+	config     *executionConfig
 }
 
-func newExecutionEngine() *executionEngine {
+//the random source and config are owned by the repository so that every
+//execution draws from the same (possibly seeded) stream under the same limits.
+//Expansion stops if the context is cancelled
+func newExecutionEngine(ctx context.Context, rnd RandomSource, config *executionConfig) *executionEngine {
 	return &executionEngine{
-		callDepth: 0,
-		rnd:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		ctx:       ctx,
+		callStack: make([]string, 0, config.maxCallDepth),
+		rnd:       rnd,
+		config:    config,
 	}
 }
 
 func (ee *executionEngine) execute(wp *workPackage, tr *res.TableResult) {
 
 	//quick check on sanity
-	if wp.count > defaultMaxCallDepth {
-		tr.AddLog(fmt.Sprintf("Too many rolls requested, max is: %d", defaultMaxCallDepth))
+	if wp.count > ee.config.maxRollCount {
+		ee.fail(tr, nil, newLimitError(LimitRollCount, ee.config.maxRollCount,
+			"Too many rolls requested, max is: %d", ee.config.maxRollCount))
 		return
 	}
 
 	for i := 1; i <= wp.count; i++ {
 		generated := ee.executeInternal(wp, tr)
+		if tr.Err != nil { //execution halted, the partial result is not useful
+			return
+		}
+		if !ee.checkOutputSize(len(generated), wp, tr) {
+			return
+		}
+		ee.produced += len(generated)
 		tr.AddResult(generated)
-		ee.callDepth = 0 //calldepth resets since this is a new roll/pick attempt
+		ee.callStack = ee.callStack[:0] //this is a new roll/pick attempt
 	}
 }
 
@@ -62,9 +81,34 @@ func (ee *executionEngine) execute(wp *workPackage, tr *res.TableResult) {
 //happes recursively until all tablerefs are resolved. See 'expandAllTableRefs()
 //below to see how this function is called recursively
 func (ee *executionEngine) executeInternal(wp *workPackage, tr *res.TableResult) string {
-	//TODO: eventually may want to call a goroutine and use contexts for timeout
-	//but skip that for now and see how things perform. Might be important in public
-	//servers to timeout an ill-behaved lua script or recursive table issue
+
+	//a fatal error elsewhere in the expansion stops all further work, as does
+	//the caller giving up
+	if tr.Err != nil {
+		return ""
+	}
+	if err := ee.ctx.Err(); err != nil {
+		ee.fail(tr, nil, fmt.Errorf("Execution cut off: %w", err))
+		return ""
+	}
+
+	//tables that refer to other tables several times over grow exponentially
+	//without recursing deeply, so cap the work done by any one request
+	ee.expansions++
+	if max := ee.config.maxExpansions; ee.expansions > max {
+		ee.fail(tr, nil, newLimitError(LimitExpansions, max,
+			"Table: %s exceeded max expansions of: %d", wp.table.Definition.Name, max))
+		return ""
+	}
+
+	//record this step in the execution trace
+	wp.trace = res.NewTraceNode(wp.table.Definition.Name, wp.operation)
+	wp.trace.Reference = wp.reference
+	if wp.parent == nil {
+		tr.AddTrace(wp.trace)
+	} else {
+		wp.parent.AddChild(wp.trace)
+	}
 
 	var generated string
 	switch wp.operation {
@@ -76,31 +120,50 @@ func (ee *executionEngine) executeInternal(wp *workPackage, tr *res.TableResult)
 		generated = ee.executePick(wp, tr)
 	case table.OpDice:
 		tr.AddLog(fmt.Sprintf("Executing dice roll on table: %s ", wp.table.Definition.Name))
-		generated = strconv.Itoa(ee.rollDice(wp.diceParsed))
+		rolledValue := ee.rollDice(wp.diceParsed)
+		wp.trace.DiceExpr = wp.diceExpr
+		wp.trace.Roll = rolledValue
+		generated = strconv.Itoa(rolledValue)
 	}
 
+	wp.trace.Result = generated
 	return generated
 }
 
 //picks n unique rows from a flat table
 func (ee *executionEngine) executePick(wp *workPackage, tr *res.TableResult) string {
 
-	//check call depth - will rolling here push us over?
-	if !ee.checkCallDepth(tr) {
-		return "Call depth exceeded!"
+	//check call depth - will picking here push us over?
+	if !ee.pushCall(wp, tr) {
+		return ""
 	}
+	defer ee.popCall()
 
 	//picking on range tables is not allowed
 	if wp.table.Definition.TableType == table.TypeRange {
-		tr.AddLog(fmt.Sprintf("Pick requested on ranged table: %s", wp.table.Definition.Name))
-		return "Pick on range table not allowed"
+		msg := fmt.Sprintf("Pick requested on ranged table: %s", wp.table.Definition.Name)
+		tr.AddLog(msg)
+		tr.AddError(&ExecutionError{Table: wp.table.Definition.Name, Row: -1, Err: ErrPickOnRange})
+		wp.trace.Error = msg
+		return ErrPickOnRange.Error()
 	}
 
 	//if asking for more picks than content, return content and a warning
-	if wp.pickCount >= len(wp.table.RawContent) {
+	rows := wp.table.ContentRows()
+	if wp.pickCount >= len(rows) {
 		tr.AddLog(fmt.Sprintf("Pick %d on table: %s requested but it has only %d entries",
-			wp.pickCount, wp.table.Definition.Name, len(wp.table.RawContent)))
-		return strings.Join(wp.table.RawContent, defaultPickDelim)
+			wp.pickCount, wp.table.Definition.Name, len(rows)))
+		for i := range rows {
+			wp.trace.Picks = append(wp.trace.Picks, i)
+		}
+		buf := strings.Join(rows, ee.config.pickDelim)
+		return ee.expandAllRefs(buf, wp, tr) //expand here so the refs are attributed to this pick
+	}
+
+	//weighted tables draw each pick from the weight of the rows not yet picked
+	if wp.table.Definition.TableType == table.TypeWeighted {
+		buf := strings.Join(ee.weightedPicks(wp, rows), ee.config.pickDelim)
+		return ee.expandAllRefs(buf, wp, tr)
 	}
 
 	//create a tracking slice to track picked values
@@ -125,31 +188,55 @@ func (ee *executionEngine) executePick(wp *workPackage, tr *res.TableResult) str
 			pickSlice[picked].p = true
 			remaining--
 			outSlice = append(outSlice, pickSlice[picked].v)
+			wp.trace.Picks = append(wp.trace.Picks, picked)
 		}
 	}
-	buf := strings.Join(outSlice, defaultPickDelim)
+	buf := strings.Join(outSlice, ee.config.pickDelim)
 	return ee.expandAllRefs(buf, wp, tr) //recurse in case this generate table refs
 }
 
-//randomly selects a row from a flat or range table
+//picks rows from a weighted table without replacement. Once picked, a row's
+//weight no longer counts towards the total so the chance of picking each
+//remaining row stays in proportion to its weight
+func (ee *executionEngine) weightedPicks(wp *workPackage, rows []string) []string {
+	weights := wp.table.Weights()
+	total := wp.table.TotalWeight()
+	outSlice := make([]string, 0, wp.pickCount)
+	for len(outSlice) < wp.pickCount {
+		picked := rowForWeight(weights, ee.rnd.Intn(total)+1)
+		total -= weights[picked]
+		weights[picked] = 0 //never picked again
+		outSlice = append(outSlice, rows[picked])
+		wp.trace.Picks = append(wp.trace.Picks, picked)
+	}
+	return outSlice
+}
+
+//randomly selects a row from a flat, range or weighted table
 func (ee *executionEngine) executeRoll(wp *workPackage, tr *res.TableResult) string {
 
 	//check call depth - will rolling here push us over?
-	if !ee.checkCallDepth(tr) {
+	if !ee.pushCall(wp, tr) {
 		return ""
 	}
+	defer ee.popCall()
 
 	//roll on the table
 	rolledValue := ee.rollDice(wp.table.Definition.DiceParsed)
 	tr.AddLog(fmt.Sprintf("Rolled: %d", rolledValue))
+	wp.trace.DiceExpr = diceExprForTable(wp.table)
+	wp.trace.Roll = rolledValue
 
 	//interpret the roll based on table type
 	var buf string
 	switch wp.table.Definition.TableType {
 	case table.TypeFlat:
 		buf = wp.table.RawContent[rolledValue-1]
+		wp.trace.Row = rolledValue - 1
 	case table.TypeRange:
-		buf = ee.rangeResultFromRoll(wp, rolledValue)
+		buf = ee.rangeResultFromRoll(wp, rolledValue, tr)
+	case table.TypeWeighted:
+		buf = ee.weightedResultFromRoll(wp, rolledValue)
 	}
 	return ee.expandAllRefs(buf, wp, tr)
 }
@@ -163,23 +250,27 @@ func (ee *executionEngine) expandAllRefs(buf string, wp *workPackage, tr *res.Ta
 		return buf
 	}
 
-	//here if need to expand at least one tableref
+	//here if need to expand at least one tableref. Each ref is replaced by its
+	//fully expanded result so only the rest of the buffer needs checking for refs
 	var sb strings.Builder
 	for exists { //there is at least one table ref remaining
-		sb.Reset()
-		sb.WriteString(bufParts[0]) //everything up to the first reference
+		sb.WriteString(bufParts[0]) //everything up to the next reference
 
 		//need to recurse here so set up the new work package's common elements
 		nextWp := &workPackage{
-			nameSvc: wp.nameSvc,
+			nameSvc:   wp.nameSvc,
+			parent:    wp.trace,
+			reference: bufParts[1],
 		}
 		safeAndSane := false //sanity checker - programming mistake trap
 
 		//what type of table ref do we have - build rest of workPkg...
 		if extMatches := table.ExternalCalledPattern.FindStringSubmatch(bufParts[1]); extMatches != nil {
-			tableRef, err := wp.nameSvc.tableForName(extMatches[1])
+			tablename := wp.nameSvc.resolveTableName(extMatches[1], wp.table.Definition.Name)
+			tableRef, err := wp.nameSvc.tableForName(tablename)
 			if err != nil {
 				tr.AddLog(fmt.Sprintf("%v", err))
+				traceBadRef(tablename, table.OpRoll, bufParts[1], err, wp, tr)
 				sb.WriteString(fmt.Sprintf(" --BADREF: %s--", bufParts[1]))
 				return sb.String()
 			}
@@ -195,6 +286,7 @@ func (ee *executionEngine) expandAllRefs(buf string, wp *workPackage, tr *res.Ta
 			//validation done but check for it anyway
 			if err != nil {
 				tr.AddLog(fmt.Sprintf("%v", err))
+				traceBadRef(tablename, table.OpRoll, bufParts[1], err, wp, tr)
 				sb.WriteString(fmt.Sprintf(" --BADREF: %s--", bufParts[1]))
 				return sb.String()
 			}
@@ -204,9 +296,11 @@ func (ee *executionEngine) expandAllRefs(buf string, wp *workPackage, tr *res.Ta
 			safeAndSane = true
 		}
 		if extMatches := table.PickCalledPattern.FindStringSubmatch(bufParts[1]); extMatches != nil {
-			tableRef, err := wp.nameSvc.tableForName(extMatches[2])
+			tablename := wp.nameSvc.resolveTableName(extMatches[2], wp.table.Definition.Name)
+			tableRef, err := wp.nameSvc.tableForName(tablename)
 			if err != nil {
 				tr.AddLog(fmt.Sprintf("%v", err))
+				traceBadRef(tablename, table.OpPick, bufParts[1], err, wp, tr)
 				sb.WriteString(fmt.Sprintf(" --BADREF: %s--", bufParts[1]))
 				return sb.String()
 			}
@@ -226,6 +320,7 @@ func (ee *executionEngine) expandAllRefs(buf string, wp *workPackage, tr *res.Ta
 				return sb.String()
 			}
 			nextWp.diceParsed = dpr
+			nextWp.diceExpr = extMatches[1]
 			nextWp.count = 1 //dice should be rolled once
 			nextWp.operation = table.OpDice
 			nextWp.table = wp.table //we arent switching tables
@@ -243,25 +338,36 @@ func (ee *executionEngine) expandAllRefs(buf string, wp *workPackage, tr *res.Ta
 		//recurse to expand the first ref found in bufParts
 		generated := ee.executeInternal(nextWp, tr)
 
+		//stop expanding if the recursion failed fatally
+		if tr.Err != nil {
+			return sb.String()
+		}
+
 		//capture the results of the recursion
 		sb.WriteString(generated)
+		rest := bufParts[2] //that part of the buffer that hasnt been checked for references
+		if !ee.checkOutputSize(sb.Len()+len(rest), wp, tr) {
+			sb.WriteString(rest)
+			return sb.String()
+		}
 
-		//tack on that part of the buffer that hasnt been checked for references
-		sb.WriteString(bufParts[2])
-
-		//assemble the string - do we still have tablerefs to be expanded?
-		replacedString := sb.String()
-		bufParts, exists = util.FindNextTableRef(replacedString)
+		//do we still have tablerefs to be expanded?
+		bufParts, exists = util.FindNextTableRef(rest)
+		if !exists {
+			sb.WriteString(rest)
+		}
 	}
 	return sb.String()
 }
 
 //use the result of a roll to determine which ranged content item should be returned
-func (ee *executionEngine) rangeResultFromRoll(wp *workPackage, roll int) string {
-	for _, rc := range wp.table.RangeContent {
-		if roll >= rc.Low && roll <= rc.High {
-			return rc.Content
-		}
+func (ee *executionEngine) rangeResultFromRoll(wp *workPackage, roll int, tr *res.TableResult) string {
+	if idx := wp.table.RowForRoll(roll); idx != -1 {
+		rc := wp.table.RangeContent[idx]
+		wp.trace.Row = idx
+		wp.trace.RangeLow = rc.Low
+		wp.trace.RangeHigh = rc.High
+		return rc.Content
 	}
 
 	//this can happen if the range table is valid and the dice expression is valid
@@ -269,67 +375,116 @@ func (ee *executionEngine) rangeResultFromRoll(wp *workPackage, roll int) string
 	//only. In these cases, return a useful message
 	msg := fmt.Sprintf("ERROR: roll of %d exceeded bounds of table: %s",
 		roll, wp.table.Definition.Name)
+	tr.AddError(&ExecutionError{Table: wp.table.Definition.Name, Row: -1,
+		Err: fmt.Errorf("%w: %d", ErrRollOutOfRange, roll)})
+	wp.trace.Error = msg
 	return msg
 }
 
-//executes a dice roll as specified in the dice parsed result
-func (ee *executionEngine) rollDice(dpr []*dice.ParseResult) int {
-	//this algo could be made faster. It is written this way for debugging and
-	//clarity. Optimizing for speed is not a requirement of this lib at least for now
-
-	//step 1: roll each die expression and push those results independently
-	//into a slice. Furthermore, gather the operation meant to join each die result
-	//to the one following
-
-	//store the result of each die expression in a slice
-	values := make([]int, len(dpr), len(dpr)) //each roll's
-	ops := make([]string, len(dpr), len(dpr)) //its assoc operator
-	i := 0
-	for _, d := range dpr {
-		//handle constant at end eg 2d6 + 3
-		if d.DieType == 0 { //a die type of 0 means Count holds the constant
-			values[i] = d.Count
-			ops[i] = d.Operator //must be "none"
-			i++
-			continue
-		}
-		thisRoll := 0
-		for j := 1; j <= d.Count; j++ {
-			rndval := ee.rnd.Intn(d.DieType) + 1
-			thisRoll += rndval
+//use the result of a roll to determine which weighted content item should be
+//returned. Each row covers as many faces of the die as its weight
+func (ee *executionEngine) weightedResultFromRoll(wp *workPackage, roll int) string {
+	idx := rowForWeight(wp.table.Weights(), roll)
+	wp.trace.Row = idx
+	return wp.table.WeightedContent[idx].Content
+}
+
+//finds the row whose share of the total weight covers the given value, which
+//runs from 1 to the total weight
+func rowForWeight(weights []int, value int) int {
+	for idx, w := range weights {
+		if value <= w {
+			return idx
 		}
-		values[i] = thisRoll
-		ops[i] = d.Operator
-		i++
+		value -= w
 	}
+	return len(weights) - 1 //not reachable for values within the total weight
+}
 
-	//step2: utilize the operators between each die expression to calc the total
-	total := 0
-	for i := 0; i < len(values); i++ {
-		if i == 0 { //the first value rolled is always the initial total
-			total += values[0]
-			continue
-		}
-		switch ops[i-1] {
-		case "+":
-			total += values[i]
-		case "-":
-			total -= values[i]
-		case "*":
-			total = total * values[i]
-		}
+//records a table ref that could not be resolved in the result's errors and as a
+//failed child in the trace
+func traceBadRef(tableName, operation, reference string, err error, wp *workPackage, tr *res.TableResult) {
+	row := -1 //picks expand several rows at once
+	if wp.operation == table.OpRoll {
+		row = wp.trace.Row
 	}
-	return total
+	tr.AddError(&ExecutionError{Table: wp.table.Definition.Name, Row: row, Reference: reference, Err: err})
+
+	node := res.NewTraceNode(tableName, operation)
+	node.Reference = reference
+	node.Error = fmt.Sprintf("%v", err)
+	wp.trace.AddChild(node)
+}
+
+//the dice expression used to roll on a table. Flat and weighted tables have no
+//roll defined, they are rolled with a single die with one face per content row
+//or unit of weight
+func diceExprForTable(tbl *table.Table) string {
+	if tbl.Definition.Roll != "" {
+		return tbl.Definition.Roll
+	}
+	return fmt.Sprintf("1d%d", tbl.TotalWeight())
+}
+
+//executes a dice roll as specified in the dice parsed result
+func (ee *executionEngine) rollDice(dpr dice.Expr) int {
+	return dpr.Eval(ee.rnd)
 }
 
-//determine if we have had too many table refs and need to punt. This is a
-//brute force block to circular table dependencies (malicious or otherwise) as
-//only so many roll or picks are allowed before we stop resolving lookups
-func (ee *executionEngine) checkCallDepth(tr *res.TableResult) bool {
-	ee.callDepth++
-	if ee.callDepth > defaultMaxCallDepth {
-		tr.AddLog(fmt.Sprintf("Unable to roll on table, max call depth of: %d exceeded", defaultMaxCallDepth))
+//enter a table, failing if doing so recurses too deeply. Tables may refer to
+//themselves (directly or via other tables) so long as some row eventually
+//ends the recursion. If none do, the recursion is stopped, the cycle of tables
+//responsible is named and execution halts
+func (ee *executionEngine) pushCall(wp *workPackage, tr *res.TableResult) bool {
+	name := wp.table.Definition.Name
+	if len(ee.callStack) >= ee.config.maxCallDepth {
+		ee.fail(tr, wp, newLimitError(LimitCallDepth, ee.config.maxCallDepth,
+			"Table: %s exceeded max call depth of: %d via recursion: %s",
+			name, ee.config.maxCallDepth, recursionPath(ee.callStack, name)))
 		return false
 	}
+	ee.callStack = append(ee.callStack, name)
 	return true
 }
+
+//check that a result, or a partially expanded result, of the given size will not
+//push the total generated by this request over the configured limit
+func (ee *executionEngine) checkOutputSize(size int, wp *workPackage, tr *res.TableResult) bool {
+	max := ee.config.maxOutputSize
+	if ee.produced+size > max {
+		ee.fail(tr, wp, newLimitError(LimitOutputSize, max,
+			"Table: %s generated output exceeding max size of: %d bytes", wp.table.Definition.Name, max))
+		return false
+	}
+	return true
+}
+
+//halts execution with the given error. The work package is optional and is
+//used to record the error in the trace
+func (ee *executionEngine) fail(tr *res.TableResult, wp *workPackage, err error) {
+	tr.Err = err
+	tr.AddError(err)
+	tr.AddLog(err.Error())
+	if wp != nil && wp.trace != nil {
+		wp.trace.Error = err.Error()
+	}
+}
+
+//leave the table most recently entered via pushCall
+func (ee *executionEngine) popCall() {
+	ee.callStack = ee.callStack[:len(ee.callStack)-1]
+}
+
+//names the most recent cycle ending with the given table eg A -> B -> A. If the
+//table is not on the stack then the chain is simply too deep and all of it is named
+func recursionPath(stack []string, name string) string {
+	start := 0
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i] == name {
+			start = i
+			break
+		}
+	}
+	path := append(append(make([]string, 0, len(stack)-start+1), stack[start:]...), name)
+	return strings.Join(path, " -> ")
+}
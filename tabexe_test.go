@@ -8,8 +8,12 @@ some of these tests are more like integration tests than unit tests.
 */
 
 import (
+	"context"
+	"errors"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"tablib/dice"
 	"tablib/validate"
@@ -95,6 +99,27 @@ func TestRoll_shouldRollAsExpectedRange(t *testing.T) {
 	}
 }
 
+func TestRoll_shouldRollFullDiceSyntax(t *testing.T) {
+	yml := `
+  definition:
+    name: TestTable_Range
+    type: range
+    roll: 2d1kh1 + (1d1 * 2)
+  content:
+    - "{1-2}too low"
+    - "{3}item {$(2d1 + 1) / 2} {$-d1}"
+    - "{4-6}too high"`
+
+	repo := NewTableRepository()
+	vr, err := repo.AddTable([]byte(yml))
+	failOnErr("Unable to add table", err, t)
+	failOnInvalid("Invalid table", vr, t)
+	tr := repo.Roll("TestTable_Range", 1)
+	if len(tr.Result) != 1 || tr.Result[0] != "item 1 -1" {
+		t.Errorf("Unexpected results: %v", tr.Result)
+	}
+}
+
 func TestRoll_shouldhandleRangeDiceMismatch(t *testing.T) {
 	yml := `
   definition:
@@ -106,14 +131,16 @@ func TestRoll_shouldhandleRangeDiceMismatch(t *testing.T) {
     - "{1} item 1"
     - "{2} item 2"`
 
+	//a mismatch is caught when the table is added so it can never be rolled
 	repo := NewTableRepository()
-	repo.AddTable([]byte(yml))
-	tr := repo.Roll("TestTable_Range", 1)
-	if len(tr.Result) != 1 {
-		t.Error("Unexpected result count")
+	vr, err := repo.AddTable([]byte(yml))
+	failOnErr("Unable to parse table", err, t)
+	if vr.Valid() {
+		t.Fatal("Table with ranges not matching its roll was accepted")
 	}
-	if !strings.HasPrefix(tr.Result[0], "ERROR: roll of") {
-		t.Error("Should have received error but did not")
+	tr := repo.Roll("TestTable_Range", 1)
+	if len(tr.Result) != 0 || tr.Log[0] != "Table: TestTable_Range does not exist" {
+		t.Errorf("Unexpected result: %v %v", tr.Result, tr.Log)
 	}
 }
 
@@ -414,6 +441,59 @@ func TestRoll_shouldPreventInfinteInlineRecursion(t *testing.T) {
 	t.Log("Inline reference recursion test PASS")
 }
 
+func TestRoll_shouldNameRecursionCycle(t *testing.T) {
+	ymlA := `
+  definition:
+    name: Alpha
+    type: flat
+  content:
+    - "a {@Bravo}"`
+
+	ymlB := `
+  definition:
+    name: Bravo
+    type: flat
+  content:
+    - "b {1!Alpha}"`
+
+	repo := NewTableRepository()
+	repo.AddTable([]byte(ymlA))
+	repo.AddTable([]byte(ymlB))
+	tr := repo.Roll("Alpha", 3)
+	if tr.Err == nil {
+		t.Fatal("Did not receive expected recursion error")
+	}
+	if !strings.HasSuffix(tr.Err.Error(), "via recursion: Alpha -> Bravo -> Alpha") {
+		t.Errorf("Recursion error does not name the cycle: %v", tr.Err)
+	}
+	if len(tr.Result) != 0 {
+		t.Errorf("Unexpected results present: %v", tr.Result)
+	}
+	if tr.Log[len(tr.Log)-1] != tr.Err.Error() {
+		t.Error("Recursion error was not logged")
+	}
+}
+
+func TestRoll_shouldAllowRecursionWithExit(t *testing.T) {
+	yml := `
+  definition:
+    name: Again
+    type: flat
+  content:
+    - "again {@Again}"
+    - stop`
+
+	repo := NewTableRepository(WithRandomSource(NewScriptedRandomSource(1, 1, 1, 2)))
+	repo.AddTable([]byte(yml))
+	tr := repo.Roll("Again", 2)
+	if tr.Err != nil {
+		t.Fatalf("Unexpected error: %v", tr.Err)
+	}
+	if len(tr.Result) != 2 || tr.Result[0] != "again again again stop" || tr.Result[1] != "again again again stop" {
+		t.Errorf("Unexpected results: %v", tr.Result)
+	}
+}
+
 func TestRoll_shouldFailFastOnTooHighRollCount(t *testing.T) {
 	yml := `
   definition:
@@ -567,6 +647,84 @@ func TestPick_shouldErrorOnRangeTable(t *testing.T) {
 	}
 }
 
+const weightedYml = `
+  definition:
+    name: TestTable_Weighted
+    type: weighted
+  content:
+    - "{w:5} goblin"
+    - "{w:3} orc"
+    - troll`
+
+func TestRoll_shouldRollAsExpectedWeighted(t *testing.T) {
+	//faces 1-5 are goblins, 6-8 orcs and 9 the troll
+	repo := NewTableRepository(WithRandomSource(NewScriptedRandomSource(1, 5, 6, 8, 9)))
+	_, err := repo.AddTable([]byte(weightedYml))
+	failOnErr("Unable to add table", err, t)
+
+	tr := repo.Roll("TestTable_Weighted", 5)
+	want := []string{"goblin", "goblin", "orc", "orc", "troll"}
+	if len(tr.Result) != len(want) {
+		t.Fatalf("Unexpected results: %v", tr.Result)
+	}
+	for i := range want {
+		if tr.Result[i] != want[i] {
+			t.Errorf("Unexpected results: %v", tr.Result)
+		}
+	}
+	if tr.Trace[4].DiceExpr != "1d9" || tr.Trace[4].Row != 2 {
+		t.Errorf("Unexpected trace: %s %d", tr.Trace[4].DiceExpr, tr.Trace[4].Row)
+	}
+}
+
+func TestPick_shouldPickWeightedWithoutReplacement(t *testing.T) {
+	//the first pick is the orc (face 6 of 9), the second is drawn from the
+	//remaining weight of 6 so face 6 is now the troll
+	repo := NewTableRepository(WithRandomSource(NewScriptedRandomSource(6, 6)))
+	_, err := repo.AddTable([]byte(weightedYml))
+	failOnErr("Unable to add table", err, t)
+
+	tr := repo.Pick("TestTable_Weighted", 2)
+	if len(tr.Result) != 1 || tr.Result[0] != "orc|troll" {
+		t.Errorf("Unexpected results: %v", tr.Result)
+	}
+
+	//picking everything needs no draws
+	tr = repo.Pick("TestTable_Weighted", 3)
+	if len(tr.Result) != 1 || tr.Result[0] != "goblin|orc|troll" {
+		t.Errorf("Unexpected results: %v", tr.Result)
+	}
+}
+
+func TestPick_shouldRespectWeights(t *testing.T) {
+	yml := `
+  definition:
+    name: TestTable_Weighted
+    type: weighted
+  content:
+    - "{w:98} common"
+    - rare 1
+    - rare 2`
+
+	repo := NewTableRepository(WithRandomSource(NewSeededRandomSource(42)))
+	_, err := repo.AddTable([]byte(yml))
+	failOnErr("Unable to add table", err, t)
+
+	first := 0
+	for i := 0; i < 200; i++ {
+		tr := repo.Pick("TestTable_Weighted", 2)
+		if strings.HasPrefix(tr.Result[0], "common|") {
+			first++
+		}
+		if strings.Count(tr.Result[0], "common") > 1 {
+			t.Fatalf("Weighted pick repeated a row: %v", tr.Result)
+		}
+	}
+	if first < 180 {
+		t.Errorf("Weights not respected, common picked first %d times of 200", first)
+	}
+}
+
 func TestPick_shouldFailOnMissingTable(t *testing.T) {
 	yml := `
   definition:
@@ -718,8 +876,9 @@ func TestRollDice_shouldCalcProperly(t *testing.T) {
 	//it is hard to test randomizers...
 	data := []*rollTestData{toRTD("1d6", 1, 6), toRTD("3d6", 3, 18),
 		toRTD("3d6 - 3", 0, 15), toRTD("1d6 * 100", 100, 600), toRTD("3d1", 3, 3),
-		toRTD("3d1 + 3", 6, 6), toRTD("1d1 - 7", -6, -6), toRTD("1d1 - 1d1 * 2", 0, 0)}
-	ee := newExecutionEngine()
+		toRTD("3d1 + 3", 6, 6), toRTD("1d1 - 7", -6, -6), toRTD("1d1 - 1d1 * 2", -1, -1),
+		toRTD("4d6kh3", 3, 18), toRTD("(1d4 + 1) * 2", 4, 10), toRTD("4dF", -4, 4), toRTD("d%", 1, 100)}
+	ee := newExecutionEngine(context.Background(), newTimeSeededSource(), defaultExecutionConfig())
 
 	for i := 1; i <= diceCycleCount; i++ {
 		for _, d := range data {
@@ -749,3 +908,247 @@ func toRTD(expr string, low, high int) *rollTestData {
 		high: high,
 	}
 }
+
+func TestRoll_shouldBeReproducibleWithSeed(t *testing.T) {
+	yml1 := `
+  definition:
+    name: Flat1
+    type: flat
+  content:
+    - "{#1} and {@Range1}"
+    - "{2!Flat2} and {$3d6}"
+    - "plain"
+  inline:
+    - id: 1
+      content:
+        - inline 1
+        - inline 2
+        - inline 3`
+
+	yml2 := `
+  definition:
+    name: Range1
+    type: range
+    roll: 2d6
+  content:
+    - "{2-6}low"
+    - "{7}middle"
+    - "{8-12}high"`
+
+	yml3 := `
+  definition:
+    name: Flat2
+    type: flat
+  content:
+    - Flat2-1
+    - Flat2-2
+    - Flat2-3
+    - Flat2-4`
+
+	runAll := func(seed int64) []string {
+		repo := NewTableRepository(WithSeed(seed))
+		repo.AddTable([]byte(yml1))
+		repo.AddTable([]byte(yml2))
+		repo.AddTable([]byte(yml3))
+		out := make([]string, 0)
+		out = append(out, repo.Roll("Flat1", 20).Result...)
+		out = append(out, repo.Pick("Flat2", 2).Result...)
+		val, _ := repo.EvaluateDiceExpression("10d10")
+		out = append(out, strconv.Itoa(val))
+		return out
+	}
+
+	first := runAll(42)
+	second := runAll(42)
+	if strings.Join(first, "\n") != strings.Join(second, "\n") {
+		t.Error("Same seed generated different results")
+	}
+
+	//a different seed should (almost certainly) generate something different
+	third := runAll(43)
+	if strings.Join(first, "\n") == strings.Join(third, "\n") {
+		t.Error("Different seeds generated identical results")
+	}
+}
+
+func TestRoll_shouldBuildTraceTree(t *testing.T) {
+	yml1 := `
+  definition:
+    name: Flat1
+    type: flat
+  content:
+    - "{#1}"
+  inline:
+    - id: 1
+      content:
+        - "Flat1-inline: {@Range1} {$2d1}"`
+
+	yml2 := `
+  definition:
+    name: Range1
+    type: range
+    roll: 1d4
+  content:
+    - "{1-2}Range1|{2!Flat2}"
+    - "{3-4}Range1 high"`
+
+	yml3 := `
+  definition:
+    name: Flat2
+    type: flat
+  content:
+    - Flat2-1
+    - Flat2-2`
+
+	repo := NewTableRepository(WithRandomSource(NewScriptedRandomSource(1)))
+	repo.AddTable([]byte(yml1))
+	repo.AddTable([]byte(yml2))
+	repo.AddTable([]byte(yml3))
+	tr := repo.Roll("Flat1", 1)
+
+	if len(tr.Trace) != 1 {
+		t.Fatal("Expected a single trace tree")
+	}
+	root := tr.Trace[0]
+	if root.Table != "Flat1" || root.Operation != "roll" || root.Row != 0 || root.DiceExpr != "1d1" {
+		t.Errorf("Bad root node: %+v", root)
+	}
+	if root.Result != tr.Result[0] {
+		t.Error("Root node result should match the table result")
+	}
+	if len(root.Children) != 1 {
+		t.Fatal("Root should have expanded the inline table")
+	}
+
+	inline := root.Children[0]
+	if inline.Table != "Flat1.1" || inline.Reference != "{#1}" {
+		t.Errorf("Bad inline node: %+v", inline)
+	}
+	if len(inline.Children) != 2 {
+		t.Fatal("Inline table should have expanded a table ref and a dice ref")
+	}
+
+	rng := inline.Children[0]
+	if rng.Table != "Range1" || rng.Roll != 1 || rng.Row != 0 || rng.RangeLow != 1 || rng.RangeHigh != 2 {
+		t.Errorf("Bad range node: %+v", rng)
+	}
+	if len(rng.Children) != 1 || rng.Children[0].Operation != "pick" || len(rng.Children[0].Picks) != 2 {
+		t.Errorf("Bad pick node under range node: %+v", rng.Children)
+	}
+
+	dice := inline.Children[1]
+	if dice.Operation != "dice" || dice.DiceExpr != "2d1" || dice.Roll != 2 || dice.Reference != "{$2d1}" {
+		t.Errorf("Bad dice node: %+v", dice)
+	}
+
+	if !strings.Contains(tr.TraceString(), "{@Range1} roll Range1: 1d4 rolled 1, row 0 {1-2}") {
+		t.Errorf("Unexpected trace rendering:\n%s", tr.TraceString())
+	}
+}
+
+func TestRoll_shouldTraceBadRefs(t *testing.T) {
+	yml := `
+  definition:
+    name: TestTable_Flat
+    type: flat
+  content:
+    - "item 1 - {@Missing}"`
+
+	repo := NewTableRepository()
+	repo.AddTable([]byte(yml))
+	tr := repo.Roll("TestTable_Flat", 1)
+
+	if len(tr.Trace) != 1 || len(tr.Trace[0].Children) != 1 {
+		t.Fatal("Expected a failed child node for the bad ref")
+	}
+	bad := tr.Trace[0].Children[0]
+	if bad.Table != "Missing" || bad.Error == "" {
+		t.Errorf("Bad ref not traced properly: %+v", bad)
+	}
+}
+
+//a RandomSource that cancels a context after a number of rolls
+type cancellingSource struct {
+	rolls  int
+	cancel context.CancelFunc
+}
+
+func (cs *cancellingSource) Intn(n int) int {
+	cs.rolls--
+	if cs.rolls == 0 {
+		cs.cancel()
+	}
+	return 0
+}
+
+func TestRollContext_shouldStopWhenCancelled(t *testing.T) {
+	yml := `
+  definition:
+    name: Again
+    type: flat
+  content:
+    - "again {@Again}"
+    - stop`
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := NewTableRepository(WithRandomSource(&cancellingSource{rolls: 5, cancel: cancel}))
+	repo.AddTable([]byte(yml))
+
+	//always rolls row 1 so expansion would only stop at the call depth limit
+	tr := repo.RollContext(ctx, "Again", 2)
+	if tr.Completed() || !errors.Is(tr.Err, context.Canceled) {
+		t.Fatalf("Roll was not cut off: %v", tr.Err)
+	}
+	if len(tr.Result) != 0 {
+		t.Errorf("Unexpected results present: %v", tr.Result)
+	}
+	if tr.Log[len(tr.Log)-1] != "Execution cut off: context canceled" {
+		t.Errorf("Cut off not logged: %v", tr.Log)
+	}
+}
+
+func TestRollContext_shouldKeepResultsBeforeDeadline(t *testing.T) {
+	yml := `
+  definition:
+    name: TestTable_Flat
+    type: flat
+  content:
+    - item 1`
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := NewTableRepository(WithRandomSource(&cancellingSource{rolls: 3, cancel: cancel}))
+	repo.AddTable([]byte(yml))
+
+	tr := repo.RollContext(ctx, "TestTable_Flat", 10)
+	if tr.Completed() || len(tr.Result) != 3 {
+		t.Errorf("Unexpected results after cut off: %v %v", tr.Result, tr.Err)
+	}
+
+	tr = repo.RollContext(context.Background(), "TestTable_Flat", 10)
+	if !tr.Completed() || len(tr.Result) != 10 {
+		t.Errorf("Unexpected results without cut off: %v %v", tr.Result, tr.Err)
+	}
+}
+
+func TestPickContext_shouldNotStartWhenCancelled(t *testing.T) {
+	yml := `
+  definition:
+    name: TestTable_Flat
+    type: flat
+  content:
+    - item 1
+    - item 2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	repo := NewTableRepository()
+	repo.AddTable([]byte(yml))
+	tr := repo.PickContext(ctx, "TestTable_Flat", 1)
+	if tr.Completed() || !errors.Is(tr.Err, context.DeadlineExceeded) || len(tr.Result) != 0 {
+		t.Errorf("Pick was not cut off: %v %v", tr.Result, tr.Err)
+	}
+}
@@ -26,17 +26,22 @@ func (t *Table) ValidateContent(vr *validate.ValidationResult) {
 
 	//content section must exist
 	if len(t.RawContent) == 0 {
-		vr.Fail(contentSection, "A table must have content")
+		vr.Fail(contentSection, "A table must have content").WithCode(validate.CodeNoContent).At(t.Source.ContentStart())
 	}
 
 	var allContent []string
+	var rows []int //the row of the raw content each entry of allContent came from
 	switch t.Definition.TableType {
 	case "range":
 		//validate the ranges expressed in a ranged table and parse those valid ranges
 		//this must be done before the content section of a table can be examined for
 		//proper references since the range expressions (eg {2-3}) appear to be
 		//invalid table references
-		t.validateRanges(vr)
+		rows = t.validateRanges(vr)
+		//the ranges must handle every roll the table's dice can make
+		if vr.Valid() && t.Definition.DiceParsed != nil {
+			t.validateRangeCoverage(vr)
+		}
 		//now that ranges are validated and parsed, store the actual ranged
 		//content for firther Validation
 		allContent = make([]string, 0, len(t.RangeContent))
@@ -45,27 +50,57 @@ func (t *Table) ValidateContent(vr *validate.ValidationResult) {
 		}
 	case "flat":
 		allContent = t.RawContent
+		rows = allRows(len(allContent))
+	case "weighted":
+		//as with ranges, the weights (eg {w:5}) must be parsed before the content
+		//can be checked for references
+		t.validateWeights(vr)
+		allContent = make([]string, 0, len(t.WeightedContent))
+		for _, wc := range t.WeightedContent {
+			allContent = append(allContent, wc.Content)
+		}
+		rows = allRows(len(allContent))
 	}
 
 	//allContent contains the actual content of the table. Ensure all tablerefs
 	//are valid
-	for _, c := range allContent {
-		t.validateContentTableRefPairs(c, vr) //do we have closed {}?
+	for i, c := range allContent {
+		t.checkRow(rows[i], vr, func() {
+			t.validateContentTableRefPairs(c, vr) //do we have closed {}?
+		})
 	}
 
 	//at this point we can check for valid table refs - if no failures so far
 	if vr.Valid() {
-		for _, c := range allContent {
-			t.validateContentTableRefs(c, vr) //do we have valid tableref syntax?
+		for i, c := range allContent {
+			t.checkRow(rows[i], vr, func() {
+				t.validateContentTableRefs(c, vr) //do we have valid tableref syntax?
+			})
 		}
 	}
 }
 
+//runs check, placing the issues it finds at the given content row
+func (t *Table) checkRow(row int, vr *validate.ValidationResult, check func()) {
+	vr.ForPosition(t.Source.Row(row), func() {
+		vr.ForRow(row, check)
+	})
+}
+
+//the indexes of the first n rows
+func allRows(n int) []int {
+	rows := make([]int, n)
+	for i := range rows {
+		rows[i] = i
+	}
+	return rows
+}
+
 func (t *Table) validateContentTableRefs(entry string, vr *validate.ValidationResult) {
 	parts, found := util.FindNextTableRef(entry)
 	for found {
 		if matches := ExternalCalledPattern.FindStringSubmatch(parts[1]); matches != nil {
-			util.IsValidIdentifier(matches[1], parts[1], contentSection, vr)
+			util.IsValidName(matches[1], parts[1], contentSection, vr)
 			parts, found = util.FindNextTableRef(parts[2])
 			continue
 		}
@@ -75,7 +110,7 @@ func (t *Table) validateContentTableRefs(entry string, vr *validate.ValidationRe
 			continue
 		}
 		if matches := PickCalledPattern.FindStringSubmatch(parts[1]); matches != nil {
-			util.IsValidIdentifier(matches[2], parts[1], contentSection, vr)
+			util.IsValidName(matches[2], parts[1], contentSection, vr)
 			parts, found = util.FindNextTableRef(parts[2])
 			continue
 		}
@@ -84,7 +119,7 @@ func (t *Table) validateContentTableRefs(entry string, vr *validate.ValidationRe
 			parts, found = util.FindNextTableRef(parts[2])
 			continue
 		}
-		vr.Fail(contentSection, fmt.Sprintf("Invalid table ref: %s", parts[1]))
+		vr.Fail(contentSection, fmt.Sprintf("Invalid table ref: %s", parts[1])).WithCode(validate.CodeInvalidReference)
 		parts, found = util.FindNextTableRef(parts[2])
 	}
 }
@@ -100,7 +135,7 @@ func (t *Table) validateContentTableRefPairs(entry string, vr *validate.Validati
 			if state == 0 {
 				state = 1 //we have an open
 			} else {
-				vr.Fail(contentSection, "Unexpected open brace {")
+				vr.Fail(contentSection, "Unexpected open brace {").WithCode(validate.CodeUnbalancedBraces)
 				return //this contnt line is likely to be a mess, stop checking
 			}
 		}
@@ -108,13 +143,13 @@ func (t *Table) validateContentTableRefPairs(entry string, vr *validate.Validati
 			if state == 1 {
 				state = 0
 			} else {
-				vr.Fail(contentSection, "Unexpected close brace }")
+				vr.Fail(contentSection, "Unexpected close brace }").WithCode(validate.CodeUnbalancedBraces)
 				return //this contnt line is likely to be a mess, stop checking
 			}
 		}
 	}
 	//if we reach the end of the string, state should be 0
 	if state != 0 {
-		vr.Fail(contentSection, "Unclosed open brace {")
+		vr.Fail(contentSection, "Unclosed open brace {").WithCode(validate.CodeUnbalancedBraces)
 	}
 }
@@ -118,3 +118,32 @@ func TestContent_shouldAcceptWellformedTableRefs(t *testing.T) {
 		failOnErrors(vr, t)
 	}
 }
+
+func TestContent_shouldLocateDiagnostics(t *testing.T) {
+	yml := `
+  definition:
+    name: TestTable_Flat
+    type: flat
+  content:
+    - fine
+    - "{@Good} then {oops"
+    - "{@Good} then {@bad ref}"`
+
+	vr := validateFromYaml(yml, t)
+	equals(vr.ErrorCount(), 1, t)
+	equals(vr.Diagnostics[0].Code, validate.CodeUnbalancedBraces, t)
+	equals(vr.Diagnostics[0].Row, 1, t)
+
+	yml = `
+  definition:
+    name: TestTable_Flat
+    type: flat
+  content:
+    - fine
+    - "{@Good} then {@bad ref}"`
+
+	vr = validateFromYaml(yml, t)
+	equals(vr.ErrorCount(), 1, t)
+	equals(vr.Diagnostics[0].Code, validate.CodeInvalidName, t)
+	equals(vr.Diagnostics[0].Row, 1, t)
+}
@@ -16,31 +16,41 @@ type DefinitionPart struct {
 	Roll      string   `yaml:"roll"`
 	Tags      []string `yanl:"tags"`
 
-	DiceParsed []*dice.ParseResult
+	DiceParsed dice.Expr
 }
 
 func (t *Table) validateDefinition(vr *validate.ValidationResult) {
-	util.IsValidIdentifier(t.Definition.Name, "Name", definitionSection, vr)
-	util.IsNotEmpty(t.Definition.TableType, "TableType", definitionSection, vr)
+	vr.ForPosition(t.Source.DefinitionKey("name"), func() {
+		util.IsValidName(t.Definition.Name, "Name", definitionSection, vr)
+	})
+	vr.ForPosition(t.Source.DefinitionKey("type"), func() {
+		util.IsNotEmpty(t.Definition.TableType, "TableType", definitionSection, vr)
+	})
 
 	//ensure valid table type, ensure alignment between table type and roll
 	//information
 	switch t.Definition.TableType {
-	case "flat":
+	case "flat", "weighted":
 		if t.Definition.Roll != "" {
-			vr.Warn(definitionSection, fmt.Sprintf("Roll defined but not used for this table type"))
+			vr.Warn(definitionSection, "Roll defined but not used for this table type").
+				WithCode(validate.CodeUnusedRoll).At(t.Source.DefinitionKey("roll"))
 		}
 	case "range":
 		if t.Definition.Roll == "" {
-			vr.Fail(definitionSection, fmt.Sprintf("Roll must be defined for this table type"))
+			vr.Fail(definitionSection, "Roll must be defined for this table type").
+				WithCode(validate.CodeMissingRoll).At(t.Source.DefinitionKey("type"))
 		}
 	default:
-		vr.Fail(definitionSection, fmt.Sprintf("Unknown TableType: %s", t.Definition.TableType))
+		vr.Fail(definitionSection, fmt.Sprintf("Unknown TableType: %s", t.Definition.TableType)).
+			WithCode(validate.CodeUnknownTableType).At(t.Source.DefinitionKey("type"))
 	}
 
 	//if a roll is provided, make sure it is valid
 	if t.Definition.Roll != "" {
-		parseResults := dice.ValidateDiceExpr(t.Definition.Roll, definitionSection, vr)
+		var parseResults dice.Expr
+		vr.ForPosition(t.Source.DefinitionKey("roll"), func() {
+			parseResults = dice.ValidateDiceExpr(t.Definition.Roll, definitionSection, vr)
+		})
 		if parseResults != nil {
 			t.Definition.DiceParsed = parseResults
 		}
@@ -117,7 +117,7 @@ func TestDefinitionValidation_shouldAcceptValidDice(t *testing.T) {
   content:
     - '{1-2}item 1'
     - '{3-4}item 2'
-    - '{5-6}item 3'`
+    - '{5-16}item 3'`
 
 	vr := validateFromYaml(yml, t)
 	failOnErrors(vr, t)
@@ -154,7 +154,7 @@ func TestDefinitionValidation_shouldUniquifyAndLowercaseTags(t *testing.T) {
   content:
     - '{1-2}item 1'
     - '{3-4}item 2'
-    - '{5-6}item 3'`
+    - '{5-16}item 3'`
 
 	tb := tableFromYaml(yml, t)
 	vr := tb.Validate()
@@ -2,7 +2,6 @@ package table
 
 import (
 	"fmt"
-	"sort"
 	"strconv"
 	"tablib/util"
 	"tablib/validate"
@@ -18,29 +17,36 @@ type InlinePart struct {
 
 func (t *Table) validateInline(vr *validate.ValidationResult) {
 
-	idsDefined := make([]string, 0, len(t.Inline))
 	//ensure ID and content are both defined for each inline table
-	for _, il := range t.Inline {
+	for idx, il := range t.Inline {
+		pos := t.Source.InlineTable(idx).Start()
 		idVal, err := strconv.Atoi(il.ID)
 		if err != nil {
-			vr.Fail(inlineSection, fmt.Sprintf("Invalid ID for Inline table: %s", il.ID))
+			vr.Fail(inlineSection, fmt.Sprintf("Invalid ID for Inline table: %s", il.ID)).
+				WithCode(validate.CodeInvalidInlineID).WithInline(il.ID).At(pos)
 		} else {
 			if idVal <= 0 {
-				vr.Fail(inlineSection, fmt.Sprintf("Invalid ID for Inline table: %s", il.ID))
+				vr.Fail(inlineSection, fmt.Sprintf("Invalid ID for Inline table: %s", il.ID)).
+					WithCode(validate.CodeInvalidInlineID).WithInline(il.ID).At(pos)
 			}
-			idsDefined = append(idsDefined, il.ID)
 		}
 		if len(il.Content) <= 0 {
-			vr.Fail(inlineSection, fmt.Sprintf("Inline table with id: %s is empty", il.ID))
+			vr.Fail(inlineSection, fmt.Sprintf("Inline table with id: %s is empty", il.ID)).
+				WithCode(validate.CodeEmptyInline).WithInline(il.ID).At(pos)
 		}
 		il.FullyQualifiedName = util.BuildFullName(t.Definition.Name, il.ID)
 	}
 
-	//ensure uniqueness of inline ids
-	sort.Strings(idsDefined)
-	for i := 0; i < len(idsDefined)-1; i++ {
-		if idsDefined[i] == idsDefined[i+1] {
-			vr.Fail(inlineSection, fmt.Sprintf("Inline table ID: %s defined twice", idsDefined[i]))
+	//ensure uniqueness of inline ids, pointing at the second definition
+	seen := make(map[string]bool)
+	for idx, il := range t.Inline {
+		if _, err := strconv.Atoi(il.ID); err != nil { //already reported
+			continue
 		}
+		if seen[il.ID] {
+			vr.Fail(inlineSection, fmt.Sprintf("Inline table ID: %s defined twice", il.ID)).
+				WithCode(validate.CodeDuplicateInline).WithInline(il.ID).At(t.Source.InlineTable(idx).Start())
+		}
+		seen[il.ID] = true
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"tablib/dice"
 	"tablib/validate"
 )
 
@@ -19,17 +20,22 @@ var (
 	fixedContentPattern  = regexp.MustCompile("^\\{([0-9]+)\\}.*$")
 )
 
-func (t *Table) validateRanges(vr *validate.ValidationResult) {
+//parses the range prefix of each row of a range table eg {2-3} goblins. Returns
+//the row of the raw content each ranged content came from, rows that could not
+//be parsed have no ranged content
+func (t *Table) validateRanges(vr *validate.ValidationResult) []int {
 
 	//set up to store parsed ranged content
 	allContent := make([]*rangedContent, 0, 1)
+	rows := make([]int, 0, len(t.RawContent))
 
-	for _, rc := range t.RawContent {
+	for row, rc := range t.RawContent {
 		if matches := rangedContentPattern.FindStringSubmatch(rc); matches != nil { //{x-y}
 			lowVal, _ := strconv.Atoi(matches[1])  //no err, regex protects this
 			highVal, _ := strconv.Atoi(matches[2]) //no err, regex protects this
 			if lowVal >= highVal {
-				vr.Fail(contentSection, fmt.Sprintf("Invalid range: %d greater or equal to %d", lowVal, highVal))
+				vr.Fail(contentSection, fmt.Sprintf("Invalid range: %d greater or equal to %d", lowVal, highVal)).
+					WithCode(validate.CodeInvalidRange).WithRow(row).At(t.Source.Row(row))
 			}
 			splitStrings := strings.SplitAfterN(rc, "}", 2)
 			rgCont := &rangedContent{
@@ -38,6 +44,7 @@ func (t *Table) validateRanges(vr *validate.ValidationResult) {
 				Content: splitStrings[1],
 			}
 			allContent = append(allContent, rgCont)
+			rows = append(rows, row)
 		} else if matches := fixedContentPattern.FindStringSubmatch(rc); matches != nil { // range of a single value eg {x}}
 			onlyVal, _ := strconv.Atoi(matches[1]) //no err, regex protects this
 			splitStrings := strings.SplitAfterN(rc, "}", 2)
@@ -47,8 +54,10 @@ func (t *Table) validateRanges(vr *validate.ValidationResult) {
 				Content: splitStrings[1],
 			}
 			allContent = append(allContent, rgCont)
+			rows = append(rows, row)
 		} else {
-			vr.Fail(contentSection, fmt.Sprintf("Invalid ranged content: %s", rc))
+			vr.Fail(contentSection, fmt.Sprintf("Invalid ranged content: %s", rc)).
+				WithCode(validate.CodeInvalidRange).WithRow(row).At(t.Source.Row(row))
 		}
 
 	}
@@ -58,8 +67,103 @@ func (t *Table) validateRanges(vr *validate.ValidationResult) {
 	overlap := false
 	for i := 0; i < len(t.RangeContent)-1; i++ {
 		if t.RangeContent[i].High >= t.RangeContent[i+1].Low && !overlap {
-			vr.Fail(contentSection, "this table has a range overlap or ordering issue")
+			vr.Fail(contentSection, "this table has a range overlap or ordering issue").
+				WithCode(validate.CodeRangeOverlap).WithRow(rows[i+1]).At(t.Source.Row(rows[i+1]))
 			overlap = true //supress similar failures - out of order will cause a mess
 		}
 	}
+	return rows
+}
+
+//ensures the ranges exactly cover the rolls possible with the table's dice.
+//Rolls the dice can produce that no range handles are errors, ranges that reach
+//outside the possible rolls are warnings. Exploding dice can roll very high, if
+//rarely, so when the dice explode the top range handles every roll above it
+//(see RowForRoll) and the ranges need only cover the rolls up to the highest
+//roll made without an explosion. Ranges can not express negative numbers so
+//rolls that can be negative are not checked
+func (t *Table) validateRangeCoverage(vr *validate.ValidationResult) {
+	dist, err := dice.Analyze(t.Definition.DiceParsed)
+	if err != nil {
+		vr.Warn(contentSection, fmt.Sprintf("Unable to check ranges against roll: %s - %v", t.Definition.Roll, err)).
+			WithCode(validate.CodeRangeUnchecked).At(t.Source.DefinitionKey("roll"))
+		return
+	}
+	rolls := dist.Values()
+	min, max := rolls[0], rolls[len(rolls)-1]
+	if min < 0 {
+		vr.Warn(contentSection, fmt.Sprintf("Unable to check ranges against roll: %s - it can produce negative rolls (%d) which ranges can not express",
+			t.Definition.Roll, min)).
+			WithCode(validate.CodeRangeUnchecked).At(t.Source.DefinitionKey("roll"))
+		return
+	}
+
+	//find the spans of possible rolls no range handles. Only the possible rolls
+	//are visited, eg 1d6 * 10 can only roll 10, 20 .. 60
+	openTop := t.hasOpenTop()
+	gaps := make([]string, 0)
+	for i := 0; i < len(rolls); i++ {
+		if t.rowForRoll(rolls[i], openTop) != -1 {
+			continue
+		}
+		start := rolls[i]
+		for i+1 < len(rolls) && t.rowForRoll(rolls[i+1], openTop) == -1 {
+			i++
+		}
+		gaps = append(gaps, rangeText(start, rolls[i]))
+	}
+	if len(gaps) > 0 {
+		vr.Fail(contentSection, fmt.Sprintf("Roll: %s can produce %s but no range handles: %s",
+			t.Definition.Roll, rangeText(min, max), strings.Join(gaps, ", "))).
+			WithCode(validate.CodeRangeGap).At(t.Source.DefinitionKey("roll"))
+	}
+
+	//only called once every row has been parsed so rows and ranges correspond
+	for row, rc := range t.RangeContent {
+		if rc.Low < min || (rc.High > max && !(openTop && row == len(t.RangeContent)-1)) {
+			vr.Warn(contentSection, fmt.Sprintf("Range: {%s} is outside the rolls possible with: %s (%s)",
+				rangeText(rc.Low, rc.High), t.Definition.Roll, rangeText(min, max))).
+				WithCode(validate.CodeRangeUnreachable).WithRow(row).At(t.Source.Row(row))
+		}
+	}
+}
+
+//RowForRoll returns the index of the ranged content handling a roll, or -1 if
+//there is none. When the table's dice explode the top range handles every roll
+//above it, so long as it reaches the highest roll made without an explosion
+func (t *Table) RowForRoll(roll int) int {
+	return t.rowForRoll(roll, t.hasOpenTop())
+}
+
+func (t *Table) rowForRoll(roll int, openTop bool) int {
+	for idx, rc := range t.RangeContent {
+		if roll >= rc.Low && roll <= rc.High {
+			return idx
+		}
+	}
+	if top := len(t.RangeContent) - 1; openTop && roll > t.RangeContent[top].High {
+		return top
+	}
+	return -1
+}
+
+//reports whether the top range handles every roll above it, which is so when
+//the dice explode and it reaches the highest roll made without an explosion
+func (t *Table) hasOpenTop() bool {
+	if len(t.RangeContent) == 0 || t.Definition.DiceParsed == nil || !dice.Explodes(t.Definition.DiceParsed) {
+		return false
+	}
+	dist, err := dice.Analyze(dice.Unexploded(t.Definition.DiceParsed))
+	if err != nil {
+		return false
+	}
+	return t.RangeContent[len(t.RangeContent)-1].High >= dist.Max()
+}
+
+//formats a span of rolls as the range prefixes do eg 3-5 or 7
+func rangeText(low, high int) string {
+	if low == high {
+		return strconv.Itoa(low)
+	}
+	return fmt.Sprintf("%d-%d", low, high)
 }
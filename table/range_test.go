@@ -156,3 +156,184 @@ func TestRangeValidation_shouldConvertRangedTableToInternalFormat(t *testing.T)
 	equals(tb.RangeContent[3].High, 6, t)
 	equals(tb.RangeContent[3].Content, "item 4", t)
 }
+
+func TestRangeValidation_shouldRejectRollsNotCovered(t *testing.T) {
+	yml := `
+  definition:
+    name: TestTable
+    type: range
+    roll: 3d4
+  content:
+    - '{3-4}item 1'
+    - '{6-8}item 2'
+    - '{9}item 3'`
+
+	vr := validateFromYaml(yml, t)
+	failOnNoErrors(vr, t)
+	equals(vr.ErrorCount(), 1, t)
+	equals(vr.Errors[0], "ERROR: Content - Roll: 3d4 can produce 3-12 but no range handles: 5, 10-12", t)
+}
+
+func TestRangeValidation_shouldOnlyCheckPossibleRolls(t *testing.T) {
+	yml := `
+  definition:
+    name: TestTable
+    type: range
+    roll: 1d6 * 10
+  content:
+    - '{10}item 1'
+    - '{20}item 2'
+    - '{30}item 3'
+    - '{40}item 4'
+    - '{50}item 5'
+    - '{60}item 6'`
+
+	vr := validateFromYaml(yml, t)
+	failOnErrors(vr, t)
+	equals(vr.IssueCount(), 0, t)
+
+	//gaps between possible rolls are merged
+	yml = `
+  definition:
+    name: TestTable
+    type: range
+    roll: 1d6 * 10
+  content:
+    - '{10}item 1'
+    - '{20}item 2'
+    - '{50-60}item 3'`
+
+	vr = validateFromYaml(yml, t)
+	equals(vr.ErrorCount(), 1, t)
+	equals(vr.Errors[0], "ERROR: Content - Roll: 1d6 * 10 can produce 10-60 but no range handles: 30-40", t)
+
+	//the span of the rolls does not matter, only how many there are
+	yml = `
+  definition:
+    name: TestTable
+    type: range
+    roll: 1d10 * 100000000000
+  content:
+    - '{100000000000-500000000000}item 1'
+    - '{600000000000-900000000000}item 2'`
+
+	vr = validateFromYaml(yml, t)
+	equals(vr.ErrorCount(), 1, t)
+	equals(vr.Errors[0], "ERROR: Content - Roll: 1d10 * 100000000000 can produce 100000000000-1000000000000 but no range handles: 1000000000000", t)
+}
+
+func TestRangeValidation_shouldWarnOfRangesNeverRolled(t *testing.T) {
+	yml := `
+  definition:
+    name: TestTable
+    type: range
+    roll: 1d6 * 2
+  content:
+    - '{1}item 1'
+    - '{2-12}item 2'
+    - '{13-20}item 3'`
+
+	vr := validateFromYaml(yml, t)
+	failOnErrors(vr, t)
+	equals(vr.WarnCount(), 2, t)
+	equals(vr.Errors[0], "WARN: Content - Range: {1} is outside the rolls possible with: 1d6 * 2 (2-12)", t)
+	equals(vr.Errors[1], "WARN: Content - Range: {13-20} is outside the rolls possible with: 1d6 * 2 (2-12)", t)
+}
+
+func TestRangeValidation_shouldAcceptExactCoverage(t *testing.T) {
+	yml := `
+  definition:
+    name: TestTable
+    type: range
+    roll: 4d6kh3 - 3
+  content:
+    - '{0-5}item 1'
+    - '{6-10}item 2'
+    - '{11-15}item 3'`
+
+	vr := validateFromYaml(yml, t)
+	failOnErrors(vr, t)
+	equals(vr.IssueCount(), 0, t)
+}
+
+func TestRangeValidation_shouldLocateDiagnostics(t *testing.T) {
+	yml := `
+  definition:
+    name: TestTable
+    type: range
+    roll: 1d6
+  content:
+    - '{1-3}item 1'
+    - 'item 2'
+    - '{5-4}item 3'
+    - '{3-6}item 4'`
+
+	vr := validateFromYaml(yml, t)
+	equals(vr.ErrorCount(), 3, t)
+	for i, want := range []struct {
+		code validate.Code
+		row  int
+	}{
+		{validate.CodeInvalidRange, 1},
+		{validate.CodeInvalidRange, 2},
+		{validate.CodeRangeOverlap, 3},
+	} {
+		d := vr.Diagnostics[i]
+		equals(d.Code, want.code, t)
+		equals(d.Row, want.row, t)
+		equals(d.Table, "TestTable", t)
+	}
+}
+
+func TestRangeValidation_shouldLetTopRangeHandleExplosions(t *testing.T) {
+	yml := `
+  definition:
+    name: TestTable
+    type: range
+    roll: 1d6!
+  content:
+    - '{1-3}item 1'
+    - '{4-6}item 2'`
+
+	tb := tableFromYaml(yml, t)
+	vr := tb.Validate()
+	failOnErrors(vr, t)
+	equals(vr.IssueCount(), 0, t)
+	equals(tb.RowForRoll(2), 0, t)
+	equals(tb.RowForRoll(6), 1, t)
+	equals(tb.RowForRoll(17), 1, t)
+	equals(tb.RowForRoll(0), -1, t)
+}
+
+func TestRangeValidation_shouldRequireCoverageOfUnexplodedRolls(t *testing.T) {
+	yml := `
+  definition:
+    name: TestTable
+    type: range
+    roll: 1d6!
+  content:
+    - '{1-3}item 1'
+    - '{4-5}item 2'`
+
+	vr := validateFromYaml(yml, t)
+	equals(vr.ErrorCount(), 1, t)
+	equals(vr.Diagnostics[0].Code, validate.CodeRangeGap, t)
+}
+
+func TestRangeValidation_shouldNotCheckNegativeRolls(t *testing.T) {
+	for _, roll := range []string{"1d6-3", "4dF"} {
+		yml := `
+  definition:
+    name: TestTable
+    type: range
+    roll: ` + roll + `
+  content:
+    - '{0-1}item 1'
+    - '{2-3}item 2'`
+
+		vr := validateFromYaml(yml, t)
+		failOnErrors(vr, t)
+		equals(vr.WarnCount(), 1, t)
+		equals(vr.Diagnostics[0].Code, validate.CodeRangeUnchecked, t)
+	}
+}
@@ -0,0 +1,66 @@
+package table
+
+import (
+	"tablib/util"
+)
+
+//Reference describes a single reference from a table's content to another table
+type Reference struct {
+	Name      string //name of the referenced table as written, inline tables are named as in util.BuildFullName
+	Operation string //OpRoll or OpPick
+	Row       int    //index of the content row holding the reference
+	Text      string //the reference as written in the table eg {@Foo}
+	Inline    bool   //true if this is a reference to one of this table's inline tables
+}
+
+//References returns all table references made by the content of this table.
+//Dice references are not table references and are not returned. The table
+//must be valid for this to produce meaningful results
+func (t *Table) References() []*Reference {
+	refs := make([]*Reference, 0)
+	for row, c := range t.ContentRows() {
+		parts, found := util.FindNextTableRef(c)
+		for found {
+			if matches := ExternalCalledPattern.FindStringSubmatch(parts[1]); matches != nil {
+				refs = append(refs, &Reference{Name: matches[1], Operation: OpRoll, Row: row, Text: parts[1]})
+			} else if matches := InlineCalledPattern.FindStringSubmatch(parts[1]); matches != nil {
+				refs = append(refs, &Reference{Name: util.BuildFullName(t.Definition.Name, matches[1]),
+					Operation: OpRoll, Row: row, Text: parts[1], Inline: true})
+			} else if matches := PickCalledPattern.FindStringSubmatch(parts[1]); matches != nil {
+				refs = append(refs, &Reference{Name: matches[2], Operation: OpPick, Row: row, Text: parts[1]})
+			}
+			parts, found = util.FindNextTableRef(parts[2])
+		}
+	}
+	return refs
+}
+
+//ContentRows returns the content of each row of the table with any range or
+//weight prefixes removed
+func (t *Table) ContentRows() []string {
+	switch t.Definition.TableType {
+	case TypeRange:
+		rows := make([]string, 0, len(t.RangeContent))
+		for _, rc := range t.RangeContent {
+			rows = append(rows, rc.Content)
+		}
+		return rows
+	case TypeWeighted:
+		rows := make([]string, 0, len(t.WeightedContent))
+		for _, wc := range t.WeightedContent {
+			rows = append(rows, wc.Content)
+		}
+		return rows
+	}
+	return t.RawContent
+}
+
+//InlineNames returns the full names of this table's inline tables. The
+//table must have been validated for the names to be available
+func (t *Table) InlineNames() []string {
+	names := make([]string, 0, len(t.Inline))
+	for _, il := range t.Inline {
+		names = append(names, il.FullyQualifiedName)
+	}
+	return names
+}
@@ -0,0 +1,45 @@
+package table
+
+import (
+	"testing"
+)
+
+func TestReferences_shouldFindAllTableRefs(t *testing.T) {
+	yml := `
+  definition:
+    name: TestTable
+    type: range
+    roll: 1d6
+  content:
+    - '{1-2}item 1 {@Foo} and {#1}'
+    - '{3-4}item 2 {$1d6}'
+    - '{5-6}item 3 {3!Bar}'
+  inline:
+    - id: 1
+      content:
+        - inline 1`
+
+	tb := tableFromYaml(yml, t)
+	vr := tb.Validate()
+	failOnErrors(vr, t)
+
+	refs := tb.References()
+	equals(len(refs), 3, t)
+
+	equals(refs[0].Name, "Foo", t)
+	equals(refs[0].Operation, OpRoll, t)
+	equals(refs[0].Row, 0, t)
+	equals(refs[0].Inline, false, t)
+
+	equals(refs[1].Name, "TestTable.1", t)
+	equals(refs[1].Text, "{#1}", t)
+	equals(refs[1].Inline, true, t)
+
+	equals(refs[2].Name, "Bar", t)
+	equals(refs[2].Operation, OpPick, t)
+	equals(refs[2].Row, 2, t)
+
+	names := tb.InlineNames()
+	equals(len(names), 1, t)
+	equals(names[0], "TestTable.1", t)
+}
@@ -0,0 +1,149 @@
+package table
+
+import (
+	"tablib/validate"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+//SourceMap records where the parts of a table were found in its YAML source so
+//that diagnostics can point at them. The methods of a nil SourceMap return
+//unknown positions, as for tables not parsed from YAML nodes
+type SourceMap struct {
+	Table      validate.Position            //the table itself
+	Definition map[string]validate.Position //the value of each definition key eg roll, "" for the definition key
+	Content    validate.Position            //the content key
+	Rows       []validate.Position          //each content row
+	Inline     []*SourceMap                 //each inline table, Table is its id
+}
+
+//NewSourceMap finds the parts of a table in the document node it was decoded
+//from. The file is that the YAML was read from, if any
+func NewSourceMap(file string, doc *yaml.Node) *SourceMap {
+	sm := &SourceMap{
+		Definition: make(map[string]validate.Position),
+		Rows:       make([]validate.Position, 0),
+		Inline:     make([]*SourceMap, 0),
+	}
+	root := doc
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	sm.Table = position(file, root)
+
+	forEachKey(root, func(key, value *yaml.Node) {
+		switch key.Value {
+		case "definition":
+			sm.Definition[""] = position(file, key)
+			forEachKey(value, func(k, v *yaml.Node) {
+				sm.Definition[k.Value] = position(file, v)
+			})
+		case "content":
+			sm.Content, sm.Rows = contentPositions(file, key, value)
+		case "inline":
+			if value.Kind != yaml.SequenceNode {
+				return
+			}
+			for _, item := range value.Content {
+				inline := &SourceMap{
+					Table: position(file, item),
+					Rows:  make([]validate.Position, 0),
+				}
+				forEachKey(item, func(k, v *yaml.Node) {
+					switch k.Value {
+					case "id":
+						inline.Table = position(file, v)
+					case "content":
+						inline.Content, inline.Rows = contentPositions(file, k, v)
+					}
+				})
+				sm.Inline = append(sm.Inline, inline)
+			}
+		}
+	})
+	return sm
+}
+
+//DefinitionKey returns the position of the value of the given definition key,
+//or of the definition itself if the key is not present
+func (sm *SourceMap) DefinitionKey(key string) validate.Position {
+	if sm == nil {
+		return validate.Position{}
+	}
+	if pos, found := sm.Definition[key]; found {
+		return pos
+	}
+	if pos, found := sm.Definition[""]; found {
+		return pos
+	}
+	return sm.Table
+}
+
+//Row returns the position of the given content row, or of the content itself
+//if there is no such row
+func (sm *SourceMap) Row(row int) validate.Position {
+	if sm == nil {
+		return validate.Position{}
+	}
+	if row >= 0 && row < len(sm.Rows) {
+		return sm.Rows[row]
+	}
+	return sm.ContentStart()
+}
+
+//ContentStart returns the position of the content key, or of the table if there
+//is no content
+func (sm *SourceMap) ContentStart() validate.Position {
+	if sm == nil {
+		return validate.Position{}
+	}
+	if sm.Content.IsValid() {
+		return sm.Content
+	}
+	return sm.Table
+}
+
+//Start returns the position of the table, or of the id of an inline table
+func (sm *SourceMap) Start() validate.Position {
+	if sm == nil {
+		return validate.Position{}
+	}
+	return sm.Table
+}
+
+//InlineTable returns the source map of the inline table at the given index in
+//the table's inline section, nil if there is none
+func (sm *SourceMap) InlineTable(idx int) *SourceMap {
+	if sm == nil || idx < 0 || idx >= len(sm.Inline) {
+		return nil
+	}
+	return sm.Inline[idx]
+}
+
+func position(file string, node *yaml.Node) validate.Position {
+	return validate.Position{
+		File:   file,
+		Line:   node.Line,
+		Column: node.Column,
+	}
+}
+
+//calls fn with each key and value of a mapping node
+func forEachKey(node *yaml.Node, fn func(key, value *yaml.Node)) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		fn(node.Content[i], node.Content[i+1])
+	}
+}
+
+func contentPositions(file string, key, value *yaml.Node) (validate.Position, []validate.Position) {
+	rows := make([]validate.Position, 0, len(value.Content))
+	if value.Kind == yaml.SequenceNode {
+		for _, row := range value.Content {
+			rows = append(rows, position(file, row))
+		}
+	}
+	return position(file, key), rows
+}
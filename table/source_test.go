@@ -0,0 +1,101 @@
+package table
+
+import (
+	"strings"
+	"tablib/validate"
+	"testing"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+const sourceYml = `definition:
+  name: TestTable
+  type: range
+  roll: 1d6
+content:
+  - "{1-3}low"
+  - "{4-6}high"
+inline:
+  - id: 1
+    content:
+      - first
+      - second
+`
+
+func sourceMapFromYaml(rawYaml string, t *testing.T) *SourceMap {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(rawYaml), &doc); err != nil {
+		t.Fatalf("Unable to parse yaml: %v", err)
+	}
+	return NewSourceMap("tables/test.yml", &doc)
+}
+
+func TestSourceMap_shouldFindParts(t *testing.T) {
+	sm := sourceMapFromYaml(sourceYml, t)
+
+	pos := func(line, col int) validate.Position {
+		return validate.Position{File: "tables/test.yml", Line: line, Column: col}
+	}
+	equals(sm.Start(), pos(1, 1), t)
+	equals(sm.DefinitionKey("roll"), pos(4, 9), t)
+	equals(sm.DefinitionKey("note"), pos(1, 1), t) //not present, the definition key instead
+	equals(sm.ContentStart(), pos(5, 1), t)
+	equals(sm.Row(1), pos(7, 5), t)
+	equals(sm.Row(2), pos(5, 1), t) //no such row, the content key instead
+	equals(sm.InlineTable(0).Start(), pos(9, 9), t)
+	equals(sm.InlineTable(0).Row(1), pos(12, 9), t)
+	equals(sm.InlineTable(1).Start(), validate.Position{}, t)
+}
+
+func TestSourceMap_shouldBeUnknownWhenNil(t *testing.T) {
+	var sm *SourceMap
+	for _, p := range []validate.Position{sm.DefinitionKey("name"), sm.Row(0), sm.ContentStart(), sm.Start()} {
+		if p.IsValid() {
+			t.Errorf("Unexpected position: %v", p)
+		}
+	}
+	if sm.InlineTable(0) != nil {
+		t.Error("Unexpected inline source")
+	}
+}
+
+func TestSourceMap_shouldPlaceDiagnostics(t *testing.T) {
+	yml := `definition:
+  name: TestTable
+  type: range
+  roll: 1d6+
+content:
+  - "{1-3}low"
+  - "{4-6}high"`
+
+	tbl := tableFromYaml(yml, t)
+	tbl.Source = sourceMapFromYaml(yml, t)
+	vr := tbl.Validate()
+	equals(vr.ErrorCount(), 1, t)
+	equals(vr.Diagnostics[0].Code, validate.CodeInvalidDice, t)
+	equals(vr.Diagnostics[0].Position.String(), "tables/test.yml:4:9", t)
+
+	yml = `definition:
+  name: TestTable
+  type: range
+  roll: 1d6
+content:
+  - "{1-3}low"
+  - "4-6 high"
+  - "{4-6}high {@bad name}"`
+
+	tbl = tableFromYaml(yml, t)
+	tbl.Source = sourceMapFromYaml(yml, t)
+	vr = tbl.Validate()
+	equals(vr.ErrorCount(), 1, t)
+	equals(vr.Diagnostics[0].Position.String(), "tables/test.yml:7:5", t)
+
+	yml = strings.Replace(yml, `  - "4-6 high"
+`, "", 1)
+	tbl = tableFromYaml(yml, t)
+	tbl.Source = sourceMapFromYaml(yml, t)
+	vr = tbl.Validate()
+	equals(vr.ErrorCount(), 1, t)
+	equals(vr.Diagnostics[0].Code, validate.CodeInvalidName, t)
+	equals(vr.Diagnostics[0].Position.String(), "tables/test.yml:7:5", t)
+}
@@ -12,9 +12,13 @@ type Table struct {
 	RawContent []string        `yaml:"content"`
 	Inline     []*InlinePart   `yaml:"inline"`
 
-	IsValid       bool
-	IsInlineTable bool
-	RangeContent  []*rangedContent
+	IsValid         bool
+	IsInlineTable   bool
+	RangeContent    []*rangedContent
+	WeightedContent []*weightedContent
+
+	//Source is where the parts of the table are in its YAML, nil if not known
+	Source *SourceMap `yaml:"-"`
 }
 
 const (
@@ -39,6 +43,9 @@ const (
 
 	//TypeRange represents a flat table
 	TypeRange = "range"
+
+	//TypeWeighted represents a flat table whose rows may be given weights
+	TypeWeighted = "weighted"
 )
 
 //Validate ensures the table is valid and parses some aspects if it makes
@@ -62,6 +69,11 @@ func (t *Table) Validate() *validate.ValidationResult {
 		t.ValidateContent(vr)
 	}
 
+	//every issue found is in this table
+	for _, d := range vr.Diagnostics {
+		d.Table = t.Definition.Name
+	}
+
 	//have there been any actual validation errors? If so, mark table as Invalid
 	t.IsValid = true
 	if !vr.IsValid {
@@ -72,9 +84,9 @@ func (t *Table) Validate() *validate.ValidationResult {
 
 func (t *Table) validateInternalInlineConsistency(vr *validate.ValidationResult) {
 
-	idsUsed := make(map[string]struct{})
+	idsUsed := make(map[string]int) //id to the first row using it
 	idsDefined := make([]string, 0, 1)
-	for _, rc := range t.RawContent {
+	for row, rc := range t.RawContent {
 
 		if allMatches := InlineCalledPattern.FindAllStringSubmatch(rc, -1); allMatches != nil {
 			//for each inline table reference, add it to a set of Ids for later comparison
@@ -82,7 +94,9 @@ func (t *Table) validateInternalInlineConsistency(vr *validate.ValidationResult)
 				aMatch := allMatches[i][1]
 				left := strings.TrimPrefix(aMatch, "{#")
 				idAsString := strings.TrimSuffix(left, "}")
-				idsUsed[idAsString] = struct{}{}
+				if _, seen := idsUsed[idAsString]; !seen {
+					idsUsed[idAsString] = row
+				}
 			}
 		}
 	}
@@ -93,7 +107,7 @@ func (t *Table) validateInternalInlineConsistency(vr *validate.ValidationResult)
 	}
 
 	//ensure each used id has a coorisponding inline def
-	for uid := range idsUsed {
+	for uid, row := range idsUsed {
 		found := false
 		for _, did := range idsDefined {
 			if uid == did {
@@ -102,12 +116,13 @@ func (t *Table) validateInternalInlineConsistency(vr *validate.ValidationResult)
 			}
 		}
 		if !found {
-			vr.Fail(contentSection, fmt.Sprintf("Inline table ID: %s is referenced but not defined", uid))
+			vr.Fail(contentSection, fmt.Sprintf("Inline table ID: %s is referenced but not defined", uid)).
+				WithCode(validate.CodeUndefinedInline).WithRow(row).WithInline(uid).At(t.Source.Row(row))
 		}
 	}
 
 	//warn if an inline table is defined but not used
-	for _, did := range idsDefined {
+	for idx, did := range idsDefined {
 		found := false
 		for uid := range idsUsed {
 			if did == uid {
@@ -116,7 +131,8 @@ func (t *Table) validateInternalInlineConsistency(vr *validate.ValidationResult)
 			}
 		}
 		if !found {
-			vr.Warn(inlineSection, fmt.Sprintf("Inline table ID: %s is defined but not referenced", did))
+			vr.Warn(inlineSection, fmt.Sprintf("Inline table ID: %s is defined but not referenced", did)).
+				WithCode(validate.CodeUnreferencedInline).WithInline(did).At(t.Source.InlineTable(idx).Start())
 		}
 	}
 }
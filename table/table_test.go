@@ -78,6 +78,15 @@ func TestTableValidation_shouldRejectInlineMismatch1(t *testing.T) {
 	failOnNoErrors(vr, t)
 	equals(vr.ErrorCount(), 1, t)
 	equals(vr.WarnCount(), 1, t)
+
+	undefined := vr.WithCode(validate.CodeUndefinedInline)
+	equals(len(undefined), 1, t)
+	equals(undefined[0].Row, 0, t)
+	equals(undefined[0].InlineID, "1", t)
+	equals(undefined[0].Table, "TestTable_Flat", t)
+	unreferenced := vr.WithCode(validate.CodeUnreferencedInline)
+	equals(len(unreferenced), 1, t)
+	equals(unreferenced[0].InlineID, "2", t)
 }
 
 func TestTableValidation_shouldRejectInlineMismatch2(t *testing.T) {
@@ -0,0 +1,86 @@
+package table
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"tablib/validate"
+)
+
+type weightedContent struct {
+	Weight  int
+	Content string
+}
+
+const (
+	//maxWeight is the largest weight a single row may have
+	maxWeight = 1000000
+
+	//maxTotalWeight keeps the total weight of a table within an int, even where
+	//an int is 32 bits
+	maxTotalWeight = 1000000000
+)
+
+var (
+	weightedContentPattern = regexp.MustCompile("^\\{w:([^}]*)\\}\\s*(.*)$")
+)
+
+//parses the weight prefix of each row of a weighted table eg {w:5} goblin. Space
+//following the prefix is not part of the content. Rows without a prefix have a
+//weight of 1
+func (t *Table) validateWeights(vr *validate.ValidationResult) {
+
+	//set up to store parsed weighted content
+	allContent := make([]*weightedContent, 0, len(t.RawContent))
+	total := 0
+
+	for row, rc := range t.RawContent {
+		wtCont := &weightedContent{
+			Weight:  1,
+			Content: rc,
+		}
+		if matches := weightedContentPattern.FindStringSubmatch(rc); matches != nil { //{w:x}
+			weight, err := strconv.Atoi(matches[1])
+			if err != nil || weight <= 0 || weight > maxWeight {
+				vr.Fail(contentSection, fmt.Sprintf("Invalid weight: %s must be a whole number from 1 to %d", matches[1], maxWeight)).
+					WithCode(validate.CodeInvalidWeight).WithRow(row).At(t.Source.Row(row))
+			}
+			wtCont.Weight = weight
+			wtCont.Content = matches[2]
+		}
+		if wtCont.Weight > 0 && total <= maxTotalWeight { //report only the row that goes over
+			total += wtCont.Weight
+			if total > maxTotalWeight {
+				vr.Fail(contentSection, fmt.Sprintf("Total weight of the table exceeds %d", maxTotalWeight)).
+					WithCode(validate.CodeInvalidWeight).WithRow(row).At(t.Source.Row(row))
+			}
+		}
+		allContent = append(allContent, wtCont)
+	}
+	t.WeightedContent = allContent
+}
+
+//Weights returns the weight of each row of the table. Rows of flat tables all
+//have a weight of 1
+func (t *Table) Weights() []int {
+	weights := make([]int, 0, len(t.RawContent))
+	if t.Definition.TableType == TypeWeighted {
+		for _, wc := range t.WeightedContent {
+			weights = append(weights, wc.Weight)
+		}
+		return weights
+	}
+	for range t.RawContent {
+		weights = append(weights, 1)
+	}
+	return weights
+}
+
+//TotalWeight returns the sum of the weights of the table's rows
+func (t *Table) TotalWeight() int {
+	total := 0
+	for _, w := range t.Weights() {
+		total += w
+	}
+	return total
+}
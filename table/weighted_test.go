@@ -0,0 +1,96 @@
+package table
+
+import (
+	"tablib/validate"
+	"testing"
+)
+
+func TestWeightValidation_shouldRejectBadWeights(t *testing.T) {
+	yml := `
+  definition:
+    name: TestTable
+    type: weighted
+  content:
+    - '{w:0}item 1'
+    - '{w:-2}item 2'
+    - '{w:x}item 3'
+    - '{w:1.5}item 4'
+    - '{w:2000000}item 5'
+    - '{w:3}item 6'`
+
+	tb := tableFromYaml(yml, t)
+	vr := validate.NewValidationResult()
+	tb.validateWeights(vr)
+	failOnNoErrors(vr, t)
+	equals(vr.ErrorCount(), 5, t)
+}
+
+func TestWeightValidation_shouldRejectTooGreatATotalWeight(t *testing.T) {
+	yml := `
+  definition:
+    name: TestTable
+    type: weighted
+  content:`
+	for i := 0; i < 1002; i++ {
+		yml += "\n    - '{w:1000000}item'"
+	}
+
+	tb := tableFromYaml(yml, t)
+	vr := validate.NewValidationResult()
+	tb.validateWeights(vr)
+	equals(vr.ErrorCount(), 1, t)
+	equals(vr.Diagnostics[0].Row, 1000, t)
+	equals(vr.Diagnostics[0].Code, validate.CodeInvalidWeight, t)
+}
+
+func TestWeightValidation_shouldConvertWeightedTableToInternalFormat(t *testing.T) {
+	yml := `
+  definition:
+    name: TestTable
+    type: weighted
+  content:
+    - '{w:5} goblin'
+    - '{w:2}orc is {@SomeTable}'
+    - troll`
+
+	tb := tableFromYaml(yml, t)
+	vr := tb.Validate()
+	failOnErrors(vr, t)
+
+	equals(len(tb.WeightedContent), 3, t)
+	equals(tb.WeightedContent[0].Weight, 5, t)
+	equals(tb.WeightedContent[0].Content, "goblin", t)
+	equals(tb.WeightedContent[1].Weight, 2, t)
+	equals(tb.WeightedContent[1].Content, "orc is {@SomeTable}", t)
+	equals(tb.WeightedContent[2].Weight, 1, t)
+	equals(tb.WeightedContent[2].Content, "troll", t)
+	equals(tb.TotalWeight(), 8, t)
+	equals(tb.ContentRows()[1], "orc is {@SomeTable}", t)
+	equals(len(tb.References()), 1, t)
+}
+
+func TestWeightValidation_shouldWeightFlatRowsEqually(t *testing.T) {
+	yml := `
+  definition:
+    name: TestTable
+    type: flat
+  content:
+    - '{@Other}'
+    - item 2`
+
+	tb := tableFromYaml(yml, t)
+	failOnErrors(tb.Validate(), t)
+	equals(tb.TotalWeight(), 2, t)
+}
+
+func TestWeightValidation_shouldRejectBadRefsInWeightedContent(t *testing.T) {
+	yml := `
+  definition:
+    name: TestTable
+    type: weighted
+  content:
+    - '{w:2}item {@1}'`
+
+	tb := tableFromYaml(yml, t)
+	failOnNoErrors(tb.Validate(), t)
+}
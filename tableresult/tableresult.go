@@ -1,9 +1,22 @@
 package tableresult
 
+import "strings"
+
 //TableResult holds the final result of a table run
 type TableResult struct {
 	Result []string
 	Log    []string
+	Trace  []*TraceNode //one tree per generated result
+
+	//Errors holds every problem met during execution, including Err. Those that
+	//did not halt execution, such as a reference to a missing table, leave a
+	//marker in the result where they occurred
+	Errors []error
+
+	//Err is set if execution halted before all results were generated, for
+	//example when tables recurse without end or the caller's context was
+	//cancelled. Result holds only those results completed before the error
+	Err error
 }
 
 //NewTableResult does what it says on the tin
@@ -11,6 +24,8 @@ func NewTableResult() *TableResult {
 	tr := &TableResult{
 		Result: make([]string, 0, 1),
 		Log:    make([]string, 0, 1),
+		Trace:  make([]*TraceNode, 0, 1),
+		Errors: make([]error, 0),
 	}
 	return tr
 }
@@ -24,3 +39,28 @@ func (tr *TableResult) AddLog(msg string) {
 func (tr *TableResult) AddResult(msg string) {
 	tr.Result = append(tr.Result, msg)
 }
+
+//AddError records a problem met during execution
+func (tr *TableResult) AddError(err error) {
+	tr.Errors = append(tr.Errors, err)
+}
+
+//AddTrace adds the root of an execution trace tree
+func (tr *TableResult) AddTrace(node *TraceNode) {
+	tr.Trace = append(tr.Trace, node)
+}
+
+//Completed returns true if execution ran to completion rather than being cut
+//off. See Err for the reason execution was cut off
+func (tr *TableResult) Completed() bool {
+	return tr.Err == nil
+}
+
+//TraceString renders all execution trace trees as indented text
+func (tr *TableResult) TraceString() string {
+	var sb strings.Builder
+	for _, node := range tr.Trace {
+		sb.WriteString(node.String())
+	}
+	return sb.String()
+}
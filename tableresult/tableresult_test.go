@@ -1,6 +1,7 @@
 package tableresult
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -35,3 +36,56 @@ func TestAddLog_shouldAddToResult(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestCompleted_shouldReflectErr(t *testing.T) {
+	tr := NewTableResult()
+	if !tr.Completed() {
+		t.Fail()
+	}
+	tr.Err = errors.New("cut off")
+	if tr.Completed() {
+		t.Fail()
+	}
+}
+
+func TestAddTrace_shouldAddAndRenderTrace(t *testing.T) {
+	root := NewTraceNode("Parent", "roll")
+	root.DiceExpr = "1d2"
+	root.Roll = 2
+	root.Row = 1
+	root.Result = "child result"
+
+	child := NewTraceNode("Child", "roll")
+	child.Reference = "{@Child}"
+	child.Result = "result"
+	root.AddChild(child)
+
+	tr := NewTableResult()
+	tr.AddTrace(root)
+
+	if len(tr.Trace) != 1 {
+		t.Fail()
+	}
+	if child.Row != -1 {
+		t.Error("New trace nodes should not have a selected row")
+	}
+
+	expected := "roll Parent: 1d2 rolled 2, row 1 => \"child result\"\n" +
+		"  {@Child} roll Child => \"result\"\n"
+	if tr.TraceString() != expected {
+		t.Errorf("Unexpected trace rendering:\n%s", tr.TraceString())
+	}
+}
+
+func TestAddError_shouldAddToErrors(t *testing.T) {
+	tr := NewTableResult()
+	err := errors.New("bad ref")
+	tr.AddError(err)
+
+	if len(tr.Errors) != 1 || tr.Errors[0] != err {
+		t.Fail()
+	}
+	if !tr.Completed() { //errors that do not halt execution leave Err alone
+		t.Fail()
+	}
+}
@@ -0,0 +1,77 @@
+package tableresult
+
+import (
+	"fmt"
+	"strings"
+)
+
+//TraceNode records a single roll, pick or dice evaluation performed while
+//generating a result. Table references found in a result are expanded as
+//children of the node that produced them, so the nodes form a tree describing
+//exactly how the final result was assembled
+type TraceNode struct {
+	Table     string       `json:"table"`
+	Operation string       `json:"operation"`
+	Reference string       `json:"reference,omitempty"` //the table ref that caused this expansion, empty for top-level nodes
+	DiceExpr  string       `json:"diceExpr,omitempty"`
+	Roll      int          `json:"roll"`
+	Row       int          `json:"row"` //index of the selected content row, -1 if none
+	RangeLow  int          `json:"rangeLow,omitempty"`
+	RangeHigh int          `json:"rangeHigh,omitempty"`
+	Picks     []int        `json:"picks,omitempty"` //indexes of the picked content rows
+	Result    string       `json:"result"`
+	Error     string       `json:"error,omitempty"`
+	Children  []*TraceNode `json:"children,omitempty"`
+}
+
+//NewTraceNode does what it says on the tin
+func NewTraceNode(tableName, operation string) *TraceNode {
+	return &TraceNode{
+		Table:     tableName,
+		Operation: operation,
+		Row:       -1,
+		Children:  make([]*TraceNode, 0),
+	}
+}
+
+//AddChild adds a nested expansion to this node
+func (tn *TraceNode) AddChild(child *TraceNode) {
+	tn.Children = append(tn.Children, child)
+}
+
+//String renders this node and all of its children as indented text
+func (tn *TraceNode) String() string {
+	var sb strings.Builder
+	tn.render(&sb, 0)
+	return sb.String()
+}
+
+func (tn *TraceNode) render(sb *strings.Builder, depth int) {
+	sb.WriteString(strings.Repeat("  ", depth))
+	if tn.Reference != "" {
+		sb.WriteString(fmt.Sprintf("%s ", tn.Reference))
+	}
+	sb.WriteString(fmt.Sprintf("%s %s", tn.Operation, tn.Table))
+	if tn.DiceExpr != "" {
+		sb.WriteString(fmt.Sprintf(": %s rolled %d", tn.DiceExpr, tn.Roll))
+	}
+	if tn.Row >= 0 {
+		sb.WriteString(fmt.Sprintf(", row %d", tn.Row))
+	}
+	if tn.RangeLow != 0 || tn.RangeHigh != 0 {
+		sb.WriteString(fmt.Sprintf(" {%d-%d}", tn.RangeLow, tn.RangeHigh))
+	}
+	if len(tn.Picks) > 0 {
+		sb.WriteString(fmt.Sprintf(", picked rows %v", tn.Picks))
+	}
+	if tn.Error != "" {
+		sb.WriteString(fmt.Sprintf(" ERROR: %s", tn.Error))
+	} else {
+		sb.WriteString(fmt.Sprintf(" => %q", tn.Result))
+	}
+	sb.WriteString("\n")
+
+	for _, c := range tn.Children {
+		c.render(sb, depth+1)
+	}
+}
@@ -1,10 +1,14 @@
 package tablib
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"io/fs"
 	"sort"
 	"strings"
 	"sync"
+	"tablib/dice"
 	"tablib/tableresult"
 	"tablib/validate"
 )
@@ -20,7 +24,11 @@ type TableRepository interface {
 	//
 	//If the presented yaml is not parsable or has other structural issues, an error is raised.
 	//Errors and warnings related to the semantics of the table (e.g. internal consistency
-	//issues or table syntax errors) are captured in the returned ValidationResult
+	//issues or table syntax errors) are captured in the returned ValidationResult.
+	//
+	//Table names may be qualified by a namespace eg dnd5e/names, see LoadFSNamespace.
+	//What happens when the table's name is already in use depends on the
+	//repository's CollisionPolicy
 	AddTable(yamlBytes []byte) (*validate.ValidationResult, error)
 
 	//Execute executes the named Lua script and returns a map of named output keys and their values.
@@ -31,7 +39,9 @@ type TableRepository interface {
 	//information the script wishes to communicate to the client, like a synthesized or concatenated
 	//result of several tables rolls that have been assembled in the script to produce an overall
 	//meaningful result. If an error occurs in script execution, error information will be returned
-	//in the map in place of the intended result(s).
+	//in the map in place of the intended result(s). This includes the errors ExecuteContext
+	//returns: a *NotFoundError if the script does not exist and a *LimitError if the script
+	//exceeded one of the Lua sandbox limits.
 	//
 	//The callback function is optional. If used, it will be called if the Lua script requests
 	//parameters from the caller. If set to nil, the Lua script will be returned the default
@@ -39,25 +49,124 @@ type TableRepository interface {
 	//use of the callback, see the README documentation.
 	Execute(scriptName string, callback ParamSpecificationRequestCallback) map[string]string
 
+	//ExecuteContext is Execute under the control of the given context. Cancelling the
+	//context, or reaching its deadline, interrupts the Lua script mid-execution along with
+	//any table rolls or picks the script is making.
+	//
+	//If the script was cut off, a nil map is returned along with the context's error or, if
+	//the script exceeded one of the repository's Lua sandbox limits, a *LimitError. See
+	//the WithScript* options for the limits. Otherwise the error is nil and the map is as
+	//described for Execute. If the script does not exist, a nil map and a *NotFoundError
+	//matching ErrScriptNotFound are returned. Execute reports these errors in the map's
+	//Script-Error entry
+	ExecuteContext(ctx context.Context, scriptName string,
+		callback ParamSpecificationRequestCallback) (map[string]string, error)
+
 	//EvaluateDiceExpression revaluates a dice expression and returns the result or
 	//an an error f the expression is not valid.
 	EvaluateDiceExpression(diceExpr string) (int, error)
 
+	//ExplainDiceExpression evaluates a dice expression and describes how the result
+	//was reached: each term, every die rolled and whether it was kept, dropped,
+	//rerolled or exploded. The breakdown's String method gives a one line summary
+	//eg 2d6 + 3 = [4, 2] + 3 = 9. An error is returned if the expression is not valid
+	ExplainDiceExpression(diceExpr string) (*dice.Breakdown, error)
+
+	//AnalyzeDiceExpression computes the probability of each value a dice expression
+	//can produce. An error is returned if the expression is not valid or is too
+	//complex to analyse
+	AnalyzeDiceExpression(diceExpr string) (dice.Distribution, error)
+
+	//AnalyzeTable computes the probability of rolling each content row of the named
+	//table. It also reports rows that can never be rolled and rolls that select no
+	//row, which would produce an error result during execution
+	AnalyzeTable(tableName string) (*TableAnalysis, error)
+
+	//LoadFS adds every table and script found in the given file system to the repository.
+	//
+	//Files ending in .yml or .yaml are added as tables and files ending in .lua are
+	//added as scripts named for the file (less the extension). Hidden files and
+	//directories are skipped. Files are loaded in parallel. Where two files define
+	//the same table or script only the first, in path order, is loaded. The returned
+	//report holds the outcome of each file, including table ValidationResults. An
+	//error is returned only if the file system itself could not be read. Both
+	//embed.FS and os.DirFS may be used
+	LoadFS(fsys fs.FS) (*LoadReport, error)
+
+	//LoadFSNamespace is LoadFS but places every table and script it loads in the
+	//given namespace eg a table named names loaded into namespace dnd5e is named
+	//dnd5e/names. Loading each source of content into its own namespace keeps
+	//tables of the same name from colliding, see WithCollisionPolicy.
+	//
+	//Table names used by a table or script are resolved relative to its own
+	//namespace: {@names} in a table of namespace dnd5e refers to dnd5e/names if
+	//there is such a table and otherwise to names. Qualified references such as
+	//{@dnd5e/names} always refer to the table of exactly that name. The tables'
+	//sources returned by List are as loaded, without the namespace
+	LoadFSNamespace(fsys fs.FS, namespace string) (*LoadReport, error)
+
 	//List provides the raw string listing of the named table or script.
 	//
 	//An error is returned if the named item does not exist or if itemType is anything
 	//other than "table" or "script"
 	List(name string, itemType string) (string, error)
 
+	//RemoveLuaScript removes the named script from the repository.
+	//
+	//An error is returned if the named script does not exist
+	RemoveLuaScript(scriptName string) error
+
+	//RemoveTable removes the named table and all of its inline tables from the repository.
+	//
+	//If refuseIfReferenced is true, the table is not removed and an error is returned
+	//if any other table still refers to it via {@name} or {n!name}. An error is also
+	//returned if the named table does not exist or is an inline table, which can only
+	//be removed along with the table that defines it
+	RemoveTable(tableName string, refuseIfReferenced bool) error
+
 	//Pick returns count unique items from the named table.
 
 	//The table type must be flat; providing the name of a ranged table will generate
-	//an error
+	//an error. Problems met along the way, such as references to missing tables, are
+	//in TableResult.Errors and may be tested for with errors.Is eg ErrTableNotFound
 	Pick(tableName string, count int) *tableresult.TableResult
 
-	//Roll 'rolls' on the named table count times, generating a single result with each roll
+	//PickContext is Pick under the control of the given context. Cancelling the context,
+	//or reaching its deadline, stops table expansion. Use TableResult.Completed to see
+	//whether the pick completed or was cut off
+	PickContext(ctx context.Context, tableName string, count int) *tableresult.TableResult
+
+	//ReferenceGraph returns the graph of references between the tables and scripts in the
+	//repository, suitable for drawing or further analysis.
+	//
+	//Table references are found in table content. Script references are found by scanning
+	//the script source for string literal table names passed to roll and pick, so tables
+	//named at runtime will not appear. References to tables that do not exist are included
+	//and marked as dangling
+	ReferenceGraph() *ReferenceGraph
+
+	//Roll 'rolls' on the named table count times, generating a single result with each roll.
+	//As with Pick, problems met along the way are in TableResult.Errors
 	Roll(tableName string, count int) *tableresult.TableResult
 
+	//RollContext is Roll under the control of the given context. Cancelling the context,
+	//or reaching its deadline, stops table expansion. Results completed before then are
+	//kept. Use TableResult.Completed to see whether the rolls completed or were cut off
+	RollContext(ctx context.Context, tableName string, count int) *tableresult.TableResult
+
+	//SaveSnapshot writes the entire contents of the repository to w: the source,
+	//parsed form and tags of every table and the source and tags of every script.
+	//The snapshot is stamped with SnapshotVersion
+	SaveSnapshot(w io.Writer) error
+
+	//LoadSnapshot replaces the contents of the repository with a snapshot written
+	//by SaveSnapshot. Tables are restored as parsed, without being validated again,
+	//though each is checked to hold what executing it needs and its dice are parsed
+	//again from its roll. Scripts are recompiled as gopher-lua bytecode can not be restored. Snapshots
+	//written by another format version are refused with ErrSnapshotVersion and the
+	//repository is left unchanged if the snapshot can not be loaded
+	LoadSnapshot(r io.Reader) error
+
 	//Search returns information about the tables and scripts in the repository.
 
 	//The namePredicate must be a valid regular expression and is optional. If not provided,
@@ -74,6 +183,11 @@ type TableRepository interface {
 
 	//Tags returns an alphabetized list of all tags used by any table or script
 	Tags() []string
+
+	//ValidateReferences checks the references between all tables and scripts in the
+	//repository. Dangling references (to tables that do not exist) are errors. Reference
+	//cycles and tables that are not referenced by any other table or script are warnings
+	ValidateReferences() *validate.ValidationResult
 }
 
 //SearchResult holds information about each object discovered during a search
@@ -91,13 +205,20 @@ func (sr *SearchResult) toComparable() string {
 	return fmt.Sprintf("%s:%s", sr.Name, sr.Type)
 }
 
-//NewTableRepository does what it says on the tin
-func NewTableRepository() TableRepository {
-	return &concreteTableRepo{
+//NewTableRepository does what it says on the tin. Options may be provided to
+//alter the behavior of the repository, see RepositoryOption
+func NewTableRepository(opts ...RepositoryOption) TableRepository {
+	cr := &concreteTableRepo{
 		tableStore:      make(map[string]*tableData),
 		scriptStore:     make(map[string]*scriptData),
 		tagSearchCache:  make(map[string][]*SearchResult),
 		nameSearchCache: make(map[string]*SearchResult),
 		lock:            &sync.RWMutex{},
+		rnd:             newTimeSeededSource(),
+		config:          defaultExecutionConfig(),
+	}
+	for _, opt := range opts {
+		opt(cr)
 	}
+	return cr
 }
@@ -0,0 +1,77 @@
+package util
+
+import (
+	"github.com/yuin/gopher-lua"
+)
+
+var (
+	//safeGlobals are the base library globals a sandboxed script may use. Notably
+	//absent are the loaders (load, loadstring, loadfile, dofile, module), the
+	//environment and metatable functions (getfenv, setfenv, getmetatable,
+	//setmetatable), the raw accessors (rawget, rawset, rawequal), collectgarbage,
+	//newproxy and print, which would write to the host's stdout
+	safeGlobals = []string{"assert", "error", "ipairs", "next", "pairs", "pcall",
+		"select", "tonumber", "tostring", "type", "unpack", "xpcall", "_VERSION"}
+
+	//safeLibs are the libraries a sandboxed script may use. Each script gets its
+	//own copy of the library tables so changes made to them do not escape
+	safeLibs = []string{lua.StringLibName, lua.TabLibName, lua.MathLibName}
+)
+
+//NewSandboxEnv creates a fresh global environment for a single script run. It
+//holds only the globals and libraries considered safe for untrusted scripts and
+//a require that may load only the named modules, which must have been preloaded
+//(see LState.PreloadModule). _G refers to the environment itself, so globals
+//the script defines stay in the environment and can not leak to other runs.
+//
+//Set a script function's Env to the returned table before calling it. Any
+//changes to the VM's libraries (eg replacing a library function with a safer
+//version) must be made before calling NewSandboxEnv
+func NewSandboxEnv(lState *lua.LState, requireable ...string) *lua.LTable {
+	env := lState.NewTable()
+	for _, name := range safeGlobals {
+		env.RawSetString(name, lState.GetGlobal(name))
+	}
+	for _, name := range safeLibs {
+		if lib, ok := lState.GetGlobal(name).(*lua.LTable); ok {
+			libCopy := lState.NewTable()
+			lib.ForEach(func(k, v lua.LValue) {
+				libCopy.RawSet(k, v)
+			})
+			env.RawSetString(name, libCopy)
+		}
+	}
+	env.RawSetString("_G", env)
+	env.RawSetString("require", restrictedRequire(lState, requireable))
+	return env
+}
+
+//wraps require so only the named modules may be loaded
+func restrictedRequire(lState *lua.LState, requireable []string) *lua.LFunction {
+	require := lState.GetGlobal("require")
+	return lState.NewFunction(func(L *lua.LState) int {
+		name := L.CheckString(1)
+		for _, r := range requireable {
+			if r == name {
+				L.Push(require)
+				L.Push(lua.LString(name))
+				L.Call(1, 1)
+				return 1
+			}
+		}
+		L.RaiseError("module %s may not be required", name)
+		return 0
+	})
+}
+
+//removes every module loader but package.preload so require can never load
+//lua files from disk
+func removeFileLoaders(lState *lua.LState) {
+	loaders, ok := lState.GetField(lState.Get(lua.RegistryIndex), "_LOADERS").(*lua.LTable)
+	if !ok {
+		return
+	}
+	for i := loaders.Len(); i > 1; i-- { //the preload loader is first
+		loaders.RawSetInt(i, lua.LNil)
+	}
+}
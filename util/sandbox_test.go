@@ -0,0 +1,99 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+//runs lua in a fresh sandbox, returning the value of the global "val"
+func runSandboxed(lState *lua.LState, code string) (lua.LValue, error) {
+	fn, err := lState.LoadString(code)
+	if err != nil {
+		return nil, err
+	}
+	env := NewSandboxEnv(lState, "safe")
+	fn.Env = env
+	lState.Push(fn)
+	if err := lState.PCall(0, lua.MultRet, nil); err != nil {
+		return nil, err
+	}
+	return lState.GetField(env, "val"), nil
+}
+
+func newSandboxState() *lua.LState {
+	lState := NewLuaState()
+	lState.PreloadModule("safe", func(L *lua.LState) int {
+		L.Push(L.NewTable())
+		return 1
+	})
+	return lState
+}
+
+func TestSandbox_shouldRemoveDangerousGlobals(t *testing.T) {
+	lState := newSandboxState()
+	defer lState.Close()
+
+	for _, name := range []string{"load", "loadstring", "loadfile", "dofile", "module",
+		"getfenv", "setfenv", "getmetatable", "setmetatable", "rawget", "rawset", "rawequal",
+		"collectgarbage", "newproxy", "print", "_printregs", "package", "os", "io", "debug", "channel",
+		"coroutine"} {
+		val, err := runSandboxed(lState, "val = "+name)
+		if err != nil || val != lua.LNil {
+			t.Errorf("%s is available in the sandbox: %v %v", name, val, err)
+		}
+	}
+
+	//_G is the sandbox
+	if val, err := runSandboxed(lState, "val = _G.loadstring or _G.string.rep"); err != nil || val.Type() != lua.LTFunction {
+		t.Errorf("_G is not the sandbox: %v %v", val, err)
+	}
+}
+
+func TestSandbox_shouldRejectEscapeAttempts(t *testing.T) {
+	lState := newSandboxState()
+	defer lState.Close()
+
+	for name, code := range map[string]string{
+		"require os":      `require("os")`,
+		"require io":      `require("io")`,
+		"require debug":   `require("debug")`,
+		"require package": `require("package")`,
+		"require file":    `require("util")`,
+		"string meta":     `("x").load("return 1")`,
+	} {
+		if _, err := runSandboxed(lState, code); err == nil {
+			t.Errorf("%s: escape attempt succeeded", name)
+		}
+	}
+
+	if val, err := runSandboxed(lState, `val = type(require("safe"))`); err != nil || val.String() != "table" {
+		t.Errorf("Allowed module could not be required: %v %v", val, err)
+	}
+}
+
+func TestSandbox_shouldNotLeakGlobals(t *testing.T) {
+	lState := newSandboxState()
+	defer lState.Close()
+
+	if _, err := runSandboxed(lState, `leaked = "yes"; string.rep = nil; pairs = nil`); err != nil {
+		t.Fatalf("Unable to run script: %v", err)
+	}
+	val, err := runSandboxed(lState, `val = tostring(leaked) .. type(string.rep) .. type(pairs)`)
+	if err != nil || val.String() != "nilfunctionfunction" {
+		t.Errorf("Globals leaked between runs: %v %v", val, err)
+	}
+	if lState.GetGlobal("leaked") != lua.LNil {
+		t.Errorf("Global leaked to the VM")
+	}
+}
+
+func TestSandbox_shouldOnlyLoadPreloadedModules(t *testing.T) {
+	lState := newSandboxState()
+	defer lState.Close()
+
+	loaders := lState.GetField(lState.Get(lua.RegistryIndex), "_LOADERS").(*lua.LTable)
+	if loaders.Len() != 1 {
+		t.Errorf("Unexpected module loaders present: %d", loaders.Len())
+	}
+}
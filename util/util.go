@@ -14,6 +14,33 @@ var (
 	validIdentifierPattern = regexp.MustCompile("^[A-Za-z][a-zA-Z0-9_\\-]+$")
 )
 
+//NamespaceSeparator separates the namespaces of a qualified name eg dnd5e/names
+const NamespaceSeparator = "/"
+
+//Namespace returns the namespace of a qualified name eg dnd5e for dnd5e/names
+//and dnd5e/monsters for dnd5e/monsters/names. "" is returned for unqualified names
+func Namespace(name string) string {
+	idx := strings.LastIndex(name, NamespaceSeparator)
+	if idx == -1 {
+		return ""
+	}
+	return name[:idx]
+}
+
+//QualifyName places the name in the namespace. The name is returned as is if
+//the namespace is ""
+func QualifyName(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + NamespaceSeparator + name
+}
+
+//IsQualified returns true if the name includes a namespace
+func IsQualified(name string) bool {
+	return strings.Contains(name, NamespaceSeparator)
+}
+
 //BuildFullName builds the full name of the table or inline table
 func BuildFullName(name, idnum string) string {
 	if idnum == "" {
@@ -25,14 +52,25 @@ func BuildFullName(name, idnum string) string {
 //IsNotEmpty validates that the incoming string is not ""
 func IsNotEmpty(stringVal, yamlName, section string, vr *validate.ValidationResult) {
 	if stringVal == "" {
-		vr.Fail(section, fmt.Sprintf("Empty %s", yamlName))
+		vr.Fail(section, fmt.Sprintf("Empty %s", yamlName)).WithCode(validate.CodeEmptyValue)
 	}
 }
 
 //IsValidIdentifier validates the supplied string against the valid id regex
 func IsValidIdentifier(stringVal, yamlName, section string, vr *validate.ValidationResult) {
 	if !validIdentifierPattern.MatchString(stringVal) {
-		vr.Fail(section, fmt.Sprintf("Invalid identifier for %s: %s", yamlName, stringVal))
+		vr.Fail(section, fmt.Sprintf("Invalid identifier for %s: %s", yamlName, stringVal)).WithCode(validate.CodeInvalidName)
+	}
+}
+
+//IsValidName validates the supplied table or script name, an identifier that
+//may be qualified by one or more namespaces which are themselves identifiers
+func IsValidName(stringVal, yamlName, section string, vr *validate.ValidationResult) {
+	for _, part := range strings.Split(stringVal, NamespaceSeparator) {
+		if !validIdentifierPattern.MatchString(part) {
+			vr.Fail(section, fmt.Sprintf("Invalid identifier for %s: %s", yamlName, stringVal)).WithCode(validate.CodeInvalidName)
+			return
+		}
 	}
 }
 
@@ -62,16 +100,32 @@ func FindNextTableRef(tableEntry string) ([]string, bool) {
 //NewLuaState creates a new lua state/VM
 //
 //Set up a new lua VM. Limit the lua basic lib to essential functions in
-//an attempt to reduce the scope of malicious scripts. This is actually really
-//hard to do and the modules here are still condsidered dangerously unsafe but
-//are neccessary if lua is to be used at all. Note that clever attackers
-//can easily work around these limitations.
+//an attempt to reduce the scope of malicious scripts. The VM's own globals
+//still include unsafe functions that the host needs (eg require), so untrusted
+//scripts must be run in an environment from NewSandboxEnv. require can only
+//load modules preloaded by the host, never files.
 //
 //See http://lua-users.org/wiki/SandBoxes for info on the relative futility of
 //trying to make lua VMs both safe and functional
 func NewLuaState() *lua.LState {
-	//TODO: limit call stack and repository sizes - maybe?
-	lState := lua.NewState(lua.Options{SkipOpenLibs: true})
+	return NewLimitedLuaState(lua.CallStackSize, lua.RegistrySize)
+}
+
+//NewLimitedLuaState creates a new lua state/VM as NewLuaState does but with the
+//given call stack size and maximum registry (data stack) size. Exceeding either
+//raises a lua error of "stack overflow" or "registry overflow" respectively
+func NewLimitedLuaState(callStackSize, registrySize int) *lua.LState {
+	//start small and grow as needed so a large limit does not cost up front
+	initialRegistrySize := registrySize
+	if initialRegistrySize > lua.RegistrySize {
+		initialRegistrySize = lua.RegistrySize
+	}
+	lState := lua.NewState(lua.Options{
+		SkipOpenLibs:    true,
+		CallStackSize:   callStackSize,
+		RegistrySize:    initialRegistrySize,
+		RegistryMaxSize: registrySize,
+	})
 	for _, pair := range []struct {
 		n string
 		f lua.LGFunction
@@ -91,6 +145,7 @@ func NewLuaState() *lua.LState {
 			os.Exit(-1)
 		}
 	}
+	removeFileLoaders(lState)
 
 	return lState
 }
@@ -62,6 +62,47 @@ func TestIsValidIdentifier_shouldRejectInvalidIds(t *testing.T) {
 		}
 	}
 }
+
+func TestIsValidName_shouldAcceptQualifiedNames(t *testing.T) {
+	var names = []string{"names", "dnd5e/names", "dnd5e/monsters/names"}
+
+	for _, name := range names {
+		vr := validate.NewValidationResult()
+		IsValidName(name, "testval", "test", vr)
+		if !vr.IsValid {
+			t.Errorf("This should be a valid name: %s", name)
+		}
+	}
+}
+
+func TestIsValidName_shouldRejectInvalidNames(t *testing.T) {
+	var names = []string{"", "/names", "dnd5e/", "dnd5e//names", "5e/names", "dnd5e/n", "dnd5e\\names"}
+
+	for _, name := range names {
+		vr := validate.NewValidationResult()
+		IsValidName(name, "testval", "test", vr)
+		if vr.IsValid {
+			t.Errorf("This should be an invalid name: %s", name)
+		}
+	}
+}
+
+func TestNamespace_shouldSplitQualifiedNames(t *testing.T) {
+	for name, want := range map[string]string{
+		"names":                "",
+		"dnd5e/names":          "dnd5e",
+		"dnd5e/monsters/names": "dnd5e/monsters",
+		"dnd5e/names.1":        "dnd5e",
+	} {
+		if ns := Namespace(name); ns != want {
+			t.Errorf("Namespace of %s is %s want %s", name, ns, want)
+		}
+	}
+	if QualifyName("", "names") != "names" || QualifyName("dnd5e", "names") != "dnd5e/names" {
+		t.Error("Names not qualified as expected")
+	}
+}
+
 func TestFindNextTableRef_shouldWork(t *testing.T) {
 	ttrs := []*TestTableRef{
 		toTTR("", false, "", "", ""),
@@ -0,0 +1,146 @@
+package validate
+
+import "fmt"
+
+//Severity is how serious a diagnostic is
+type Severity string
+
+const (
+	//SeverityError marks an issue that makes a table invalid
+	SeverityError Severity = "ERROR"
+
+	//SeverityWarn marks an issue worth fixing that does not stop a table being used
+	SeverityWarn Severity = "WARN"
+)
+
+//Code identifies the kind of issue a diagnostic reports. Codes are stable so
+//that tools may act on them, the wording of messages may change
+type Code string
+
+//Definition codes
+const (
+	CodeEmptyValue       Code = "empty-value"  //a required value is missing
+	CodeInvalidName      Code = "invalid-name" //a name or identifier is malformed
+	CodeInvalidDice      Code = "invalid-dice" //a dice expression does not parse
+	CodeUnknownTableType Code = "unknown-table-type"
+	CodeMissingRoll      Code = "missing-roll"   //a range table has no roll
+	CodeUnusedRoll       Code = "unused-roll"    //a roll is given for a table that does not use it
+	CodeTableReplaced    Code = "table-replaced" //a table was added over one of the same name
+)
+
+//Content codes
+const (
+	CodeNoContent        Code = "no-content"
+	CodeInvalidReference Code = "invalid-reference" //a {...} reference is not one of the known kinds
+	CodeUnbalancedBraces Code = "unbalanced-braces"
+	CodeInvalidRange     Code = "invalid-range"     //a range prefix is missing or malformed
+	CodeRangeOverlap     Code = "range-overlap"     //ranges overlap or are out of order
+	CodeRangeGap         Code = "range-gap"         //a possible roll is handled by no range
+	CodeRangeUnreachable Code = "range-unreachable" //a range covers rolls the dice can not make
+	CodeRangeUnchecked   Code = "range-unchecked"   //the ranges could not be checked against the roll
+	CodeInvalidWeight    Code = "invalid-weight"
+)
+
+//Inline table codes
+const (
+	CodeInvalidInlineID    Code = "invalid-inline-id"
+	CodeEmptyInline        Code = "empty-inline"
+	CodeDuplicateInline    Code = "duplicate-inline"
+	CodeUndefinedInline    Code = "undefined-inline" //an inline table is referenced but not defined
+	CodeUnreferencedInline Code = "unreferenced-inline"
+)
+
+//Reference codes, reported when the references between tables are checked
+const (
+	CodeMissingTable      Code = "missing-table"
+	CodeEndlessRecursion  Code = "endless-recursion" //every row leads back into the same tables
+	CodeReferenceCycle    Code = "reference-cycle"
+	CodeUnreferencedTable Code = "unreferenced-table"
+)
+
+//Position is a place in a source file. Lines and columns count from 1 and are
+//0 if not known. File is empty for sources that are not files eg tables given to
+//AddTable
+type Position struct {
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+}
+
+//IsValid returns true if the position is known
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+//String formats the position as editors expect eg tables/npc.yml:12:7. Only
+//the file, if any, is given if the line is not known
+func (p Position) String() string {
+	if !p.IsValid() {
+		return p.File
+	}
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+//Diagnostic is a single validation error or warning and where it was found
+type Diagnostic struct {
+	//where in the source the issue is, if known
+	Position
+
+	Severity Severity `json:"severity"`
+	Section  string   `json:"section"` //the part of the table eg Definition or Content
+	Code     Code     `json:"code,omitempty"`
+	Message  string   `json:"message"`
+	Table    string   `json:"table,omitempty"`
+	Row      int      `json:"row"`                //index of the content row at fault, -1 if none in particular
+	InlineID string   `json:"inlineId,omitempty"` //the inline table at fault, if any
+}
+
+func newDiagnostic(severity Severity, section, message string) *Diagnostic {
+	return &Diagnostic{
+		Severity: severity,
+		Section:  section,
+		Message:  message,
+		Row:      -1,
+	}
+}
+
+//WithCode sets the code of the diagnostic
+func (d *Diagnostic) WithCode(code Code) *Diagnostic {
+	d.Code = code
+	return d
+}
+
+//WithRow sets the content row the diagnostic concerns
+func (d *Diagnostic) WithRow(row int) *Diagnostic {
+	d.Row = row
+	return d
+}
+
+//WithInline sets the inline table the diagnostic concerns
+func (d *Diagnostic) WithInline(id string) *Diagnostic {
+	d.InlineID = id
+	return d
+}
+
+//At sets where in the source the diagnostic points, if the position is known
+func (d *Diagnostic) At(pos Position) *Diagnostic {
+	if pos.IsValid() {
+		d.Position = pos
+	}
+	return d
+}
+
+//WithTable sets the table the diagnostic concerns
+func (d *Diagnostic) WithTable(name string) *Diagnostic {
+	d.Table = name
+	return d
+}
+
+//String formats the diagnostic as it appears in ValidationResult.Errors eg
+//ERROR: Content - A table must have content
+func (d *Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s - %s", d.Severity, d.Section, d.Message)
+}
@@ -0,0 +1,71 @@
+package validate
+
+import (
+	"testing"
+)
+
+func TestDiagnostic_shouldRecordCodeAndLocation(t *testing.T) {
+	vr := NewValidationResult()
+	vr.Fail("Content", "Bad row").WithCode(CodeInvalidReference).WithRow(2).WithInline("1").WithTable("Foo")
+	vr.Warn("Inline", "Unused")
+
+	d := vr.Diagnostics[0]
+	if d.Severity != SeverityError || d.Section != "Content" || d.Message != "Bad row" ||
+		d.Code != CodeInvalidReference || d.Row != 2 || d.InlineID != "1" || d.Table != "Foo" {
+		t.Errorf("Unexpected diagnostic: %+v", d)
+	}
+	if d.String() != vr.Errors[0] || d.String() != "ERROR: Content - Bad row" {
+		t.Errorf("Unexpected string: %s", d.String())
+	}
+
+	d = vr.Diagnostics[1]
+	if d.Severity != SeverityWarn || d.Code != "" || d.Row != -1 || d.Table != "" {
+		t.Errorf("Unexpected diagnostic: %+v", d)
+	}
+	if len(vr.WithCode(CodeInvalidReference)) != 1 || len(vr.WithCode(CodeNoContent)) != 0 {
+		t.Error("Wrong diagnostics found by code")
+	}
+}
+
+func TestForRow_shouldLocateDiagnostics(t *testing.T) {
+	vr := NewValidationResult()
+	vr.Fail("Definition", "Before")
+	vr.ForRow(3, func() {
+		vr.Fail("Content", "Inside")
+		vr.Warn("Content", "Placed").WithRow(1)
+	})
+
+	for i, want := range []int{-1, 3, 1} {
+		if vr.Diagnostics[i].Row != want {
+			t.Errorf("%d: wrong row %d", i, vr.Diagnostics[i].Row)
+		}
+	}
+	if vr.ErrorCount() != 2 || vr.WarnCount() != 1 || vr.IssueCount() != 3 {
+		t.Error("Wrong counts")
+	}
+}
+
+func TestPosition_shouldFormat(t *testing.T) {
+	for _, tc := range []struct {
+		pos  Position
+		want string
+	}{
+		{Position{File: "tables/npc.yml", Line: 12, Column: 7}, "tables/npc.yml:12:7"},
+		{Position{Line: 3, Column: 1}, "3:1"},
+		{Position{File: "tables/npc.yml"}, "tables/npc.yml"},
+		{Position{}, ""},
+	} {
+		if tc.pos.String() != tc.want {
+			t.Errorf("%+v: got %s want %s", tc.pos, tc.pos.String(), tc.want)
+		}
+	}
+
+	vr := NewValidationResult()
+	vr.ForPosition(Position{Line: 2, Column: 3}, func() {
+		vr.Fail("Content", "Placed").At(Position{Line: 9, Column: 1})
+		vr.Fail("Content", "Inside").At(Position{}) //unknown positions are ignored
+	})
+	if vr.Diagnostics[0].Line != 9 || vr.Diagnostics[1].Line != 2 || vr.Diagnostics[1].Column != 3 {
+		t.Errorf("Wrong positions: %+v %+v", vr.Diagnostics[0], vr.Diagnostics[1])
+	}
+}
@@ -1,15 +1,14 @@
 package validate
 
-import (
-	"fmt"
-	"strings"
-)
-
 //ValidationResult holds table validation info
 type ValidationResult struct {
 	IsValid     bool
 	HasWarnings bool
-	Errors      []string
+	Diagnostics []*Diagnostic
+
+	//Errors holds each of the Diagnostics formatted as a string eg
+	//ERROR: Content - A table must have content
+	Errors []string
 }
 
 //NewValidationResult does what is says on the tin
@@ -17,21 +16,54 @@ func NewValidationResult() *ValidationResult {
 	vr := &ValidationResult{
 		IsValid:     true,
 		HasWarnings: false,
+		Diagnostics: make([]*Diagnostic, 0),
 		Errors:      make([]string, 0),
 	}
 	return vr
 }
 
-//Fail indicates a validation failure
-func (vr *ValidationResult) Fail(section, reason string) {
+//Fail indicates a validation failure. The diagnostic returned may be given a
+//code and location
+func (vr *ValidationResult) Fail(section, reason string) *Diagnostic {
 	vr.IsValid = false
-	vr.Errors = append(vr.Errors, fmt.Sprintf("ERROR: %s - %s", section, reason))
+	return vr.add(newDiagnostic(SeverityError, section, reason))
 }
 
-//Warn indicates a validation warning
-func (vr *ValidationResult) Warn(section, reason string) {
+//Warn indicates a validation warning. The diagnostic returned may be given a
+//code and location
+func (vr *ValidationResult) Warn(section, reason string) *Diagnostic {
 	vr.HasWarnings = true
-	vr.Errors = append(vr.Errors, fmt.Sprintf("WARN: %s - %s", section, reason))
+	return vr.add(newDiagnostic(SeverityWarn, section, reason))
+}
+
+func (vr *ValidationResult) add(d *Diagnostic) *Diagnostic {
+	vr.Diagnostics = append(vr.Diagnostics, d)
+	vr.Errors = append(vr.Errors, d.String())
+	return d
+}
+
+//ForRow runs check, setting the content row of each diagnostic it reports that
+//does not already have one
+func (vr *ValidationResult) ForRow(row int, check func()) {
+	start := len(vr.Diagnostics)
+	check()
+	for _, d := range vr.Diagnostics[start:] {
+		if d.Row < 0 {
+			d.Row = row
+		}
+	}
+}
+
+//ForPosition runs check, setting the source position of each diagnostic it
+//reports that does not already have one
+func (vr *ValidationResult) ForPosition(pos Position, check func()) {
+	start := len(vr.Diagnostics)
+	check()
+	for _, d := range vr.Diagnostics[start:] {
+		if !d.Position.IsValid() {
+			d.At(pos)
+		}
+	}
 }
 
 //Valid returns true if table is valid (no errors)
@@ -41,27 +73,36 @@ func (vr *ValidationResult) Valid() bool {
 
 //IssueCount provides the number of errors or warnings
 func (vr *ValidationResult) IssueCount() int {
-	return len(vr.Errors)
+	return len(vr.Diagnostics)
 }
 
 //ErrorCount provides the number of errors
 func (vr *ValidationResult) ErrorCount() int {
-	count := 0
-	for _, e := range vr.Errors {
-		if strings.HasPrefix(e, "ERROR") {
-			count++
-		}
-	}
-	return count
+	return vr.count(SeverityError)
 }
 
 //WarnCount provides the number of warnings
 func (vr *ValidationResult) WarnCount() int {
+	return vr.count(SeverityWarn)
+}
+
+func (vr *ValidationResult) count(severity Severity) int {
 	count := 0
-	for _, e := range vr.Errors {
-		if strings.HasPrefix(e, "WARN") {
+	for _, d := range vr.Diagnostics {
+		if d.Severity == severity {
 			count++
 		}
 	}
 	return count
 }
+
+//WithCode returns the diagnostics with the given code
+func (vr *ValidationResult) WithCode(code Code) []*Diagnostic {
+	found := make([]*Diagnostic, 0)
+	for _, d := range vr.Diagnostics {
+		if d.Code == code {
+			found = append(found, d)
+		}
+	}
+	return found
+}
@@ -0,0 +1,329 @@
+package tablib
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+	"tablib/util"
+	"tablib/validate"
+	"time"
+)
+
+const (
+	//WatchAdded indicates a file appeared and was loaded
+	WatchAdded = "added"
+
+	//WatchUpdated indicates a file changed and was reloaded
+	WatchUpdated = "updated"
+
+	//WatchRemoved indicates a file was deleted and its item removed from the repository
+	WatchRemoved = "removed"
+
+	//WatchError indicates the watched file system could not be scanned
+	WatchError = "error"
+)
+
+//WatchEvent describes a change a Watcher found and what it did about it
+type WatchEvent struct {
+	Path   string //the file that changed, empty for WatchError
+	Change string //one of the Watch* constants
+
+	//Result holds the outcome of loading an added or updated file and is nil
+	//for other changes. If the new version of a file failed to load, the
+	//previously loaded version of its table or script remains in the repository
+	Result *FileLoadResult
+
+	//Err holds any error encountered removing an item or scanning the file system
+	Err error
+}
+
+//Watcher keeps a TableRepository in sync with the tables and scripts in a file
+//system. Changed files are reloaded, deleted files have their table or script
+//removed from the repository and new files are added. If a changed file fails
+//to validate or compile, the last good version stays in the repository.
+//
+//The Watcher polls the file system and compares file contents rather than
+//relying on file system notifications, so any fs.FS may be watched.
+type Watcher struct {
+	repo      TableRepository
+	loader    fileLoader
+	fsys      fs.FS
+	namespace string
+	interval  time.Duration
+	onChange  func(*WatchEvent)
+
+	files    map[string]*watchedFile
+	scanned  bool //whether the first scan, which loads every file, has been made
+	scanLock *sync.Mutex
+
+	startOnce *sync.Once
+	stopOnce  *sync.Once
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+//the state of a single watched file. name is the table or script the file
+//last loaded successfully, empty if it has never loaded
+type watchedFile struct {
+	hash     [sha256.Size]byte
+	itemType string
+	name     string
+}
+
+//fileLoader is implemented by repositories that can load individual files
+type fileLoader interface {
+	loadFile(fsys fs.FS, p, namespace, replaces string) *FileLoadResult
+	readFile(fsys fs.FS, p, namespace string) (*FileLoadResult, *tableFile)
+	storeTable(tf *tableFile, replaces string) error
+}
+
+//NewWatcher creates a Watcher that polls fsys every interval and applies any
+//changes to repo. onChange is called, from the Watcher's goroutine, for each
+//change found and may be nil. The repository must have been created with
+//NewTableRepository.
+//
+//The first scan loads every file in fsys as LoadFS does, including keeping only
+//the first valid of any files defining the same item, so a Watcher may be used
+//in place of LoadFS to populate a repository
+func NewWatcher(repo TableRepository, fsys fs.FS, interval time.Duration,
+	onChange func(*WatchEvent)) (*Watcher, error) {
+	return NewWatcherNamespace(repo, fsys, "", interval, onChange)
+}
+
+//NewWatcherNamespace is NewWatcher for content placed in the given namespace,
+//as by LoadFSNamespace. A Watcher may be used in place of LoadFSNamespace to
+//populate a repository
+func NewWatcherNamespace(repo TableRepository, fsys fs.FS, namespace string, interval time.Duration,
+	onChange func(*WatchEvent)) (*Watcher, error) {
+
+	loader, ok := repo.(fileLoader)
+	if !ok {
+		return nil, errors.New("repository does not support loading files")
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("Invalid watch interval: %s", interval)
+	}
+	if namespace != "" {
+		vr := validate.NewValidationResult()
+		util.IsValidName(namespace, "namespace", "NewWatcherNamespace", vr)
+		if !vr.Valid() {
+			return nil, errors.New(vr.Errors[0])
+		}
+	}
+
+	return &Watcher{
+		repo:      repo,
+		loader:    loader,
+		fsys:      fsys,
+		namespace: namespace,
+		interval:  interval,
+		onChange:  onChange,
+		files:     make(map[string]*watchedFile),
+		scanLock:  &sync.Mutex{},
+		startOnce: &sync.Once{},
+		stopOnce:  &sync.Once{},
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}, nil
+}
+
+//Start scans the file system immediately and then once per interval until
+//Stop is called. Start returns immediately; scanning happens in the background
+func (w *Watcher) Start() {
+	w.startOnce.Do(func() {
+		go func() {
+			defer close(w.done)
+			ticker := time.NewTicker(w.interval)
+			defer ticker.Stop()
+
+			w.notify(w.Scan())
+			for {
+				select {
+				case <-ticker.C:
+					w.notify(w.Scan())
+				case <-w.stop:
+					return
+				}
+			}
+		}()
+	})
+}
+
+//Stop stops a started Watcher and waits for any scan in progress to finish
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	started := true
+	w.startOnce.Do(func() { //never started, nothing to wait for
+		started = false
+	})
+	if started {
+		<-w.done
+	}
+}
+
+//Scan checks the file system once, applies any changes to the repository and
+//returns the changes found. The onChange callback is not called. Scan may be
+//used to drive a Watcher manually instead of calling Start
+func (w *Watcher) Scan() []*WatchEvent {
+	w.scanLock.Lock()
+	defer w.scanLock.Unlock()
+
+	events := make([]*WatchEvent, 0)
+
+	paths, err := contentPaths(w.fsys)
+	if err != nil {
+		//do not treat an unreadable file system as every file having been deleted
+		return append(events, &WatchEvent{Change: WatchError, Err: err})
+	}
+
+	//the first scan loads as LoadFSNamespace does, see loadFirst
+	var claimed map[string]string
+	if !w.scanned {
+		claimed = make(map[string]string)
+		w.scanned = true
+	}
+
+	//added and changed files
+	seen := make(map[string]struct{}, len(paths))
+	for _, p := range paths {
+		seen[p] = struct{}{}
+
+		data, err := fs.ReadFile(w.fsys, p)
+		if err != nil { //likely deleted since the walk, catch it next time
+			continue
+		}
+		hash := sha256.Sum256(data)
+
+		wf, known := w.files[p]
+		if known && wf.hash == hash {
+			continue
+		}
+
+		change := WatchUpdated
+		if !known {
+			change = WatchAdded
+			wf = &watchedFile{itemType: itemTypeForPath(p)}
+			w.files[p] = wf
+		}
+		wf.hash = hash
+
+		//the file's own table may be replaced whatever the collision policy
+		var result *FileLoadResult
+		duplicate := false
+		if claimed != nil {
+			result, duplicate = w.loadFirst(p, claimed)
+		} else {
+			result = w.loader.loadFile(w.fsys, p, w.namespace, wf.name)
+		}
+		event := &WatchEvent{
+			Path:   p,
+			Change: change,
+			Result: result,
+		}
+		if duplicate {
+			//not loaded but still provides the item should the first file go
+			wf.name = result.Name
+		} else if result.Loaded() {
+			//a table file may now define a table with a different name
+			previous := wf.name
+			wf.name = result.Name
+			if previous != "" && previous != result.Name {
+				event.Err = w.removeItem(wf.itemType, previous)
+			}
+		}
+		events = append(events, event)
+	}
+
+	//deleted files
+	for p, wf := range w.files {
+		if _, found := seen[p]; found {
+			continue
+		}
+		delete(w.files, p)
+		event := &WatchEvent{
+			Path:   p,
+			Change: WatchRemoved,
+		}
+		if wf.name != "" {
+			event.Err = w.removeItem(wf.itemType, wf.name)
+		}
+		events = append(events, event)
+	}
+
+	return events
+}
+
+//loads a file on the first scan. Of two files defining the same table or script
+//only the first valid file in path order is loaded and the later are reported,
+//as by LoadFSNamespace. claimed holds the path that defined each item so far.
+//Reports whether the file was not loaded as it defines an item already defined
+func (w *Watcher) loadFirst(p string, claimed map[string]string) (*FileLoadResult, bool) {
+	itemType := itemTypeForPath(p)
+	if itemType == itemTypeScript {
+		name := util.QualifyName(w.namespace, scriptNameForPath(p))
+		if firstPath, found := claimed[itemType+":"+name]; found {
+			return &FileLoadResult{
+				Path:     p,
+				ItemType: itemType,
+				Name:     name,
+				Err:      fmt.Errorf("Script: %s is already defined by: %s", name, firstPath),
+			}, true
+		}
+		claimed[itemType+":"+name] = p
+		return w.loader.loadFile(w.fsys, p, w.namespace, ""), false
+	}
+
+	result, tf := w.loader.readFile(w.fsys, p, w.namespace)
+	if tf == nil || !tf.validationResults.Valid() {
+		return result, false
+	}
+	if firstPath, found := claimed[itemType+":"+result.Name]; found {
+		result.Err = fmt.Errorf("Table: %s is already defined by: %s", result.Name, firstPath)
+		return result, true
+	}
+	claimed[itemType+":"+result.Name] = p
+	result.Err = w.loader.storeTable(tf, "")
+	return result, false
+}
+
+//removes a table or script from the repository. If another watched file still
+//provides an item of the same name the item is reloaded from that file instead,
+//since the repository may hold the version of the file that no longer does
+func (w *Watcher) removeItem(itemType, name string) error {
+	survivor := ""
+	for p, wf := range w.files {
+		if wf.itemType == itemType && wf.name == name && (survivor == "" || p < survivor) {
+			survivor = p
+		}
+	}
+	if survivor != "" {
+		wf := w.files[survivor]
+		result := w.loader.loadFile(w.fsys, survivor, w.namespace, name)
+		if result.Loaded() && result.Name == name {
+			return nil
+		}
+
+		//the surviving file no longer provides the item either
+		wf.name = ""
+		if result.Loaded() {
+			wf.name = result.Name
+		}
+	}
+	if itemType == itemTypeTable {
+		return w.repo.RemoveTable(name, false)
+	}
+	return w.repo.RemoveLuaScript(name)
+}
+
+func (w *Watcher) notify(events []*WatchEvent) {
+	if w.onChange == nil {
+		return
+	}
+	for _, e := range events {
+		w.onChange(e)
+	}
+}
@@ -0,0 +1,265 @@
+package tablib
+
+/*
+These tests focus on keeping a repository in sync with a changing file system
+*/
+
+import (
+	"fmt"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+const (
+	watchYmlV1 = `
+  definition:
+    name: Watched
+    type: flat
+  content:
+    - version 1`
+
+	watchYmlV2 = `
+  definition:
+    name: Watched
+    type: flat
+  content:
+    - version 2`
+
+	watchYmlInvalid = `
+  definition:
+    name: Watched
+    type: flat
+  content:
+    - "{@broken"`
+
+	watchYmlRenamed = `
+  definition:
+    name: Renamed
+    type: flat
+  content:
+    - version 3`
+)
+
+func TestWatcher_shouldTrackFileChanges(t *testing.T) {
+	fsys := fstest.MapFS{
+		"watched.yml": {Data: []byte(watchYmlV1)},
+		"script.lua":  {Data: []byte(`results = {}`)},
+	}
+
+	repo := NewTableRepository()
+	w, err := NewWatcher(repo, fsys, time.Second, nil)
+	failOnErr("Unable to create watcher", err, t)
+
+	//first scan loads everything
+	events := w.Scan()
+	if len(events) != 2 || events[0].Change != WatchAdded || events[1].Change != WatchAdded {
+		t.Fatalf("Unexpected initial events: %v", events)
+	}
+	if repo.Roll("Watched", 1).Result[0] != "version 1" {
+		t.Error("Table not loaded on first scan")
+	}
+
+	//nothing changed
+	if events = w.Scan(); len(events) != 0 {
+		t.Errorf("Unexpected events when nothing changed: %v", events)
+	}
+
+	//update the table
+	fsys["watched.yml"] = &fstest.MapFile{Data: []byte(watchYmlV2)}
+	events = w.Scan()
+	if len(events) != 1 || events[0].Change != WatchUpdated || !events[0].Result.Loaded() {
+		t.Fatalf("Unexpected update events: %v", events)
+	}
+	if repo.Roll("Watched", 1).Result[0] != "version 2" {
+		t.Error("Table not reloaded")
+	}
+
+	//break the table - last good version stays
+	fsys["watched.yml"] = &fstest.MapFile{Data: []byte(watchYmlInvalid)}
+	events = w.Scan()
+	if len(events) != 1 || events[0].Result.Loaded() || events[0].Result.ValidationResult.Valid() {
+		t.Fatalf("Expected a failed update: %v", events)
+	}
+	if repo.Roll("Watched", 1).Result[0] != "version 2" {
+		t.Error("Last good version of table was not kept")
+	}
+
+	//rename the table - old name is dropped
+	fsys["watched.yml"] = &fstest.MapFile{Data: []byte(watchYmlRenamed)}
+	events = w.Scan()
+	if len(events) != 1 || !events[0].Result.Loaded() || events[0].Err != nil {
+		t.Fatalf("Unexpected rename events: %v", events)
+	}
+	if _, err := repo.List("Watched", itemTypeTable); err == nil {
+		t.Error("Table under old name was not removed")
+	}
+	if repo.Roll("Renamed", 1).Result[0] != "version 3" {
+		t.Error("Renamed table not loaded")
+	}
+
+	//delete files
+	delete(fsys, "watched.yml")
+	delete(fsys, "script.lua")
+	events = w.Scan()
+	if len(events) != 2 || events[0].Change != WatchRemoved || events[1].Change != WatchRemoved {
+		t.Fatalf("Unexpected removal events: %v", events)
+	}
+	sr, _ := repo.Search("", nil)
+	if len(sr) != 0 {
+		t.Error("Items for deleted files were not removed")
+	}
+}
+
+func TestWatcher_shouldNotifyWhenStarted(t *testing.T) {
+	fsys := fstest.MapFS{
+		"watched.yml": {Data: []byte(watchYmlV1)},
+	}
+
+	repo := NewTableRepository()
+	changes := make(chan *WatchEvent, 10)
+	w, err := NewWatcher(repo, fsys, 10*time.Millisecond, func(e *WatchEvent) {
+		changes <- e
+	})
+	failOnErr("Unable to create watcher", err, t)
+
+	w.Start()
+	defer w.Stop()
+
+	select {
+	case e := <-changes:
+		if e.Path != "watched.yml" || e.Change != WatchAdded {
+			t.Errorf("Unexpected event: %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watcher did not report initial load")
+	}
+}
+
+func TestWatcher_shouldRejectBadInterval(t *testing.T) {
+	_, err := NewWatcher(NewTableRepository(), fstest.MapFS{}, 0, nil)
+	if err == nil {
+		t.Error("Did not receive expected error")
+	}
+}
+
+func TestWatcher_shouldReloadDespiteCollisionPolicy(t *testing.T) {
+	fsys := fstest.MapFS{
+		"watched.yml": {Data: []byte(watchYmlV1)},
+	}
+
+	repo := NewTableRepository(WithCollisionPolicy(CollisionError))
+	w, err := NewWatcher(repo, fsys, time.Second, nil)
+	failOnErr("Unable to create watcher", err, t)
+	w.Scan()
+
+	//a file may always replace its own table
+	fsys["watched.yml"] = &fstest.MapFile{Data: []byte(watchYmlV2)}
+	if events := w.Scan(); len(events) != 1 || !events[0].Result.Loaded() {
+		t.Fatalf("Unexpected update events: %v", events)
+	}
+
+	//but not the table of another file
+	fsys["other.yml"] = &fstest.MapFile{Data: []byte(watchYmlV1)}
+	if events := w.Scan(); len(events) != 1 || events[0].Result.Loaded() {
+		t.Fatalf("Colliding file should not have loaded: %v", events)
+	}
+	if repo.Roll("Watched", 1).Result[0] != "version 2" {
+		t.Error("Table should not have been replaced")
+	}
+}
+
+func TestWatcher_shouldReloadTableFromRemainingFile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.yml": {Data: []byte(watchYmlV1)},
+		"b.yml": {Data: []byte(watchYmlV2)},
+	}
+
+	repo := NewTableRepository()
+	w, err := NewWatcher(repo, fsys, time.Second, nil)
+	failOnErr("Unable to create watcher", err, t)
+	if events := w.Scan(); len(events) != 2 || events[0].Err != nil || events[1].Result.Err == nil {
+		t.Fatalf("Unexpected initial events: %v", events)
+	}
+	if repo.Roll("Watched", 1).Result[0] != "version 1" {
+		t.Fatal("The first file scanned should have been loaded")
+	}
+
+	//the table is still defined by the other file
+	delete(fsys, "a.yml")
+	if events := w.Scan(); len(events) != 1 || events[0].Change != WatchRemoved || events[0].Err != nil {
+		t.Fatalf("Unexpected remove events: %v", events)
+	}
+	if repo.Roll("Watched", 1).Result[0] != "version 2" {
+		t.Error("The table should have been reloaded from the remaining file")
+	}
+
+	//and then by no file at all
+	delete(fsys, "b.yml")
+	w.Scan()
+	if _, err := repo.List("Watched", itemTypeTable); err == nil {
+		t.Error("The table should have been removed")
+	}
+}
+
+func TestWatcher_shouldLoadFirstFilesAsLoadFSDoes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/x.yml": {Data: []byte(watchYmlInvalid)},
+		"b/x.yml": {Data: []byte(watchYmlV1)},
+		"c/x.yml": {Data: []byte(watchYmlV2)},
+		"a/s.lua": {Data: []byte(`results = {"a"}`)},
+		"b/s.lua": {Data: []byte(`results = {"b"}`)},
+	}
+
+	loaded := NewTableRepository()
+	report, err := loaded.LoadFS(fsys)
+	failOnErr("Unable to load", err, t)
+
+	watched := NewTableRepository()
+	w, err := NewWatcher(watched, fsys, time.Second, nil)
+	failOnErr("Unable to create watcher", err, t)
+	events := w.Scan()
+	if len(events) != len(report.Files) {
+		t.Fatalf("Unexpected events: %v", events)
+	}
+	for i, e := range events {
+		want, got := report.Files[i], e.Result
+		if want.Path != got.Path || want.Loaded() != got.Loaded() || fmt.Sprint(want.Err) != fmt.Sprint(got.Err) {
+			t.Errorf("%s: watched: %v %v loaded: %v %v", got.Path, got.Loaded(), got.Err, want.Loaded(), want.Err)
+		}
+	}
+	for _, repo := range []TableRepository{loaded, watched} {
+		if repo.Roll("Watched", 1).Result[0] != "version 1" {
+			t.Error("The first valid table should have been loaded")
+		}
+		if src, _ := repo.List("s", itemTypeScript); src != `results = {"a"}` {
+			t.Errorf("The first script should have been loaded: %s", src)
+		}
+	}
+}
+
+func TestWatcher_shouldKeepNamespace(t *testing.T) {
+	fsys := fstest.MapFS{
+		"watched.yml": {Data: []byte(watchYmlV1)},
+	}
+
+	repo := NewTableRepository()
+	w, err := NewWatcherNamespace(repo, fsys, "dnd5e", time.Second, nil)
+	failOnErr("Unable to create watcher", err, t)
+	w.Scan()
+
+	fsys["watched.yml"] = &fstest.MapFile{Data: []byte(watchYmlV2)}
+	if events := w.Scan(); len(events) != 1 || events[0].Result.Name != "dnd5e/Watched" {
+		t.Fatalf("Unexpected update events: %v", events)
+	}
+	if tr := repo.Roll("dnd5e/Watched", 1); tr.Err != nil || tr.Result[0] != "version 2" {
+		t.Errorf("Table not reloaded in its namespace: %v %v", tr.Result, tr.Err)
+	}
+	if _, err := repo.List("Watched", itemTypeTable); err == nil {
+		t.Error("Table should not have been loaded outside its namespace")
+	}
+
+	if _, err := NewWatcherNamespace(repo, fsys, "bad namespace", time.Second, nil); err == nil {
+		t.Error("Did not receive expected error")
+	}
+}